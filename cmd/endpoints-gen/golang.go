@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// generateGo writes a Go client package of api to w. The package is named
+// pkg, or after the API if pkg is empty.
+func generateGo(w io.Writer, api *apiModel, pkg string) error {
+	if pkg == "" {
+		pkg = strings.ToLower(goName(api.Name))
+	}
+	reserved := map[string]string{
+		"Service":        "client type",
+		"APIError":       "error type",
+		"FieldViolation": "error type",
+		"BasePath":       "constant",
+		"New":            "constructor",
+	}
+
+	var buf bytes.Buffer
+	file := &goFile{api, pkg, usesTime(api), usesInt64Items(api)}
+	if file.Int64Items {
+		reserved["Int64"], reserved["Uint64"] = "helper type", "helper type"
+	}
+	if err := checkNames(api, reserved); err != nil {
+		return err
+	}
+	if err := goTemplate.Execute(&buf, file); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %v\n%s", err, buf.Bytes())
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// goFile is the data of goTemplate.
+type goFile struct {
+	*apiModel
+	Package string
+	// Time is true if the package imports time.
+	Time bool
+	// Int64Items is true if the package declares Int64 and Uint64 types,
+	// see goType.
+	Int64Items bool
+}
+
+// usesTime returns true if any of api's schemas has a date-time property.
+func usesTime(api *apiModel) bool {
+	for _, s := range api.Schemas {
+		for _, p := range s.Props {
+			for ; p != nil; p = p.elem() {
+				if p.Type == "string" && p.Format == "date-time" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// usesInt64Items returns true if any of api's schemas has an array or
+// a map property with 64-bit integer items.
+func usesInt64Items(api *apiModel) bool {
+	for _, s := range api.Schemas {
+		for _, p := range s.Props {
+			for p = p.elem(); p != nil; p = p.elem() {
+				if p.Type == "string" && (p.Format == "int64" || p.Format == "uint64") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// goInitialisms are name parts written in upper case, as golint suggests.
+var goInitialisms = map[string]bool{
+	"api": true, "http": true, "id": true, "ip": true, "json": true,
+	"uri": true, "url": true, "uuid": true,
+}
+
+// goName converts a JSON or method name to an exported Go identifier,
+// e.g. "items.get" to "ItemsGet" and "user_id" to "UserID".
+func goName(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, p := range parts {
+		if goInitialisms[strings.ToLower(p)] {
+			parts[i] = strings.ToUpper(p)
+		} else {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	name := strings.Join(parts, "")
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "X" + name
+	}
+	return name
+}
+
+// goParamsType returns the name of a struct type with params of m.
+func goParamsType(m *methodModel) string {
+	return goName(m.Name) + "Params"
+}
+
+// goType returns the Go type of a schema property.
+func goType(p *propModel) string {
+	return goTypeOf(p, false)
+}
+
+// goTypeOf returns the Go type of a schema property, or of items of an
+// array or values of a map if item is true. 64-bit integer items are of
+// Int64 and Uint64 types encoded as strings, since ",string" option of
+// the struct tag doesn't apply to them.
+func goTypeOf(p *propModel, item bool) string {
+	if p.Ref != "" {
+		return "*" + goName(p.Ref)
+	}
+	if p.Enum != nil {
+		return p.Enum.Name
+	}
+	switch p.Type + "/" + p.Format {
+	case "string/":
+		return "string"
+	case "string/int64":
+		if item {
+			return "Int64"
+		}
+		return "int64"
+	case "string/uint64":
+		if item {
+			return "Uint64"
+		}
+		return "uint64"
+	case "string/byte":
+		return "[]byte"
+	case "string/date-time":
+		return "*time.Time"
+	case "integer/int32":
+		return "int32"
+	case "integer/uint32":
+		return "uint32"
+	case "integer/":
+		return "int64"
+	case "number/float":
+		return "float32"
+	case "number/double", "number/":
+		return "float64"
+	case "boolean/":
+		return "bool"
+	}
+	if p.Type == "array" && p.Items != nil {
+		return "[]" + goTypeOf(p.Items, true)
+	}
+	if p.Type == "object" && p.Values != nil {
+		return "map[string]" + goTypeOf(p.Values, true)
+	}
+	return "json.RawMessage"
+}
+
+// goTag returns the struct tag of a schema property. 64-bit integers are
+// encoded as strings, which is what "string" type with int64 or uint64
+// format means.
+func goTag(p *propModel) string {
+	opts := ",omitempty"
+	if p.Type == "string" && (p.Format == "int64" || p.Format == "uint64") {
+		opts += ",string"
+	}
+	return fmt.Sprintf("`json:\"%s%s\"`", p.Name, opts)
+}
+
+// goParamType returns the Go type of a path or query parameter.
+func goParamType(p *paramModel) string {
+	if p.Enum != nil {
+		return p.Enum.Name
+	}
+	switch p.Type {
+	case "int32", "int64", "uint32", "uint64":
+		return p.Type
+	case "float":
+		return "float32"
+	case "double":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "bytes":
+		return "[]byte"
+	}
+	return "string"
+}
+
+// goFormat returns an expression formatting x, a value of a parameter of
+// type typ, as a string.
+func goFormat(x, typ string) string {
+	switch typ {
+	case "int32", "int64":
+		return fmt.Sprintf("strconv.FormatInt(int64(%s), 10)", x)
+	case "uint32", "uint64":
+		return fmt.Sprintf("strconv.FormatUint(uint64(%s), 10)", x)
+	case "float":
+		return fmt.Sprintf("strconv.FormatFloat(float64(%s), 'g', -1, 32)", x)
+	case "double":
+		return fmt.Sprintf("strconv.FormatFloat(%s, 'g', -1, 64)", x)
+	case "boolean":
+		return fmt.Sprintf("strconv.FormatBool(%s)", x)
+	case "bytes":
+		return fmt.Sprintf("base64.URLEncoding.EncodeToString(%s)", x)
+	}
+	return x
+}
+
+// goParamValue returns an expression formatting x, a value of parameter
+// p, as a string. Values of enum types are converted to their underlying
+// types first.
+func goParamValue(x string, p *paramModel) string {
+	if p.Enum != nil {
+		x = goParamType(&paramModel{Type: p.Type}) + "(" + x + ")"
+	}
+	return goFormat(x, p.Type)
+}
+
+// goEnumBase returns the underlying Go type of enum type e.
+func goEnumBase(e *enumModel) string {
+	return goType(&propModel{Type: e.Type, Format: e.Format})
+}
+
+// goEnumConst returns the name of the constant of enum type e with value
+// v, e.g. ItemStateActive.
+func goEnumConst(e *enumModel, v string) string {
+	return e.Name + goName(v)
+}
+
+// goEnumValue returns a literal of value v of enum type e.
+func goEnumValue(e *enumModel, v string) string {
+	if goEnumBase(e) == "string" {
+		return fmt.Sprintf("%q", v)
+	}
+	return v
+}
+
+// goIsSet returns a condition which is true if x, a value of a parameter
+// of type typ, is not zero.
+func goIsSet(x, typ string) string {
+	switch typ {
+	case "boolean":
+		return x
+	case "bytes":
+		return "len(" + x + ") > 0"
+	case "string", "":
+		return x + ` != ""`
+	}
+	return x + " != 0"
+}
+
+// goPathExpr returns an expression building the path of m, with
+// placeholders replaced by escaped fields of req.
+func goPathExpr(f *goFile, m *methodModel) string {
+	var parts []string
+	path := m.Path
+	for _, name := range m.PathParams {
+		placeholder := "{" + name + "}"
+		i := strings.Index(path, placeholder)
+		if i > 0 {
+			parts = append(parts, fmt.Sprintf("%q", path[:i]))
+		}
+		parts = append(parts, "url.PathEscape("+goParamValue("req."+goName(name), pathParam(f.apiModel, m, name))+")")
+		path = path[i+len(placeholder):]
+	}
+	if path != "" || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%q", path))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// pathParam returns the parameter of a path placeholder of m, or
+// a parameter corresponding to a property of its request.
+func pathParam(api *apiModel, m *methodModel, name string) *paramModel {
+	for _, p := range m.Params {
+		if p.Name == name {
+			return p
+		}
+	}
+	if s := api.schema(m.Request); s != nil {
+		if p := s.prop(name); p != nil {
+			return &paramModel{Name: name, Type: propParamType(p), Enum: p.Enum}
+		}
+	}
+	return &paramModel{Name: name, Type: "string"}
+}
+
+// propParamType returns the parameter type corresponding to a schema
+// property.
+func propParamType(p *propModel) string {
+	switch p.Type + "/" + p.Format {
+	case "string/int64", "string/uint64", "integer/int32", "integer/uint32",
+		"number/float", "number/double":
+		return p.Format
+	case "string/byte":
+		return "bytes"
+	case "boolean/":
+		return "boolean"
+	}
+	return "string"
+}
+
+// goComment formats text as a comment. Every line is prefixed with "// "
+// and indent.
+func goComment(indent, text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(indent+"// "+l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var goTemplate = template.Must(template.New("go").Funcs(template.FuncMap{
+	"comment":    goComment,
+	"enumBase":   goEnumBase,
+	"enumConst":  goEnumConst,
+	"enumValue":  goEnumValue,
+	"isSet":      goIsSet,
+	"name":       goName,
+	"paramType":  goParamType,
+	"paramValue": goParamValue,
+	"paramsType": goParamsType,
+	"pathExpr":   goPathExpr,
+	"tag":        goTag,
+	"type":       goType,
+}).Parse(`// Code generated by endpoints-gen. DO NOT EDIT.
+
+// Package {{.Package}} is a client of {{.Name}} {{.Version}} API.
+{{- with .Desc}}
+//
+{{comment "" .}}
+{{- end}}
+package {{.Package}}
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+{{- if .Int64Items}}
+	"strings"
+{{- end}}
+{{- if .Time}}
+	"time"
+{{- end}}
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// BasePath is the default URL of the API.
+const BasePath = {{printf "%q" .BasePath}}
+
+// Service is a client of {{.Name}} {{.Version}} API.
+type Service struct {
+	client *http.Client
+
+	// BasePath is the URL of the API, with a trailing slash.
+	BasePath string
+}
+
+// New creates a new Service which sends requests with client,
+// or http.DefaultClient if client is nil.
+func New(client *http.Client) *Service {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Service{client: client, BasePath: BasePath}
+}
+
+// APIError is an error response of the API.
+type APIError struct {
+	// Name and Msg are error_name and error_message of the response.
+	Name string
+	Msg  string
+	// Code is the HTTP status code of the response.
+	Code int
+	// Violations are fields of the request which failed validation.
+	Violations []*FieldViolation
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Name, e.Code, e.Msg)
+}
+
+// FieldViolation is a field of a request which failed validation.
+type FieldViolation struct {
+	// Field is the JSON path of the field, e.g. "author.name".
+	Field string ` + "`" + `json:"field"` + "`" + `
+	// Constraint is the violated constraint, e.g. "required" or "max".
+	Constraint string ` + "`" + `json:"constraint"` + "`" + `
+	// Value is the offending value and Limit is the limit of the
+	// constraint, if any.
+	Value json.RawMessage ` + "`" + `json:"value,omitempty"` + "`" + `
+	Limit json.RawMessage ` + "`" + `json:"limit,omitempty"` + "`" + `
+	Msg   string          ` + "`" + `json:"message"` + "`" + `
+}
+{{- if .Int64Items}}
+
+// Int64 is an int64 encoded as a JSON string.
+type Int64 int64
+
+func (i Int64) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatInt(int64(i), 10))), nil
+}
+
+func (i *Int64) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	x, err := strconv.ParseInt(strings.Trim(string(b), ` + "`" + `"` + "`" + `), 10, 64)
+	*i = Int64(x)
+	return err
+}
+
+// Uint64 is a uint64 encoded as a JSON string.
+type Uint64 uint64
+
+func (i Uint64) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(strconv.FormatUint(uint64(i), 10))), nil
+}
+
+func (i *Uint64) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	x, err := strconv.ParseUint(strings.Trim(string(b), ` + "`" + `"` + "`" + `), 10, 64)
+	*i = Uint64(x)
+	return err
+}
+{{- end}}
+{{range .Schemas}}
+{{with .Desc}}{{comment "" .}}{{else}}// {{name .Name}} is {{.Name}} schema of the API.{{end}}
+type {{name .Name}} struct {
+{{- range .Props}}
+{{- with .Desc}}
+{{comment "\t" .}}
+{{- end}}
+	{{name .Name}} {{type .}} {{tag .}}
+{{- end}}
+}
+{{end}}
+{{- range $e := .Enums}}
+// {{.Name}} is an enumeration of the API.
+type {{.Name}} {{enumBase .}}
+
+const (
+{{- range $i, $v := .Values}}
+{{- with index $e.Descs $i}}
+{{comment "\t" .}}
+{{- end}}
+	{{enumConst $e $v}} {{$e.Name}} = {{enumValue $e $v}}
+{{- end}}
+)
+{{end}}
+{{- range $m := .Methods}}
+{{- if .Params}}
+// {{paramsType .}} are parameters of {{.Name}} method.
+type {{paramsType .}} struct {
+{{- range .Params}}
+	{{name .Name}} {{paramType .}}{{if .Required}} // required{{end}}
+{{- end}}
+}
+{{end}}
+// {{name .Name}} calls {{.Name}} method, {{.HTTPMethod}} {{.Path}}.
+{{- with .Desc}}
+//
+{{comment "" .}}
+{{- end}}
+func (s *Service) {{name .Name}}(ctx context.Context
+{{- if .Params}}, req *{{paramsType .}}{{else if .Request}}, req *{{name .Request}}{{end}}) (
+{{- with .Response}}*{{name .}}, {{end}}error) {
+	path := {{pathExpr $ .}}
+	query := url.Values{}
+{{- range .Params}}{{if not .InPath}}
+{{- if .Required}}
+	query.Set({{printf "%q" .Name}}, {{paramValue (print "req." (name .Name)) .}})
+{{- else}}
+	if {{isSet (print "req." (name .Name)) .Type}} {
+		query.Set({{printf "%q" .Name}}, {{paramValue (print "req." (name .Name)) .}})
+	}
+{{- end}}
+{{- end}}{{end}}
+{{- if .Response}}
+	resp := new({{name .Response}})
+	if err := s.call(ctx, {{printf "%q" .HTTPMethod}}, path, query, {{if .Request}}req{{else}}nil{{end}}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+{{- else}}
+	return s.call(ctx, {{printf "%q" .HTTPMethod}}, path, query, {{if .Request}}req{{else}}nil{{end}}, nil)
+{{- end}}
+}
+{{end}}
+// call sends a request to path, relative to s.BasePath, with body encoded
+// as JSON, if not nil. It decodes a successful response into resp, if not
+// nil, and an error response into *APIError.
+func (s *Service) call(ctx context.Context, method, path string, query url.Values, body, resp interface{}) error {
+	u := s.BasePath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := ctxhttp.Do(ctx, s.client, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return decodeError(res)
+	}
+	if resp == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+// decodeError creates an *APIError from an error response.
+func decodeError(res *http.Response) error {
+	apiErr := &APIError{Name: http.StatusText(res.StatusCode), Code: res.StatusCode}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	var errResp struct {
+		Name       string            ` + "`" + `json:"error_name"` + "`" + `
+		Msg        string            ` + "`" + `json:"error_message"` + "`" + `
+		Violations []*FieldViolation ` + "`" + `json:"field_violations"` + "`" + `
+	}
+	if json.Unmarshal(b, &errResp) != nil {
+		apiErr.Msg = string(b)
+		return apiErr
+	}
+	if errResp.Name != "" {
+		apiErr.Name = errResp.Name
+	}
+	apiErr.Msg = errResp.Msg
+	apiErr.Violations = errResp.Violations
+	return apiErr
+}
+
+var (
+	_ = base64.URLEncoding
+	_ = strconv.Itoa
+)
+`))
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGo(t *testing.T) {
+	api, err := newAPIModel(createItemsDescriptor(t))
+	if err != nil {
+		t.Fatalf("newAPIModel: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := generateGo(&buf, api, ""); err != nil {
+		t.Fatalf("generateGo: %v", err)
+	}
+	src := buf.String()
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "client.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	wants := []string{
+		"// Code generated by endpoints-gen. DO NOT EDIT.",
+		"package items\n",
+		`const BasePath = "https://localhost/_ah/api/items/v1/"`,
+		"\t\"time\"\n",
+		"ID      int64      `json:\"id,omitempty,string\"`",
+		"Created *time.Time `json:\"created,omitempty\"`",
+		"Data    []byte     `json:\"data,omitempty\"`",
+		"\t// Name of the item\n",
+		"Items []*Item `json:\"items,omitempty\"`",
+		"Related []Int64   `json:\"related,omitempty\"`",
+		"State   ItemState `json:\"state,omitempty\"`",
+		"type Int64 int64\n",
+		"type Uint64 uint64\n",
+		"\t\"strings\"\n",
+		"// ItemState is an enumeration of the API.\ntype ItemState string\n",
+		"\t// Visible item\n\tItemStateActive ItemState = \"active\"\n\tItemStateDone   ItemState = \"done\"\n",
+		"type ItemsListParams struct {\n\tLimit int32\n\tQ     string\n\tState ItemsListState\n}",
+		`query.Set("state", string(req.State))`,
+		"type ItemsGetParams struct {\n\tID int64 // required\n}",
+		"func (s *Service) ItemsGet(ctx context.Context, req *ItemsGetParams) (*Item, error) {",
+		`path := "items/" + url.PathEscape(strconv.FormatInt(int64(req.ID), 10))`,
+		"func (s *Service) ItemsDelete(ctx context.Context, req *ItemsDeleteParams) error {",
+		"func (s *Service) ItemsUpdate(ctx context.Context, req *Item) (*Item, error) {",
+		`s.call(ctx, "PUT", path, query, req, resp)`,
+		"if req.Q != \"\" {\n\t\tquery.Set(\"q\", req.Q)\n\t}",
+		`json:"error_name"`,
+		`json:"error_message"`,
+		`json:"field_violations"`,
+	}
+	for _, want := range wants {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("generated code:\n%s", src)
+	}
+}
+
+func TestGenerateGoNameConflict(t *testing.T) {
+	api := &apiModel{
+		Name:    "items",
+		Version: "v1",
+		Schemas: []*schemaModel{{Name: "ItemsGetParams"}},
+		Methods: []*methodModel{{
+			Name:       "items.get",
+			HTTPMethod: "GET",
+			Path:       "items",
+			Params:     []*paramModel{{Name: "id", Type: "string"}},
+		}},
+	}
+	if err := generateGo(&bytes.Buffer{}, api, ""); err == nil {
+		t.Errorf("generateGo(ItemsGetParams schema and items.get params) = nil; want error")
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tts := []struct{ in, out string }{
+		{"items.get", "ItemsGet"},
+		{"user_id", "UserID"},
+		{"apiUrl", "ApiUrl"},
+		{"api_url", "APIURL"},
+		{"2fa", "X2fa"},
+		{"Item", "Item"},
+	}
+	for _, tt := range tts {
+		if out := goName(tt.in); out != tt.out {
+			t.Errorf("goName(%q) = %q; want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestGoType(t *testing.T) {
+	tts := []struct {
+		prop *propModel
+		typ  string
+	}{
+		{&propModel{Type: "string"}, "string"},
+		{&propModel{Type: "string", Format: "int64"}, "int64"},
+		{&propModel{Type: "string", Format: "uint64"}, "uint64"},
+		{&propModel{Type: "string", Format: "byte"}, "[]byte"},
+		{&propModel{Type: "string", Format: "date-time"}, "*time.Time"},
+		{&propModel{Type: "integer", Format: "int32"}, "int32"},
+		{&propModel{Type: "number", Format: "float"}, "float32"},
+		{&propModel{Type: "boolean"}, "bool"},
+		{&propModel{Ref: "Item"}, "*Item"},
+		{&propModel{Type: "array", Items: &propModel{Type: "string", Format: "int64"}}, "[]Int64"},
+		{&propModel{Type: "object"}, "json.RawMessage"},
+		{&propModel{Type: "object", Values: &propModel{Ref: "Item"}}, "map[string]*Item"},
+		{&propModel{Type: "array", Items: &propModel{Type: "object", Values: &propModel{Type: "boolean"}}},
+			"[]map[string]bool"},
+		{&propModel{Type: "any"}, "json.RawMessage"},
+	}
+	for _, tt := range tts {
+		if typ := goType(tt.prop); typ != tt.typ {
+			t.Errorf("goType(%+v) = %q; want %q", tt.prop, typ, tt.typ)
+		}
+	}
+}
+
+func TestGoEnumValue(t *testing.T) {
+	tts := []struct {
+		enum *enumModel
+		v    string
+		want string
+	}{
+		{&enumModel{Type: "string"}, "active", `"active"`},
+		{&enumModel{Type: "integer", Format: "int32"}, "1", "1"},
+		{&enumModel{Type: "string", Format: "int64"}, "10", "10"},
+		{&enumModel{Type: "boolean"}, "true", "true"},
+	}
+	for _, tt := range tts {
+		if got := goEnumValue(tt.enum, tt.v); got != tt.want {
+			t.Errorf("goEnumValue(%+v, %q) = %s; want %s", tt.enum, tt.v, got, tt.want)
+		}
+	}
+}
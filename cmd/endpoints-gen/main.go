@@ -0,0 +1,194 @@
+// Command endpoints-gen generates typed API clients from Endpoints API
+// descriptors.
+//
+// Descriptors are read from a file, as saved from RPCService.APIDescriptor
+// or BackendService.getApiConfigs, or fetched from a running server:
+//
+//	endpoints-gen -in greetings.json -o greetings/client.go
+//	endpoints-gen -url http://localhost:8080/_ah/spi/BackendService.getApiConfigs -api greetings
+//	endpoints-gen -in greetings.json -lang ts -o static/greetings.ts
+//
+// Flags:
+//
+//	-in      file with an APIDescriptor, a list of them or an APIConfigsList
+//	-url     URL of BackendService.getApiConfigs of a running server
+//	-api     name or name:version of the API, if there are several
+//	-lang    language of the client, "go" or "ts" (TypeScript)
+//	-pkg     name of the generated Go package, the API name by default
+//	-o       output file, stdout by default
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/go-endpoints/endpoints"
+)
+
+var (
+	inFile  = flag.String("in", "", "file with API descriptors")
+	fromURL = flag.String("url", "", "URL of BackendService.getApiConfigs of a running server")
+	apiName = flag.String("api", "", "name or name:version of the API")
+	lang    = flag.String("lang", "go", "language of the client")
+	pkgName = flag.String("pkg", "", "name of the generated Go package")
+	outFile = flag.String("o", "", "output file")
+)
+
+// generators write a client of an API in a given language.
+var generators = map[string]func(w io.Writer, api *apiModel) error{
+	"go": func(w io.Writer, api *apiModel) error {
+		return generateGo(w, api, *pkgName)
+	},
+	"ts": generateTS,
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("endpoints-gen: ")
+	flag.Parse()
+
+	gen := generators[*lang]
+	if gen == nil {
+		log.Fatalf("unsupported language %q", *lang)
+	}
+
+	var (
+		descs []*endpoints.APIDescriptor
+		err   error
+	)
+	switch {
+	case *inFile != "" && *fromURL == "":
+		var b []byte
+		if b, err = ioutil.ReadFile(*inFile); err == nil {
+			descs, err = parseDescriptors(b)
+		}
+	case *fromURL != "" && *inFile == "":
+		descs, err = fetchDescriptors(*fromURL)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d, err := selectDescriptor(descs, *apiName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	api, err := newAPIModel(d)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := gen(&buf, api); err != nil {
+		log.Fatal(err)
+	}
+	if *outFile == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = ioutil.WriteFile(*outFile, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseDescriptors decodes API descriptors from JSON b, which is either
+// a single APIDescriptor, an array of them or an APIConfigsList.
+func parseDescriptors(b []byte) ([]*endpoints.APIDescriptor, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var descs []*endpoints.APIDescriptor
+		if err := json.Unmarshal(b, &descs); err != nil {
+			return nil, err
+		}
+		return descs, nil
+	}
+
+	var probe struct {
+		Items *[]string `json:"items"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return nil, err
+	}
+	if probe.Items == nil {
+		d := &endpoints.APIDescriptor{}
+		if err := json.Unmarshal(b, d); err != nil {
+			return nil, err
+		}
+		return []*endpoints.APIDescriptor{d}, nil
+	}
+
+	descs := make([]*endpoints.APIDescriptor, len(*probe.Items))
+	for i, item := range *probe.Items {
+		descs[i] = &endpoints.APIDescriptor{}
+		if err := json.Unmarshal([]byte(item), descs[i]); err != nil {
+			return nil, fmt.Errorf("item %d: %v", i, err)
+		}
+	}
+	return descs, nil
+}
+
+// fetchDescriptors calls BackendService.getApiConfigs at url and returns
+// descriptors of all APIs registered with the server.
+func fetchDescriptors(url string) ([]*endpoints.APIDescriptor, error) {
+	resp, err := http.Post(url, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s: %s", url, resp.Status, bytes.TrimSpace(b))
+	}
+	return parseDescriptors(b)
+}
+
+// selectDescriptor returns the descriptor of API name, "name" or
+// "name:version", or the only descriptor if name is empty.
+func selectDescriptor(descs []*endpoints.APIDescriptor, name string) (*endpoints.APIDescriptor, error) {
+	if name == "" {
+		switch len(descs) {
+		case 0:
+			return nil, errors.New("no API descriptors found")
+		case 1:
+			return descs[0], nil
+		}
+		var ids []string
+		for _, d := range descs {
+			ids = append(ids, d.Name+":"+d.Version)
+		}
+		return nil, fmt.Errorf("several APIs found, use -api to select one of %s", strings.Join(ids, ", "))
+	}
+
+	var found *endpoints.APIDescriptor
+	for _, d := range descs {
+		if name == d.Name+":"+d.Version {
+			return d, nil
+		}
+		if name == d.Name {
+			if found != nil {
+				return nil, fmt.Errorf("several versions of %s found, use -api %s:version", name, name)
+			}
+			found = d
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("API %s not found", name)
+	}
+	return found, nil
+}
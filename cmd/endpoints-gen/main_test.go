@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/go-endpoints/endpoints"
+)
+
+func TestParseDescriptors(t *testing.T) {
+	d := createItemsDescriptor(t)
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := json.Marshal(map[string][]string{"items": {string(b), string(b)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tts := []struct {
+		in  string
+		num int
+	}{
+		{string(b), 1},
+		{"[" + string(b) + "," + string(b) + "]", 2},
+		{string(list), 2},
+		{`{"items": []}`, 0},
+	}
+	for i, tt := range tts {
+		descs, err := parseDescriptors([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%d: parseDescriptors: %v", i, err)
+			continue
+		}
+		if len(descs) != tt.num {
+			t.Errorf("%d: len(descs) = %d; want %d", i, len(descs), tt.num)
+			continue
+		}
+		for _, desc := range descs {
+			if desc.Name != "items" || len(desc.Methods) != len(d.Methods) {
+				t.Errorf("%d: desc = %s with %d methods; want items with %d",
+					i, desc.Name, len(desc.Methods), len(d.Methods))
+			}
+		}
+	}
+
+	for _, in := range []string{"", "{", `{"items": [1]}`, `{"items": ["{"]}`} {
+		if _, err := parseDescriptors([]byte(in)); err == nil {
+			t.Errorf("parseDescriptors(%q) = nil error; want error", in)
+		}
+	}
+}
+
+func TestSelectDescriptor(t *testing.T) {
+	v1 := &endpoints.APIDescriptor{Name: "items", Version: "v1"}
+	v2 := &endpoints.APIDescriptor{Name: "items", Version: "v2"}
+	other := &endpoints.APIDescriptor{Name: "other", Version: "v1"}
+	descs := []*endpoints.APIDescriptor{v1, v2, other}
+
+	tts := []struct {
+		descs []*endpoints.APIDescriptor
+		name  string
+		want  *endpoints.APIDescriptor
+	}{
+		{[]*endpoints.APIDescriptor{v1}, "", v1},
+		{descs, "items:v2", v2},
+		{descs, "other", other},
+		{descs, "", nil},
+		{descs, "items", nil},
+		{descs, "items:v3", nil},
+		{nil, "", nil},
+	}
+	for i, tt := range tts {
+		d, err := selectDescriptor(tt.descs, tt.name)
+		if d != tt.want {
+			t.Errorf("%d: selectDescriptor(%q) = %v; want %v", i, tt.name, d, tt.want)
+		}
+		if (err == nil) != (tt.want != nil) {
+			t.Errorf("%d: selectDescriptor(%q) error = %v", i, tt.name, err)
+		}
+	}
+}
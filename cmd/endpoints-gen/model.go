@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/go-endpoints/endpoints"
+)
+
+// apiModel is an API descriptor rearranged for client generators:
+// everything is sorted and cross-referenced.
+type apiModel struct {
+	Name    string
+	Version string
+	Desc    string
+	// BasePath is the URL of the API, with a trailing slash, e.g.
+	// "https://host/_ah/api/greetings/v1/".
+	BasePath string
+	Schemas  []*schemaModel
+	Methods  []*methodModel
+	// Enums are enumerations of properties and parameters, in the order
+	// of Schemas and Methods.
+	Enums []*enumModel
+}
+
+// schemaModel is a request or response schema.
+type schemaModel struct {
+	Name  string
+	Desc  string
+	Props []*propModel
+}
+
+// propModel is a property of a schema, items of an array property or
+// values of a map property.
+type propModel struct {
+	// Name is the JSON name, empty for array items and map values.
+	Name     string
+	Desc     string
+	Required bool
+	// Type and Format are as in APISchemaProperty. Type is empty if Ref
+	// is set.
+	Type   string
+	Format string
+	Ref    string
+	Items  *propModel
+	// Values are set for a map property, an object without a schema.
+	Values *propModel
+	// Enum is set if values of the property are restricted.
+	Enum *enumModel
+}
+
+// elem returns the items of an array property or the values of a map
+// property, or nil.
+func (p *propModel) elem() *propModel {
+	if p.Items != nil {
+		return p.Items
+	}
+	return p.Values
+}
+
+// methodModel is a method of an API.
+type methodModel struct {
+	// Name is the method name without the API prefix, e.g. "items.get".
+	Name       string
+	Desc       string
+	HTTPMethod string
+	// Path is the path template relative to BasePath, e.g. "items/{id}".
+	Path string
+	// Params are parameters of bodiless methods, i.e. GET and DELETE,
+	// sent in the path or query string.
+	Params []*paramModel
+	// PathParams are names of path placeholders, in the order of Path.
+	PathParams []string
+	// Request and Response are schema names, empty if the method does
+	// not have a request or response body.
+	Request  string
+	Response string
+}
+
+// paramModel is a path or query parameter of a bodiless method.
+type paramModel struct {
+	Name     string
+	Type     string
+	Required bool
+	InPath   bool
+	Enum     *enumModel
+}
+
+// enumModel is an enumeration of valid values of a property or parameter.
+type enumModel struct {
+	// Name is the name of generated types, the schema or method name
+	// followed by the property or parameter name, e.g. ItemState.
+	Name string
+	// Type and Format are as in APISchemaProperty.
+	Type   string
+	Format string
+	Values []string
+	Descs  []string
+}
+
+// newAPIModel creates a model of the API described by d.
+func newAPIModel(d *endpoints.APIDescriptor) (*apiModel, error) {
+	if d.Name == "" || d.Version == "" {
+		return nil, fmt.Errorf("API descriptor has no name or version")
+	}
+	api := &apiModel{
+		Name:     d.Name,
+		Version:  d.Version,
+		Desc:     d.Desc,
+		BasePath: fmt.Sprintf("%s/%s/%s/", strings.TrimSuffix(d.Root, "/"), d.Name, d.Version),
+	}
+
+	for _, name := range sortedKeys(d.Descriptor.Schemas) {
+		sd := d.Descriptor.Schemas[name]
+		schema := &schemaModel{Name: name, Desc: sd.Desc}
+		for _, pname := range sortedKeys(sd.Properties) {
+			prop := newPropModel(sd.Properties[pname])
+			prop.Name = pname
+			schema.Props = append(schema.Props, prop)
+			for p := prop; p != nil; p = p.elem() {
+				if p.Enum != nil {
+					p.Enum.Name = goName(name) + goName(pname)
+					api.Enums = append(api.Enums, p.Enum)
+				}
+			}
+		}
+		api.Schemas = append(api.Schemas, schema)
+	}
+
+	for _, name := range sortedKeys(d.Methods) {
+		am := d.Methods[name]
+		m := &methodModel{
+			Name:       strings.TrimPrefix(name, d.Name+"."),
+			Desc:       am.Desc,
+			HTTPMethod: am.HTTPMethod,
+			Path:       am.Path,
+			PathParams: pathParams(am.Path),
+		}
+		if md := d.Descriptor.Methods[am.RosyMethod]; md != nil {
+			if md.Request != nil {
+				m.Request = md.Request.Ref
+			}
+			if md.Response != nil {
+				m.Response = md.Response.Ref
+			}
+		}
+		if err := api.addParams(m, am.Request.Params); err != nil {
+			return nil, err
+		}
+		api.Methods = append(api.Methods, m)
+	}
+	return api, nil
+}
+
+// addParams sets m.Params from params of a bodiless method and checks
+// that path params of a method with a body are fields of its request.
+func (api *apiModel) addParams(m *methodModel, params map[string]*endpoints.APIRequestParamSpec) error {
+	if m.Request == "" {
+		for _, name := range sortedKeys(params) {
+			spec := params[name]
+			p := &paramModel{
+				Name:     name,
+				Type:     spec.Type,
+				Required: spec.Required,
+				InPath:   contains(m.PathParams, name),
+				Enum:     newParamEnum(spec),
+			}
+			if p.Enum != nil {
+				p.Enum.Name = goName(m.Name) + goName(name)
+				api.Enums = append(api.Enums, p.Enum)
+			}
+			m.Params = append(m.Params, p)
+		}
+		for _, name := range m.PathParams {
+			if params[name] == nil {
+				return fmt.Errorf("method %s: no parameter for {%s} of path %q", m.Name, name, m.Path)
+			}
+		}
+		return nil
+	}
+
+	schema := api.schema(m.Request)
+	for _, name := range m.PathParams {
+		if schema == nil || schema.prop(name) == nil {
+			return fmt.Errorf("method %s: no field of %s for {%s} of path %q", m.Name, m.Request, name, m.Path)
+		}
+	}
+	return nil
+}
+
+// checkNames returns an error if names of generated types collide with
+// each other or with reserved names, given as name to what it is.
+// Schema types are named after schemas and params types after methods,
+// see goName and goParamsType.
+func checkNames(api *apiModel, reserved map[string]string) error {
+	names := make(map[string]string, len(reserved))
+	for name, what := range reserved {
+		names[name] = what
+	}
+	add := func(name, what string) error {
+		if prev, ok := names[name]; ok {
+			return fmt.Errorf("%s %s conflicts with %s of the same name", what, name, prev)
+		}
+		names[name] = what
+		return nil
+	}
+	for _, s := range api.Schemas {
+		if err := add(goName(s.Name), "schema "+s.Name+" type"); err != nil {
+			return err
+		}
+	}
+	for _, e := range api.Enums {
+		if err := add(e.Name, "enum type"); err != nil {
+			return err
+		}
+		for _, v := range e.Values {
+			if err := add(goEnumConst(e, v), "enum "+e.Name+" constant"); err != nil {
+				return err
+			}
+		}
+	}
+	for _, m := range api.Methods {
+		if len(m.Params) == 0 {
+			continue
+		}
+		if err := add(goParamsType(m), "method "+m.Name+" params type"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schema returns a schema given its name, or nil.
+func (api *apiModel) schema(name string) *schemaModel {
+	for _, s := range api.Schemas {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// prop returns a property given its JSON name, or nil.
+func (s *schemaModel) prop(name string) *propModel {
+	for _, p := range s.Props {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// newPropModel creates a model of a schema property.
+func newPropModel(p *endpoints.APISchemaProperty) *propModel {
+	prop := &propModel{
+		Desc:     p.Desc,
+		Required: p.Required,
+		Type:     p.Type,
+		Format:   p.Format,
+		Ref:      p.Ref,
+	}
+	if p.Items != nil {
+		prop.Items = newPropModel(p.Items)
+	}
+	if p.AdditionalProperties != nil {
+		prop.Values = newPropModel(p.AdditionalProperties)
+	}
+	if len(p.Enum) > 0 && isEnumType(p.Type, p.Format) {
+		prop.Enum = &enumModel{Type: p.Type, Format: p.Format, Values: p.Enum, Descs: p.EnumDescs}
+		if len(prop.Enum.Descs) != len(prop.Enum.Values) {
+			prop.Enum.Descs = make([]string, len(prop.Enum.Values))
+		}
+	}
+	return prop
+}
+
+// newParamEnum creates a model of valid values of a parameter, or returns
+// nil if they are not restricted.
+func newParamEnum(spec *endpoints.APIRequestParamSpec) *enumModel {
+	if len(spec.Enum) == 0 {
+		return nil
+	}
+	e := &enumModel{}
+	e.Type, e.Format = paramTypeToPropFormat(spec.Type)
+	if !isEnumType(e.Type, e.Format) {
+		return nil
+	}
+	for _, v := range sortedKeys(spec.Enum) {
+		e.Values = append(e.Values, v)
+		e.Descs = append(e.Descs, spec.Enum[v].Desc)
+	}
+	return e
+}
+
+// paramTypeToPropFormat converts APIRequestParamSpec type into a pair of
+// (type, format) as used by schema properties.
+func paramTypeToPropFormat(t string) (string, string) {
+	switch t {
+	case "int32", "uint32":
+		return "integer", t
+	case "int64", "uint64":
+		return "string", t
+	case "float", "double":
+		return "number", t
+	case "bytes":
+		return "string", "byte"
+	}
+	return t, ""
+}
+
+// isEnumType returns true if generated enum types can have values of
+// a property type and format: strings, 64-bit integers encoded as strings,
+// numbers and booleans.
+func isEnumType(typ, format string) bool {
+	switch typ {
+	case "string":
+		return format == "" || format == "int64" || format == "uint64"
+	case "integer", "number", "boolean":
+		return true
+	}
+	return false
+}
+
+// pathParams returns names of placeholders of a path template, e.g.
+// ["id"] for "items/{id}".
+func pathParams(path string) []string {
+	var params []string
+	for {
+		i := strings.IndexByte(path, '{')
+		if i < 0 {
+			return params
+		}
+		j := strings.IndexByte(path[i:], '}')
+		if j < 0 {
+			return params
+		}
+		params = append(params, path[i+1:i+j])
+		path = path[i+j+1:]
+	}
+}
+
+// sortedKeys returns keys of map m with string keys in increasing order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// contains returns true if value is one of the items of strList.
+func contains(strList []string, value string) bool {
+	for _, s := range strList {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
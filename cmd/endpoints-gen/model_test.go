@@ -0,0 +1,185 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/go-endpoints/endpoints"
+	"golang.org/x/net/context"
+)
+
+type ItemState string
+
+func (ItemState) EndpointsEnum() []endpoints.EnumValue {
+	return []endpoints.EnumValue{{Value: "active", Desc: "Visible item"}, {Value: "done"}}
+}
+
+type Item struct {
+	ID      int64     `json:"id,string"`
+	Name    string    `json:"name" endpoints:"req,desc=Name of the item"`
+	Tags    []string  `json:"tags"`
+	Created time.Time `json:"created"`
+	Data    []byte    `json:"data"`
+	State   ItemState `json:"state"`
+	Related []int64   `json:"related"`
+}
+
+type ItemsListReq struct {
+	Limit int       `json:"limit" endpoints:"d=10"`
+	Query string    `json:"q"`
+	State ItemState `json:"state"`
+}
+
+type ItemsList struct {
+	Items []*Item `json:"items"`
+}
+
+type ItemReq struct {
+	ID int64 `json:"id,string" endpoints:"req"`
+}
+
+type ItemsService struct{}
+
+func (s *ItemsService) List(c context.Context, r *ItemsListReq) (*ItemsList, error) {
+	return &ItemsList{}, nil
+}
+
+func (s *ItemsService) Get(c context.Context, r *ItemReq) (*Item, error) {
+	return &Item{ID: r.ID}, nil
+}
+
+func (s *ItemsService) Update(c context.Context, r *Item) (*Item, error) {
+	return r, nil
+}
+
+func (s *ItemsService) Delete(c context.Context, r *ItemReq) error {
+	return nil
+}
+
+// createItemsDescriptor registers ItemsService and returns its descriptor.
+func createItemsDescriptor(t *testing.T) *endpoints.APIDescriptor {
+	server := endpoints.NewServer("")
+	api, err := server.RegisterService(&ItemsService{}, "items", "v1", "Items API", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	tts := []struct{ name, httpMethod, path string }{
+		{"List", "GET", "items"},
+		{"Get", "GET", "items/{id}"},
+		{"Update", "PUT", "items/{id}"},
+		{"Delete", "DELETE", "items/{id}"},
+	}
+	for _, tt := range tts {
+		info := api.MethodByName(tt.name).Info()
+		info.Name = "items." + strings.ToLower(tt.name)
+		info.HTTPMethod, info.Path = tt.httpMethod, tt.path
+	}
+
+	d := &endpoints.APIDescriptor{}
+	if err := api.APIDescriptor(d, "localhost"); err != nil {
+		t.Fatalf("APIDescriptor: %v", err)
+	}
+	return d
+}
+
+func TestNewAPIModel(t *testing.T) {
+	api, err := newAPIModel(createItemsDescriptor(t))
+	if err != nil {
+		t.Fatalf("newAPIModel: %v", err)
+	}
+
+	if api.BasePath != "https://localhost/_ah/api/items/v1/" {
+		t.Errorf("BasePath = %q", api.BasePath)
+	}
+	var schemas []string
+	for _, s := range api.Schemas {
+		schemas = append(schemas, s.Name)
+	}
+	if want := []string{"Item", "ItemsList"}; !reflect.DeepEqual(schemas, want) {
+		t.Errorf("schemas = %v; want %v", schemas, want)
+	}
+
+	name := api.schema("Item").prop("name")
+	if name == nil || !name.Required || name.Desc != "Name of the item" {
+		t.Errorf("Item.name = %+v", name)
+	}
+	items := api.schema("ItemsList").prop("items")
+	if items == nil || items.Type != "array" || items.Items == nil || items.Items.Ref != "Item" {
+		t.Errorf("ItemsList.items = %+v", items)
+	}
+
+	itemState := &enumModel{Name: "ItemState", Type: "string",
+		Values: []string{"active", "done"}, Descs: []string{"Visible item", ""}}
+	if state := api.schema("Item").prop("state"); state == nil || !reflect.DeepEqual(state.Enum, itemState) {
+		t.Errorf("Item.state = %+v; want enum %+v", state, itemState)
+	}
+	listState := &enumModel{Name: "ItemsListState", Type: "string",
+		Values: []string{"active", "done"}, Descs: []string{"Visible item", ""}}
+	if want := []*enumModel{itemState, listState}; !reflect.DeepEqual(api.Enums, want) {
+		t.Errorf("Enums = %+v; want %+v", api.Enums, want)
+	}
+
+	idParams := []*paramModel{{Name: "id", Type: "int64", Required: true, InPath: true}}
+	want := []*methodModel{
+		{Name: "items.delete", HTTPMethod: "DELETE", Path: "items/{id}",
+			Params: idParams, PathParams: []string{"id"}},
+		{Name: "items.get", HTTPMethod: "GET", Path: "items/{id}",
+			Params: idParams, PathParams: []string{"id"}, Response: "Item"},
+		{Name: "items.list", HTTPMethod: "GET", Path: "items",
+			Params: []*paramModel{
+				{Name: "limit", Type: "int32"},
+				{Name: "q", Type: "string"},
+				{Name: "state", Type: "string", Enum: listState},
+			},
+			Response: "ItemsList"},
+		{Name: "items.update", HTTPMethod: "PUT", Path: "items/{id}",
+			PathParams: []string{"id"}, Request: "Item", Response: "Item"},
+	}
+	if len(api.Methods) != len(want) {
+		t.Fatalf("len(Methods) = %d; want %d", len(api.Methods), len(want))
+	}
+	for i, m := range api.Methods {
+		if !reflect.DeepEqual(m, want[i]) {
+			t.Errorf("Methods[%d] = %+v; want %+v", i, m, want[i])
+		}
+	}
+}
+
+func TestNewAPIModelErrors(t *testing.T) {
+	d := createItemsDescriptor(t)
+	d.Methods["items.items.update"].Path = "items/{key}"
+	if _, err := newAPIModel(d); err == nil {
+		t.Errorf("newAPIModel(update at items/{key}) = nil; want error")
+	}
+
+	d = createItemsDescriptor(t)
+	d.Methods["items.items.get"].Path = "items/{key}"
+	if _, err := newAPIModel(d); err == nil {
+		t.Errorf("newAPIModel(get at items/{key}) = nil; want error")
+	}
+
+	d = createItemsDescriptor(t)
+	d.Name = ""
+	if _, err := newAPIModel(d); err == nil {
+		t.Errorf("newAPIModel(no name) = nil; want error")
+	}
+}
+
+func TestPathParams(t *testing.T) {
+	tts := []struct {
+		path string
+		want []string
+	}{
+		{"items", nil},
+		{"items/{id}", []string{"id"}},
+		{"{a}/b/{c}:d", []string{"a", "c"}},
+		{"items/{id", nil},
+	}
+	for _, tt := range tts {
+		if got := pathParams(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pathParams(%q) = %v; want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// generateTS writes a TypeScript client module of api to w. The module
+// uses the fetch API, available in browsers and Node.js 18 or later.
+func generateTS(w io.Writer, api *apiModel) error {
+	reserved := map[string]string{
+		"Service":        "client class",
+		"ServiceOptions": "options interface",
+		"APIError":       "error class",
+		"FieldViolation": "error interface",
+		"BASE_PATH":      "constant",
+	}
+	if err := checkNames(api, reserved); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tsTemplate.Execute(&buf, api); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// tsName converts a method name to a TypeScript method name, e.g.
+// "items.get" to "itemsGet".
+func tsName(s string) string {
+	name := goName(s)
+	i := 1
+	for i < len(name) && 'A' <= name[i] && name[i] <= 'Z' &&
+		(i+1 == len(name) || 'A' <= name[i+1] && name[i+1] <= 'Z') {
+		i++
+	}
+	return strings.ToLower(name[:i]) + name[i:]
+}
+
+// tsIdent matches names which don't need to be quoted as property names.
+var tsIdent = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// tsProp returns a property name of an interface, quoted if necessary.
+func tsProp(name string) string {
+	if tsIdent.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf("%q", name)
+}
+
+// tsField returns an expression accessing property name of x.
+func tsField(x, name string) string {
+	if tsIdent.MatchString(name) {
+		return x + "." + name
+	}
+	return fmt.Sprintf("%s[%q]", x, name)
+}
+
+// tsOptional returns "?" unless a property or parameter is required.
+func tsOptional(required bool) string {
+	if required {
+		return ""
+	}
+	return "?"
+}
+
+// tsType returns the TypeScript type of a schema property. 64-bit
+// integers are strings, as "string" type with int64 or uint64 format
+// means, byte strings are base64 encoded and date-time is RFC 3339.
+func tsType(p *propModel) string {
+	if p.Ref != "" {
+		return goName(p.Ref)
+	}
+	if p.Enum != nil {
+		return p.Enum.Name
+	}
+	switch p.Type {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		if p.Items != nil {
+			return tsType(p.Items) + "[]"
+		}
+	case "object":
+		if p.Values != nil {
+			return "Record<string, " + tsType(p.Values) + ">"
+		}
+	}
+	return "unknown"
+}
+
+// tsParamType returns the TypeScript type of a path or query parameter.
+func tsParamType(p *paramModel) string {
+	if p.Enum != nil {
+		return p.Enum.Name
+	}
+	switch p.Type {
+	case "int32", "uint32", "float", "double":
+		return "number"
+	case "boolean":
+		return "boolean"
+	}
+	return "string"
+}
+
+// tsEnumType returns the union of values of enum type e, e.g.
+// "active" | "deleted". 64-bit integers are strings, as in tsType.
+func tsEnumType(e *enumModel) string {
+	values := make([]string, len(e.Values))
+	for i, v := range e.Values {
+		if e.Type == "string" {
+			v = fmt.Sprintf("%q", v)
+		}
+		values[i] = v
+	}
+	return strings.Join(values, " | ")
+}
+
+// tsEnumDoc returns the documentation of enum type e, listing its values
+// which have descriptions.
+func tsEnumDoc(e *enumModel) string {
+	doc := "Valid values of " + e.Name + "."
+	for i, v := range e.Values {
+		if e.Descs[i] != "" {
+			doc += fmt.Sprintf("\n- %s: %s", v, e.Descs[i])
+		}
+	}
+	return doc
+}
+
+// tsPathExpr returns an expression building the path of m, with
+// placeholders replaced by escaped properties of req.
+func tsPathExpr(m *methodModel) string {
+	var parts []string
+	path := m.Path
+	for _, name := range m.PathParams {
+		placeholder := "{" + name + "}"
+		i := strings.Index(path, placeholder)
+		if i > 0 {
+			parts = append(parts, fmt.Sprintf("%q", path[:i]))
+		}
+		parts = append(parts, "encodeURIComponent(String("+tsField("req", name)+"))")
+		path = path[i+len(placeholder):]
+	}
+	if path != "" || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%q", path))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// tsHasRequired returns true if any of params is required.
+func tsHasRequired(params []*paramModel) bool {
+	for _, p := range params {
+		if p.Required {
+			return true
+		}
+	}
+	return false
+}
+
+// tsMethodDoc returns the documentation of a client method calling m.
+func tsMethodDoc(m *methodModel) string {
+	doc := fmt.Sprintf("Calls %s method, %s %s.", m.Name, m.HTTPMethod, m.Path)
+	if m.Desc != "" {
+		doc += "\n\n" + m.Desc
+	}
+	return doc
+}
+
+// tsComment formats text as a JSDoc comment, prefixed with indent.
+func tsComment(indent, text string) string {
+	if !strings.Contains(strings.TrimSpace(text), "\n") {
+		return indent + "/** " + tsEscapeComment(strings.TrimSpace(text)) + " */"
+	}
+	return indent + "/**\n" + tsDoc(indent, text) + "\n" + indent + " */"
+}
+
+// tsDoc formats text as lines of a JSDoc comment, prefixed with indent.
+func tsDoc(indent, text string) string {
+	lines := strings.Split(tsEscapeComment(strings.TrimSpace(text)), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(indent+" * "+l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tsEscapeComment escapes the end of a comment in text.
+func tsEscapeComment(text string) string {
+	return strings.Replace(text, "*/", "*\\/", -1)
+}
+
+var tsTemplate = template.Must(template.New("ts").Funcs(template.FuncMap{
+	"comment":     tsComment,
+	"doc":         tsDoc,
+	"enumDoc":     tsEnumDoc,
+	"enumType":    tsEnumType,
+	"field":       tsField,
+	"hasRequired": tsHasRequired,
+	"method":      tsName,
+	"methodDoc":   tsMethodDoc,
+	"name":        goName,
+	"optional":    tsOptional,
+	"paramType":   tsParamType,
+	"paramsType":  goParamsType,
+	"pathExpr":    tsPathExpr,
+	"prop":        tsProp,
+	"type":        tsType,
+}).Parse(`// Code generated by endpoints-gen. DO NOT EDIT.
+
+/**
+ * Client of {{.Name}} {{.Version}} API.
+{{- with .Desc}}
+ *
+{{doc "" .}}
+{{- end}}
+ */
+
+/** Default URL of the API. */
+export const BASE_PATH = {{printf "%q" .BasePath}};
+
+/** Error response of the API. */
+export class APIError extends Error {
+  /** error_name of the response, or the HTTP status text. */
+  readonly errorName: string;
+  /** HTTP status code of the response. */
+  readonly code: number;
+  /** Fields of the request which failed validation. */
+  readonly violations: FieldViolation[];
+
+  constructor(errorName: string, message: string, code: number,
+      violations: FieldViolation[] = []) {
+    super(message);
+    this.name = "APIError";
+    this.errorName = errorName;
+    this.code = code;
+    this.violations = violations;
+    Object.setPrototypeOf(this, APIError.prototype);
+  }
+}
+
+/** Field of a request which failed validation. */
+export interface FieldViolation {
+  /** JSON path of the field, e.g. "author.name". */
+  field: string;
+  /** Violated constraint, e.g. "required" or "max". */
+  constraint: string;
+  /** Offending value, if any. */
+  value?: unknown;
+  /** Limit of the constraint, if any. */
+  limit?: unknown;
+  message: string;
+}
+{{range .Schemas}}
+{{with .Desc}}{{comment "" .}}{{else}}/** {{.Name}} schema of the API. */{{end}}
+export interface {{name .Name}} {
+{{- range .Props}}
+{{- with .Desc}}
+{{comment "  " .}}
+{{- end}}
+  {{prop .Name}}{{optional .Required}}: {{type .}};
+{{- end}}
+}
+{{end}}
+{{- range .Enums}}
+{{comment "" (enumDoc .)}}
+export type {{.Name}} = {{enumType .}};
+{{end}}
+{{- range .Methods}}{{if .Params}}
+/** Parameters of {{.Name}} method. */
+export interface {{paramsType .}} {
+{{- range .Params}}
+  {{prop .Name}}{{optional .Required}}: {{paramType .}};
+{{- end}}
+}
+{{end}}{{end}}
+/** Options of Service. */
+export interface ServiceOptions {
+  /** URL of the API, with a trailing slash, BASE_PATH by default. */
+  basePath?: string;
+  /** Function sending requests, the global fetch by default. */
+  fetch?: (input: string, init?: RequestInit) => Promise<Response>;
+  /** Headers sent with every request, e.g. Authorization. */
+  headers?: Record<string, string>;
+}
+
+/** Client of {{.Name}} {{.Version}} API. */
+export class Service {
+  /** URL of the API, with a trailing slash. */
+  basePath: string;
+  private readonly fetchFn: (input: string, init?: RequestInit) => Promise<Response>;
+  private readonly headers: Record<string, string>;
+
+  constructor(options: ServiceOptions = {}) {
+    this.basePath = options.basePath || BASE_PATH;
+    this.fetchFn = options.fetch || ((input, init) => fetch(input, init));
+    this.headers = options.headers || {};
+  }
+{{range .Methods}}
+{{comment "  " (methodDoc .)}}
+  {{method .Name}}(
+{{- if .Params}}req: {{paramsType .}}{{if not (hasRequired .Params)}} = {}{{end}}, {{else if .Request}}req: {{name .Request}}, {{end -}}
+  signal?: AbortSignal): Promise<{{with .Response}}{{name .}}{{else}}void{{end}}> {
+    const path = {{pathExpr .}};
+    const query = new URLSearchParams();
+{{- range .Params}}{{if not .InPath}}
+{{- if .Required}}
+    query.set({{printf "%q" .Name}}, String({{field "req" .Name}}));
+{{- else}}
+    if ({{field "req" .Name}} !== undefined) {
+      query.set({{printf "%q" .Name}}, String({{field "req" .Name}}));
+    }
+{{- end}}
+{{- end}}{{end}}
+    return this.call<{{with .Response}}{{name .}}{{else}}void{{end}}>({{printf "%q" .HTTPMethod}}, path, query, {{if .Request}}req{{else}}undefined{{end}}, signal);
+  }
+{{end}}
+  /**
+   * Sends a request to path, relative to basePath, with body encoded as
+   * JSON, if not undefined. It resolves to the decoded response, or
+   * rejects with APIError if the response is an error.
+   */
+  private async call<T>(method: string, path: string, query: URLSearchParams,
+      body: unknown, signal?: AbortSignal): Promise<T> {
+    let url = this.basePath + path;
+    const q = query.toString();
+    if (q) {
+      url += "?" + q;
+    }
+    const headers: Record<string, string> = { ...this.headers };
+    const init: RequestInit = { method, headers, signal };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+      init.body = JSON.stringify(body);
+    }
+
+    const res = await this.fetchFn(url, init);
+    const text = await res.text();
+    if (!res.ok) {
+      throw decodeError(res, text);
+    }
+    return (text ? JSON.parse(text) : undefined) as T;
+  }
+}
+
+/** Creates an APIError from an error response with body text. */
+function decodeError(res: Response, text: string): APIError {
+  let body: {
+    error_name?: string;
+    error_message?: string;
+    field_violations?: FieldViolation[];
+  };
+  try {
+    body = JSON.parse(text);
+  } catch (e) {
+    return new APIError(res.statusText, text, res.status);
+  }
+  return new APIError(body.error_name || res.statusText, body.error_message || "",
+      res.status, body.field_violations);
+}
+`))
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTS(t *testing.T) {
+	api, err := newAPIModel(createItemsDescriptor(t))
+	if err != nil {
+		t.Fatalf("newAPIModel: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := generateTS(&buf, api); err != nil {
+		t.Fatalf("generateTS: %v", err)
+	}
+	src := buf.String()
+
+	wants := []string{
+		"// Code generated by endpoints-gen. DO NOT EDIT.",
+		`export const BASE_PATH = "https://localhost/_ah/api/items/v1/";`,
+		"export class APIError extends Error {",
+		"export interface Item {\n  created?: string;\n  data?: string;\n  id?: string;\n" +
+			"  /** Name of the item */\n  name: string;\n  related?: string[];\n  state?: ItemState;\n  tags?: string[];\n}",
+		"/**\n * Valid values of ItemState.\n * - active: Visible item\n */\nexport type ItemState = \"active\" | \"done\";",
+		"export interface ItemsList {\n  items?: Item[];\n}",
+		"export interface ItemsGetParams {\n  id: string;\n}",
+		"export interface ItemsListParams {\n  limit?: number;\n  q?: string;\n  state?: ItemsListState;\n}",
+		"itemsGet(req: ItemsGetParams, signal?: AbortSignal): Promise<Item> {",
+		`const path = "items/" + encodeURIComponent(String(req.id));`,
+		`return this.call<Item>("GET", path, query, undefined, signal);`,
+		"itemsList(req: ItemsListParams = {}, signal?: AbortSignal): Promise<ItemsList> {",
+		"if (req.q !== undefined) {\n      query.set(\"q\", String(req.q));\n    }",
+		"itemsUpdate(req: Item, signal?: AbortSignal): Promise<Item> {",
+		`return this.call<Item>("PUT", path, query, req, signal);`,
+		"itemsDelete(req: ItemsDeleteParams, signal?: AbortSignal): Promise<void> {",
+		"body.error_name",
+		"body.error_message",
+		"body.field_violations",
+	}
+	for _, want := range wants {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("generated code:\n%s", src)
+	}
+}
+
+func TestTSName(t *testing.T) {
+	tts := []struct{ in, out string }{
+		{"items.get", "itemsGet"},
+		{"get", "get"},
+		{"api.list", "apiList"},
+		{"url", "url"},
+		{"id_list", "idList"},
+	}
+	for _, tt := range tts {
+		if out := tsName(tt.in); out != tt.out {
+			t.Errorf("tsName(%q) = %q; want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestTSType(t *testing.T) {
+	tts := []struct {
+		prop *propModel
+		typ  string
+	}{
+		{&propModel{Type: "string"}, "string"},
+		{&propModel{Type: "string", Format: "int64"}, "string"},
+		{&propModel{Type: "string", Format: "uint64"}, "string"},
+		{&propModel{Type: "integer", Format: "int32"}, "number"},
+		{&propModel{Type: "number", Format: "double"}, "number"},
+		{&propModel{Type: "boolean"}, "boolean"},
+		{&propModel{Ref: "Item"}, "Item"},
+		{&propModel{Type: "array", Items: &propModel{Ref: "Item"}}, "Item[]"},
+		{&propModel{Type: "object"}, "unknown"},
+		{&propModel{Type: "object", Values: &propModel{Type: "array", Items: &propModel{Ref: "Item"}}},
+			"Record<string, Item[]>"},
+		{&propModel{Type: "any"}, "unknown"},
+	}
+	for _, tt := range tts {
+		if typ := tsType(tt.prop); typ != tt.typ {
+			t.Errorf("tsType(%+v) = %q; want %q", tt.prop, typ, tt.typ)
+		}
+	}
+}
+
+func TestTSComment(t *testing.T) {
+	tts := []struct{ indent, text, out string }{
+		{"", "Item of a list.", "/** Item of a list. */"},
+		{"  ", "Ends with */ here", "  /** Ends with *\\/ here */"},
+		{"  ", "Lists items.\n\nAll of them.", "  /**\n   * Lists items.\n   *\n   * All of them.\n   */"},
+	}
+	for _, tt := range tts {
+		if out := tsComment(tt.indent, tt.text); out != tt.out {
+			t.Errorf("tsComment(%q, %q) = %q; want %q", tt.indent, tt.text, out, tt.out)
+		}
+	}
+}
+
+func TestTSEnumType(t *testing.T) {
+	tts := []struct {
+		enum *enumModel
+		want string
+	}{
+		{&enumModel{Type: "string", Values: []string{"a", "b"}}, `"a" | "b"`},
+		{&enumModel{Type: "integer", Format: "int32", Values: []string{"1", "2"}}, "1 | 2"},
+		{&enumModel{Type: "string", Format: "int64", Values: []string{"10"}}, `"10"`},
+	}
+	for _, tt := range tts {
+		if got := tsEnumType(tt.enum); got != tt.want {
+			t.Errorf("tsEnumType(%+v) = %s; want %s", tt.enum, got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package endpoints
 
 import (
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,6 +37,7 @@ type APIDescriptor struct {
 	Auth  *struct {
 		AllowCookie bool `json:"allowCookieAuth"`
 	} `json:"auth,omitempty"`
+	Issuers map[string]*Issuer `json:"issuers,omitempty"`
 
 	// $METHOD_MAP
 	Methods map[string]*APIMethod `json:"methods"`
@@ -56,6 +60,7 @@ type APIMethod struct {
 	Scopes    []string `json:"scopes,omitempty"`
 	Audiences []string `json:"audiences,omitempty"`
 	ClientIds []string `json:"clientIds,omitempty"`
+	Issuers   []string `json:"issuers,omitempty"`
 	Desc      string   `json:"description,omitempty"`
 }
 
@@ -77,10 +82,11 @@ type APIRequestParamSpec struct {
 	// only for int32/int64/uint32/uint64
 	Min interface{} `json:"minValue,omitempty"`
 	Max interface{} `json:"maxValue,omitempty"`
+	// only for strings
+	Pattern string `json:"pattern,omitempty"`
 }
 
 // APIEnumParamSpec is the enum type of request/response param spec.
-// Not used currently.
 type APIEnumParamSpec struct {
 	BackendVal string `json:"backendValue"`
 	Desc       string `json:"description,omitempty"`
@@ -106,6 +112,10 @@ type APISchemaDescriptor struct {
 	Type       string                        `json:"type"`
 	Properties map[string]*APISchemaProperty `json:"properties"`
 	Desc       string                        `json:"description,omitempty"`
+
+	// typ is the type described by the schema, used to detect types with
+	// the same schema name.
+	typ reflect.Type
 }
 
 // APISchemaProperty is an item of APISchemaDescriptor.Properties map
@@ -116,6 +126,21 @@ type APISchemaProperty struct {
 
 	Required bool        `json:"required,omitempty"`
 	Default  interface{} `json:"default,omitempty"`
+	// only for integer types
+	Min interface{} `json:"minimum,omitempty"`
+	Max interface{} `json:"maximum,omitempty"`
+	// only for strings
+	Pattern   string `json:"pattern,omitempty"`
+	MinLength int    `json:"minLength,omitempty"`
+	MaxLength int    `json:"maxLength,omitempty"`
+	// only for arrays
+	MinItems int `json:"minItems,omitempty"`
+	MaxItems int `json:"maxItems,omitempty"`
+	// only for strings, numbers and booleans
+	Enum      []string `json:"enum,omitempty"`
+	EnumDescs []string `json:"enumDescriptions,omitempty"`
+	// only for objects, describes their values
+	AdditionalProperties *APISchemaProperty `json:"additionalProperties,omitempty"`
 
 	Ref  string `json:"$ref,omitempty"`
 	Desc string `json:"description,omitempty"`
@@ -144,11 +169,21 @@ func (s *RPCService) APIDescriptor(dst *APIDescriptor, host string) error {
 	dst.Version = s.Info().Version
 	dst.Default = s.Info().Default
 	dst.Desc = s.Info().Description
+	dst.Issuers = nil
+	for name, iss := range s.Info().Issuers {
+		if iss == nil || iss.Issuer == "" || iss.JWKSURI == "" {
+			return fmt.Errorf("Issuer %q needs an issuer and a JWKS URI", name)
+		}
+		if dst.Issuers == nil {
+			dst.Issuers = make(map[string]*Issuer)
+		}
+		dst.Issuers[name] = iss
+	}
 
 	dst.Adapter.Bns = fmt.Sprintf("https://%s/_ah/spi", host)
 	dst.Adapter.Type = "lily"
 
-	schemasToCreate := make(map[string]reflect.Type, 0)
+	schemasToCreate := make(schemaTypes)
 	methods := s.Methods()
 	numMethods := len(methods)
 
@@ -172,12 +207,16 @@ func (s *RPCService) APIDescriptor(dst *APIDescriptor, host string) error {
 		if !info.isBodiless() && !isEmptyStruct(m.ReqType) {
 			refID := schemaNameForType(m.ReqType)
 			mdescr.Request = &APISchemaRef{Ref: refID}
-			schemasToCreate[refID] = m.ReqType
+			if err := schemasToCreate.add(refID, m.ReqType); err != nil {
+				return err
+			}
 		}
 		if !isEmptyStruct(m.RespType) {
 			refID := schemaNameForType(m.RespType)
 			mdescr.Response = &APISchemaRef{Ref: refID}
-			schemasToCreate[refID] = m.RespType
+			if err := schemasToCreate.add(refID, m.RespType); err != nil {
+				return err
+			}
 		}
 
 		// $METHOD_MAP
@@ -185,6 +224,9 @@ func (s *RPCService) APIDescriptor(dst *APIDescriptor, host string) error {
 		if err != nil {
 			return err
 		}
+		if apimeth.Issuers, err = trustedIssuers(s.Info(), info); err != nil {
+			return err
+		}
 		mname := dst.Name + "." + info.Name
 		if m, ok := dst.Methods[mname]; ok {
 			return fmt.Errorf("Method %q already exists as %q", mname, m.RosyMethod)
@@ -237,9 +279,12 @@ func (md *APIMethodDescriptor) toAPIMethod(rosySrv string) (*APIMethod, error) {
 }
 
 // addSchemaFromType creates a new APISchemaDescriptor from given Type t
-// and adds it to the map with the key of provided ref arg.
+// and adds it to the map with the key of provided ref arg, along with
+// schemas of struct types it refers to. Self-referential types, e.g. trees,
+// refer to their own schema.
 //
-// Returns an error if APISchemaDescriptor cannot be created from this Type.
+// Returns an error if APISchemaDescriptor cannot be created from this Type,
+// or if ref is already the name of a schema of another type.
 func addSchemaFromType(dst map[string]*APISchemaDescriptor, ref string, t reflect.Type) error {
 	if ref == "" {
 		ref = t.Name()
@@ -247,83 +292,76 @@ func addSchemaFromType(dst map[string]*APISchemaDescriptor, ref string, t reflec
 	if ref == "" {
 		return fmt.Errorf("Creating schema from unnamed type is currently not supported: %v", t)
 	}
-	if _, exists := dst[ref]; exists {
+	if sd, exists := dst[ref]; exists {
+		if sd.typ != nil && sd.typ != t {
+			return schemaCollisionError(ref, sd.typ, t)
+		}
 		return nil
 	}
 
-	ensureSchemas := make(map[string]reflect.Type)
-	sd := &APISchemaDescriptor{ID: ref}
+	ensureSchemas := make(schemaTypes)
+	sd := &APISchemaDescriptor{ID: ref, typ: t}
 
 	switch t.Kind() {
-	// case reflect.Array:
-	// 	sd.Type = "array"
-	// 	sd.Items... ?
 	case reflect.Struct:
 		fieldsMap := fieldNames(t, false)
 		sd.Properties = make(map[string]*APISchemaProperty, len(fieldsMap))
 		sd.Type = "object"
 		for name, field := range fieldsMap {
-			fkind := field.Type.Kind()
-			prop := &APISchemaProperty{}
-
-			// TODO(alex): add support for reflect.Map?
-			switch {
-			default:
-				prop.Type, prop.Format = typeToPropFormat(field.Type)
-
-			case implements(field.Type, typeOfJSONMarshaler):
-				prop.Type = "string"
-
-			case fkind == reflect.Ptr, fkind == reflect.Struct:
-				typ := indirectType(field.Type)
-				if stype, format := typeToPropFormat(typ); stype != "" {
-					// pointer to a basic type.
-					prop.Type, prop.Format = stype, format
-				} else {
-					switch {
-					case typ == typeOfTime:
-						prop.Type, prop.Format = "string", "date-time"
-
-					case typ.Kind() == reflect.Struct:
-						prop.Ref = schemaNameForType(typ)
-						ensureSchemas[prop.Ref] = typ
-					default:
-						return fmt.Errorf(
-							"Unsupported type %#v of property %s.%s",
-							field.Type, sd.ID, name)
-					}
-				}
-
-			case fkind == reflect.Slice:
-				if field.Type == typeOfBytes {
-					prop.Type, prop.Format = "string", "byte"
-					break
-				}
-				prop.Type = "array"
-				prop.Items = &APISchemaProperty{}
-				el := field.Type.Elem()
-				if el.Kind() == reflect.Ptr {
-					el = el.Elem()
-				}
-				k := el.Kind()
-				// TODO(alex): Add support for reflect.Map?
-				if k == reflect.Struct {
-					prop.Items.Ref = schemaNameForType(el)
-					ensureSchemas[prop.Items.Ref] = el
-				} else {
-					prop.Items.Type, prop.Items.Format = typeToPropFormat(el)
-				}
+			prop, err := typeToProp(field.Type, ensureSchemas, nil)
+			if err != nil {
+				return fmt.Errorf("%v of property %s.%s", err, sd.ID, name)
 			}
 
 			tag, err := parseTag(field.Tag)
 			if err != nil {
 				return err
 			}
-			prop.Required = tag.required
-			prop.Desc = tag.desc
-			prop.Default, err = parseValue(tag.defaultVal, field.Type.Kind())
-			if err != nil {
-				return err
+			if err := tag.checkType(field.Type); err != nil {
+				return fmt.Errorf("Tag error on property %s.%s: %v", sd.ID, name, err)
+			}
+			// Tag options which are set override the property, which may
+			// come from the schema of a custom type.
+			if tag.required {
+				prop.Required = true
+			}
+			if tag.desc != "" {
+				prop.Desc = tag.desc
+			}
+			if tag.pattern != "" {
+				prop.Pattern = tag.pattern
+			}
+			if len(tag.enum) > 0 {
+				prop.Enum, prop.EnumDescs = tag.enum, nil
+			}
+			if tag.minLength >= 0 {
+				prop.MinLength = tag.minLength
+			}
+			if tag.maxLength >= 0 {
+				prop.MaxLength = tag.maxLength
+			}
+			if tag.minItems >= 0 {
+				prop.MinItems = tag.minItems
+			}
+			if tag.maxItems >= 0 {
+				prop.MaxItems = tag.maxItems
+			}
+			if tag.defaultVal != "" {
+				if prop.Default, err = parseValue(tag.defaultVal, field.Type.Kind()); err != nil {
+					return err
+				}
+			}
+			if k := indirectKind(field.Type); reflect.Int <= k && k <= reflect.Uint64 {
+				if tag.minVal != "" {
+					if prop.Min, err = parseValue(tag.minVal, k); err != nil {
+						return err
+					}
+				}
+				if tag.maxVal != "" {
+					if prop.Max, err = parseValue(tag.maxVal, k); err != nil {
+						return err
+					}
+				}
 			}
 
 			sd.Properties[name] = prop
@@ -341,6 +379,199 @@ func addSchemaFromType(dst map[string]*APISchemaDescriptor, ref string, t reflec
 	return nil
 }
 
+// checkSchemas reports a schema name used by more than one type among
+// request and response types of services, and the types they refer to.
+// The services are expected to be the services of one API, whose schemas
+// are merged by name in discovery documents.
+//
+// Other errors, e.g. types which cannot be described, are left to
+// APIDescriptor, so that they do not prevent services from being
+// registered.
+func checkSchemas(services []*RPCService) error {
+	types := make(schemaTypes)
+	for _, s := range services {
+		for _, m := range s.Methods() {
+			if m.Info() != nil && !m.Info().isBodiless() && !isEmptyStruct(m.ReqType) {
+				if err := types.collect(schemaNameForType(m.ReqType), m.ReqType); err != nil {
+					return err
+				}
+			}
+			if !isEmptyStruct(m.RespType) {
+				if err := types.collect(schemaNameForType(m.RespType), m.RespType); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTypes maps schema names to the types they describe.
+type schemaTypes map[string]reflect.Type
+
+// add adds type t with schema name ref. It returns an error if ref is
+// already the name of another type.
+func (st schemaTypes) add(ref string, t reflect.Type) error {
+	if prev, exists := st[ref]; exists && prev != t {
+		return schemaCollisionError(ref, prev, t)
+	}
+	st[ref] = t
+	return nil
+}
+
+// addSchemas adds the types of schemas, e.g. schemas of an APIDescriptor,
+// to st. It returns an error if a schema name is already the name of
+// another type, so that documents merging schemas of several services do
+// not silently replace one of them.
+func (st schemaTypes) addSchemas(schemas map[string]*APISchemaDescriptor) error {
+	for ref, sd := range schemas {
+		if err := st.add(ref, sd.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect adds type t with schema name ref to st, along with the struct
+// types it refers to, the same way addSchemaFromType does. Only schema name
+// collisions are reported, properties which cannot be described are
+// skipped.
+func (st schemaTypes) collect(ref string, t reflect.Type) error {
+	if ref == "" {
+		return nil
+	}
+	if prev, exists := st[ref]; exists {
+		if prev != t {
+			return schemaCollisionError(ref, prev, t)
+		}
+		return nil
+	}
+	st[ref] = t
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	nested := make(schemaTypes)
+	for _, field := range fieldNames(t, false) {
+		if _, err := typeToProp(field.Type, nested, nil); err != nil {
+			if _, ok := err.(*schemaCollision); ok {
+				return err
+			}
+		}
+	}
+	for ref, t := range nested {
+		if err := st.collect(ref, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaCollision is the error of types with the same schema name.
+type schemaCollision struct {
+	ref    string
+	t1, t2 reflect.Type
+}
+
+func (e *schemaCollision) Error() string {
+	names := []string{qualifiedTypeName(e.t1), qualifiedTypeName(e.t2)}
+	sort.Strings(names)
+	return fmt.Sprintf("Schema name %q is used by both %s and %s, "+
+		"rename one of them or override SchemaNameForType",
+		e.ref, names[0], names[1])
+}
+
+// schemaCollisionError returns an error reporting that types t1 and t2
+// have the same schema name.
+func schemaCollisionError(ref string, t1, t2 reflect.Type) error {
+	return &schemaCollision{ref, t1, t2}
+}
+
+// qualifiedTypeName returns the name of type t with its full package path,
+// e.g. "github.com/user/app/model.Item".
+func qualifiedTypeName(t reflect.Type) string {
+	if t.PkgPath() == "" {
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// typeToProp creates an APISchemaProperty describing JSON values of type t.
+// Slices and arrays are "array" properties, maps are "object" properties
+// with additionalProperties describing their values, and interface{} and
+// json.RawMessage are "any". Struct types are referenced and added to
+// ensureSchemas, seen are the types t is nested in, to detect recursive
+// types other than structs.
+func typeToProp(t reflect.Type, ensureSchemas schemaTypes, seen map[reflect.Type]bool) (
+	*APISchemaProperty, error) {
+
+	if seen[t] {
+		return nil, fmt.Errorf("Unsupported recursive type %v", t)
+	}
+	if prop, ok := customSchema(t); ok {
+		return prop, nil
+	}
+	prop := &APISchemaProperty{}
+	switch k := t.Kind(); {
+	case t == typeOfRawMessage, k == reflect.Interface:
+		prop.Type = "any"
+		return prop, nil
+	case t == typeOfTime:
+		prop.Type, prop.Format = "string", "date-time"
+		return prop, nil
+	case k != reflect.Ptr && reflect.PtrTo(t).Implements(typeOfJSONMarshaler):
+		prop.Type = "string"
+		return prop, nil
+	case t == typeOfBytes:
+		prop.Type, prop.Format = "string", "byte"
+		return prop, nil
+	case k == reflect.Struct:
+		prop.Ref = schemaNameForType(t)
+		if err := ensureSchemas.add(prop.Ref, t); err != nil {
+			return nil, err
+		}
+		return prop, nil
+	case k == reflect.Map && !isMapKeyType(t.Key()):
+		return nil, fmt.Errorf("Unsupported map key type %v", t.Key())
+	case k != reflect.Ptr && k != reflect.Slice && k != reflect.Array && k != reflect.Map:
+		prop.Type, prop.Format = typeToPropFormat(t)
+		if prop.Type == "" {
+			return nil, fmt.Errorf("Unsupported type %v", t)
+		}
+		prop.Enum, prop.EnumDescs = enumValues(typeEnum(t))
+		return prop, nil
+	}
+
+	if seen == nil {
+		seen = make(map[reflect.Type]bool)
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	elem, err := typeToProp(t.Elem(), ensureSchemas, seen)
+	if err != nil {
+		return nil, err
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return elem, nil
+	case reflect.Map:
+		prop.Type, prop.AdditionalProperties = "object", elem
+	default:
+		prop.Type, prop.Items = "array", elem
+	}
+	return prop, nil
+}
+
+// isMapKeyType returns true if maps with keys of type t are encoded as JSON
+// objects, i.e. t is a string, an integer or implements
+// encoding.TextMarshaler.
+func isMapKeyType(t reflect.Type) bool {
+	switch k := t.Kind(); {
+	case k == reflect.String, reflect.Int <= k && k <= reflect.Uintptr:
+		return true
+	}
+	return t.Implements(typeOfTextMarshaler)
+}
+
 // setAPIReqRespBody populates APIReqRespDescriptor with correct values based
 // on provided arguments.
 //
@@ -379,12 +610,15 @@ var (
 	typeOfTime          = reflect.TypeOf(time.Time{})
 	typeOfBytes         = reflect.TypeOf([]byte(nil))
 	typeOfJSONMarshaler = reflect.TypeOf((*jsonMarshaler)(nil)).Elem()
+	typeOfTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	typeOfRawMessage    = reflect.TypeOf(json.RawMessage(nil))
 
 	// SchemaNameForType returns a name for the given schema type,
 	// used to reference schema definitions in the API descriptor.
 	//
 	// Default is to return just the type name, which does not guarantee
 	// uniqueness if you have identically named structs in different packages.
+	// Such types are reported as an error by RegisterService.
 	//
 	// You can override this function, for instance to prefix all of your schemas
 	// with a custom name. It should start from an uppercase letter and contain
@@ -396,8 +630,130 @@ var (
 	// Make sure user-supplied version of SchemaNameForType contains only
 	// allowed characters. The rest will be removed.
 	reSchemaName = regexp.MustCompile("[^a-zA-Z0-9]")
+
+	// Package paths of type arguments in names of instantiated generic
+	// types, e.g. "github.com/user/app/model." in
+	// "Page[github.com/user/app/model.Item]".
+	reTypeArgPkg = regexp.MustCompile(`[^\[\],*\s]*\.`)
+)
+
+// SchemaProvider is implemented by types which describe their own JSON
+// representation in API descriptors, e.g. types implementing json.Marshaler
+// which are not encoded as JSON strings. Types without a schema of their own
+// are described by their Go type, or as strings if they implement both
+// json.Marshaler and json.Unmarshaler.
+//
+// EndpointsSchema is called on a zero value of the type. Required, Desc and
+// constraints of the tag of a field are applied on top of the schema.
+type SchemaProvider interface {
+	EndpointsSchema() APISchemaProperty
+}
+
+var (
+	typeOfSchemaProvider = reflect.TypeOf((*SchemaProvider)(nil)).Elem()
+
+	typeSchemasMu sync.RWMutex
+	typeSchemas   = make(map[reflect.Type]APISchemaProperty)
+)
+
+// RegisterTypeSchema sets the schema used to describe values of type t in
+// API descriptors, for types which can't implement SchemaProvider, e.g.
+// types of other packages. It takes precedence over SchemaProvider and
+// should be called before services using t are registered, typically from
+// an init function.
+func RegisterTypeSchema(t reflect.Type, schema APISchemaProperty) {
+	typeSchemasMu.Lock()
+	defer typeSchemasMu.Unlock()
+	typeSchemas[t] = schema
+}
+
+// customSchema returns the schema of type t set with RegisterTypeSchema or
+// provided by the type itself, see SchemaProvider.
+func customSchema(t reflect.Type) (*APISchemaProperty, bool) {
+	typeSchemasMu.RLock()
+	schema, ok := typeSchemas[t]
+	typeSchemasMu.RUnlock()
+	if ok {
+		return &schema, true
+	}
+
+	switch {
+	case t.Kind() != reflect.Ptr && t.Implements(typeOfSchemaProvider):
+		schema = reflect.Zero(t).Interface().(SchemaProvider).EndpointsSchema()
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(typeOfSchemaProvider):
+		schema = reflect.New(t).Interface().(SchemaProvider).EndpointsSchema()
+	default:
+		return nil, false
+	}
+	return &schema, true
+}
+
+// EnumValue is a valid value of an enumeration type, see EnumProvider.
+type EnumValue struct {
+	// Value is the value as it appears in tags, e.g. "active" or "1".
+	Value string
+	Desc  string
+}
+
+// EnumProvider is implemented by string, number or boolean types with
+// a fixed set of valid values, e.g. named string types with constants.
+// The values are listed in API descriptors and other values of the type
+// are rejected in requests. EndpointsEnum is called on a zero value of the
+// type.
+type EnumProvider interface {
+	EndpointsEnum() []EnumValue
+}
+
+var (
+	typeOfEnumProvider = reflect.TypeOf((*EnumProvider)(nil)).Elem()
+
+	typeEnumsMu sync.RWMutex
+	typeEnums   = make(map[reflect.Type][]EnumValue)
 )
 
+// RegisterEnum sets valid values of type t, a string, number or boolean
+// type, for types which can't implement EnumProvider. It takes precedence
+// over EnumProvider and should be called before services using t are
+// registered, typically from an init function.
+func RegisterEnum(t reflect.Type, values ...EnumValue) {
+	if typ, _ := typeToPropFormat(t); typ == "" {
+		panic(fmt.Sprintf("endpoints: RegisterEnum: %v is not a string, number or boolean type", t))
+	}
+	typeEnumsMu.Lock()
+	defer typeEnumsMu.Unlock()
+	typeEnums[t] = values
+}
+
+// typeEnum returns valid values of type t set with RegisterEnum or
+// provided by the type itself, see EnumProvider, or nil if values of t
+// are not restricted.
+func typeEnum(t reflect.Type) []EnumValue {
+	if typ, _ := typeToPropFormat(t); typ == "" {
+		return nil
+	}
+	typeEnumsMu.RLock()
+	values, ok := typeEnums[t]
+	typeEnumsMu.RUnlock()
+	switch {
+	case ok:
+		return values
+	case t.Implements(typeOfEnumProvider):
+		return reflect.Zero(t).Interface().(EnumProvider).EndpointsEnum()
+	case reflect.PtrTo(t).Implements(typeOfEnumProvider):
+		return reflect.New(t).Interface().(EnumProvider).EndpointsEnum()
+	}
+	return nil
+}
+
+// enumValues returns values of enum and their descriptions.
+func enumValues(enum []EnumValue) (values, descs []string) {
+	for _, v := range enum {
+		values = append(values, v.Value)
+		descs = append(descs, v.Desc)
+	}
+	return
+}
+
 // indirectType returns a type the t is pointing to or a type of the element
 // of t if t is either Array, Chan, Map or Slice.
 func indirectType(t reflect.Type) reflect.Type {
@@ -453,6 +809,35 @@ func typeToPropFormat(t reflect.Type) (string, string) {
 	return "", ""
 }
 
+// propFormatToParamType converts a pair of (type, format) of a schema
+// property into APIRequestParamSpec type. It returns "" if values of the
+// type can't be a parameter, e.g. objects and arrays.
+func propFormatToParamType(typ, format string) string {
+	switch typ {
+	case "integer":
+		if format == "uint32" {
+			return "uint32"
+		}
+		return "int32"
+	case "number":
+		if format == "float" {
+			return "float"
+		}
+		return "double"
+	case "string":
+		switch format {
+		case "int64", "uint64":
+			return format
+		case "byte":
+			return "bytes"
+		}
+		return "string"
+	case "boolean":
+		return "boolean"
+	}
+	return ""
+}
+
 // typeToParamsSpec creates a new APIRequestParamSpec map from a Type for all
 // fields in t.
 //
@@ -528,7 +913,14 @@ func fieldToParamSpec(field *reflect.StructField) (p *APIRequestParamSpec, err e
 		kind = indirectType(field.Type).Kind()
 
 	}
+	schema, custom := customSchema(indirectType(field.Type))
 	switch {
+	case custom:
+		p.Type = propFormatToParamType(schema.Type, schema.Format)
+		if p.Type == "" {
+			return nil, fmt.Errorf("Unsupported field: %#v", field)
+		}
+		p.Pattern = schema.Pattern
 	case reflect.Int <= kind && kind <= reflect.Int32:
 		p.Type = "int32"
 	case kind == reflect.Int64:
@@ -555,8 +947,25 @@ func fieldToParamSpec(field *reflect.StructField) (p *APIRequestParamSpec, err e
 	if tag, err = parseTag(field.Tag); err != nil {
 		return nil, fmt.Errorf("Tag error on %#v: %s", field, err)
 	}
+	if err = tag.checkType(field.Type); err != nil {
+		return nil, fmt.Errorf("Tag error on %#v: %s", field, err)
+	}
 
 	p.Required = tag.required
+	if tag.pattern != "" {
+		p.Pattern = tag.pattern
+	}
+	if len(tag.enum) > 0 {
+		p.Enum = make(map[string]*APIEnumParamSpec, len(tag.enum))
+		for _, val := range tag.enum {
+			p.Enum[val] = &APIEnumParamSpec{BackendVal: val}
+		}
+	} else if enum := typeEnum(indirectType(field.Type)); len(enum) > 0 {
+		p.Enum = make(map[string]*APIEnumParamSpec, len(enum))
+		for _, val := range enum {
+			p.Enum[val.Value] = &APIEnumParamSpec{BackendVal: val.Value, Desc: val.Desc}
+		}
+	}
 	if p.Default, err = parseValue(tag.defaultVal, kind); err != nil {
 		return
 	}
@@ -578,9 +987,17 @@ func fieldToParamSpec(field *reflect.StructField) (p *APIRequestParamSpec, err e
 // It expands (flattens) nexted structs if flatten == true, and always skips
 // unexported fields or thosed tagged with json:"-"
 //
+// Fields of struct types which are being flattened, e.g. the children of
+// a tree, are skipped.
+//
 // This method accepts only reflect.Struct type. Passing other types will
 // most likely make it panic.
 func fieldNames(t reflect.Type, flatten bool) map[string]*reflect.StructField {
+	return fieldNamesOf(t, flatten, map[reflect.Type]bool{t: true})
+}
+
+// fieldNamesOf is fieldNames, with struct types being flattened in seen.
+func fieldNamesOf(t reflect.Type, flatten bool, seen map[reflect.Type]bool) map[string]*reflect.StructField {
 	numField := t.NumField()
 	m := make(map[string]*reflect.StructField, numField)
 
@@ -599,18 +1016,25 @@ func fieldNames(t reflect.Type, flatten bool) map[string]*reflect.StructField {
 		}
 
 		if f.Type.Kind() == reflect.Struct && f.Anonymous {
-			for nname, nfield := range fieldNames(f.Type, flatten) {
+			for nname, nfield := range fieldNamesOf(f.Type, flatten, seen) {
 				m[nname] = nfield
 			}
 			continue
 		}
 
-		if flatten && indirectKind(f.Type) == reflect.Struct &&
+		nested := indirectType(f.Type)
+		_, custom := customSchema(nested)
+		if flatten && nested.Kind() == reflect.Struct && !custom &&
 			!implements(f.Type, typeOfJSONMarshaler) {
 
-			for nname, nfield := range fieldNames(indirectType(f.Type), true) {
+			if seen[nested] {
+				continue
+			}
+			seen[nested] = true
+			for nname, nfield := range fieldNamesOf(nested, true, seen) {
 				m[name+"."+nname] = nfield
 			}
+			delete(seen, nested)
 			continue
 		}
 
@@ -623,7 +1047,18 @@ func fieldNames(t reflect.Type, flatten bool) map[string]*reflect.StructField {
 // schemaNameForType always returns a title version of the public method
 // SchemaNameForType.
 func schemaNameForType(t reflect.Type) string {
-	name := strings.Title(SchemaNameForType(t))
+	return schemaName(SchemaNameForType(t))
+}
+
+// schemaName converts a type name to a schema name. Package paths of type
+// arguments of generic types are removed and the arguments are appended
+// to the name, e.g. "Page[github.com/user/app/model.Item]" becomes
+// "PageItem".
+func schemaName(name string) string {
+	if strings.Contains(name, "[") {
+		name = reTypeArgPkg.ReplaceAllLiteralString(name, "")
+	}
+	name = strings.Title(name)
 	return reSchemaName.ReplaceAllLiteralString(name, "")
 }
 
@@ -631,60 +1066,263 @@ func schemaNameForType(t reflect.Type) string {
 // Parse
 
 type endpointsTag struct {
-	required                   bool
+	required bool
+	// path marks a path parameter of the inferred route of a method.
+	path                       bool
 	defaultVal, minVal, maxVal string
 	desc                       string
+	// pattern is a regular expression matching valid strings.
+	pattern string
+	// minLength, maxLength, minItems and maxItems are -1 if not set.
+	minLength, maxLength int
+	minItems, maxItems   int
+	// enum lists valid values.
+	enum []string
 }
 
 const endpointsTagName = "endpoints"
 
+// tagKeys maps keys of "endpoints" tag options to whether they take
+// a value. "required" is an alias of "req".
+var tagKeys = map[string]bool{
+	"req":       false,
+	"path":      false,
+	"d":         true,
+	"min":       true,
+	"max":       true,
+	"desc":      true,
+	"pattern":   true,
+	"minLength": true,
+	"maxLength": true,
+	"minItems":  true,
+	"maxItems":  true,
+	"enum":      true,
+}
+
 // parseTag parses "endpoints" field tag into endpointsTag struct.
 //
 //   type MyMessage struct {
-//       SomeField int `endpoints:"req,min=0,max=100,desc="Int field"`
+//       SomeField int `endpoints:"req,min=0,max=100,desc='Int field, 0 to 100'"`
 //       WithDefault string `endpoints:"d=Hello gopher"`
 //   }
 //
-//   - req, required (boolean)
+//   - req or required (boolean)
+//   - path (boolean), a path parameter of the method's inferred route
 //   - d=val, default value
 //   - min=val, min value
 //   - max=val, max value
 //   - desc=val, description
+//   - pattern=regexp, regular expression matching valid strings
+//   - minLength=n, maxLength=n, min and max length of a string, an empty
+//     string being checked only if it is pointed to
+//   - minItems=n, maxItems=n, min and max number of items of a slice or map,
+//     an empty slice or map being checked only if it is not nil
+//   - enum=a|b|c, valid values
 //
-// It is an error to specify both default and required.
+// Values are quoted as described in splitTag. It is an error to specify
+// an unknown or duplicate option, or both default and required.
 func parseTag(t reflect.StructTag) (*endpointsTag, error) {
-	eTag := &endpointsTag{}
-	if tag := t.Get("endpoints"); tag != "" {
-		parts := strings.Split(tag, ",")
-		for _, k := range parts {
-			switch k {
-			case "req":
-				eTag.required = true
-			default:
-				// key=value format
-				kv := strings.SplitN(k, "=", 2)
-				if len(kv) < 2 {
-					continue
+	eTag := &endpointsTag{minLength: -1, maxLength: -1, minItems: -1, maxItems: -1}
+	opts, err := splitTag(t.Get(endpointsTagName))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(opts))
+	for _, opt := range opts {
+		if opt.key == "required" {
+			opt.key = "req"
+		}
+		takesValue, ok := tagKeys[opt.key]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("Unknown option %q", opt.key)
+		case seen[opt.key]:
+			return nil, fmt.Errorf("Duplicate option %q", opt.key)
+		case takesValue && !opt.hasValue:
+			return nil, fmt.Errorf("Option %q requires a value", opt.key)
+		case !takesValue && opt.hasValue:
+			return nil, fmt.Errorf("Option %q doesn't take a value", opt.key)
+		}
+		seen[opt.key] = true
+
+		switch opt.key {
+		case "req":
+			eTag.required = true
+		case "path":
+			eTag.path = true
+		case "d":
+			eTag.defaultVal = opt.value
+		case "min":
+			eTag.minVal = opt.value
+		case "max":
+			eTag.maxVal = opt.value
+		case "desc":
+			eTag.desc = opt.value
+		case "pattern":
+			if _, err := regexp.Compile(opt.value); err != nil {
+				return nil, fmt.Errorf("Invalid pattern %q: %v", opt.value, err)
+			}
+			eTag.pattern = opt.value
+		case "minLength", "maxLength", "minItems", "maxItems":
+			n, err := strconv.Atoi(opt.value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("Invalid %s %q", opt.key, opt.value)
+			}
+			switch opt.key {
+			case "minLength":
+				eTag.minLength = n
+			case "maxLength":
+				eTag.maxLength = n
+			case "minItems":
+				eTag.minItems = n
+			case "maxItems":
+				eTag.maxItems = n
+			}
+		case "enum":
+			eTag.enum = strings.Split(opt.value, "|")
+		}
+	}
+	if eTag.required && eTag.defaultVal != "" {
+		return nil, fmt.Errorf(
+			"Can't have both required and default (%#v)",
+			eTag.defaultVal)
+	}
+	return eTag, nil
+}
+
+// tagOption is a "key" or "key=value" option of an "endpoints" tag.
+type tagOption struct {
+	key, value string
+	hasValue   bool
+}
+
+// splitTag splits an "endpoints" tag into comma separated options.
+//
+// A value can be quoted with single or double quotes, so that it can
+// contain commas, e.g. desc='Name, as shown to users'. Inside quotes
+// a backslash escapes the quote or another backslash and is kept as is
+// otherwise, so that a pattern like '^\d+$' needs no further escaping. Double
+// quotes must be escaped in the struct tag itself, e.g.
+// `endpoints:"desc=\"Name, as shown\""`.
+func splitTag(tag string) ([]tagOption, error) {
+	var opts []tagOption
+	for tag != "" {
+		var opt tagOption
+		end := strings.IndexAny(tag, "=,")
+		if end < 0 {
+			end = len(tag)
+		}
+		opt.key, tag = tag[:end], tag[end:]
+		if opt.key == "" {
+			return nil, fmt.Errorf("Empty option")
+		}
+
+		if strings.HasPrefix(tag, "=") {
+			opt.hasValue = true
+			tag = tag[1:]
+			if tag != "" && (tag[0] == '\'' || tag[0] == '"') {
+				var err error
+				if opt.value, tag, err = unquoteTagValue(tag); err != nil {
+					return nil, fmt.Errorf("Invalid value of %q: %v", opt.key, err)
 				}
-				switch kv[0] {
-				case "d":
-					eTag.defaultVal = kv[1]
-				case "min":
-					eTag.minVal = kv[1]
-				case "max":
-					eTag.maxVal = kv[1]
-				case "desc":
-					eTag.desc = kv[1]
+				if tag != "" && tag[0] != ',' {
+					return nil, fmt.Errorf("Unexpected %q after value of %q", tag, opt.key)
 				}
+			} else {
+				end = strings.IndexByte(tag, ',')
+				if end < 0 {
+					end = len(tag)
+				}
+				opt.value, tag = tag[:end], tag[end:]
 			}
 		}
-		if eTag.required && eTag.defaultVal != "" {
-			return nil, fmt.Errorf(
-				"Can't have both required and default (%#v)",
-				eTag.defaultVal)
+		opts = append(opts, opt)
+
+		if tag != "" {
+			// Skip the comma, an option must follow it.
+			tag = tag[1:]
+			if tag == "" {
+				return nil, fmt.Errorf("Empty option")
+			}
 		}
 	}
-	return eTag, nil
+	return opts, nil
+}
+
+// unquoteTagValue unquotes a value at the beginning of s, which starts
+// with a quote. It returns the value and the rest of s.
+func unquoteTagValue(s string) (string, string, error) {
+	quote := s[0]
+	var buf []byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == quote:
+			return string(buf), s[i+1:], nil
+		case c == '\\' && i+1 < len(s) && (s[i+1] == quote || s[i+1] == '\\'):
+			i++
+			buf = append(buf, s[i])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return "", "", fmt.Errorf("missing closing quote %c", quote)
+}
+
+// checkTags parses "endpoints" tags of fields of struct type t, or the
+// type it points to, and of structs nested in them. It returns the first
+// error, so that invalid tags are reported when a service is registered.
+func checkTags(t reflect.Type) error {
+	return checkTagsOf(t, make(map[reflect.Type]bool))
+}
+
+// checkTagsOf is checkTags, skipping struct types in seen.
+func checkTagsOf(t reflect.Type, seen map[reflect.Type]bool) error {
+	for k := t.Kind(); k == reflect.Ptr || k == reflect.Slice || k == reflect.Array || k == reflect.Map; k = t.Kind() {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag, err := parseTag(field.Tag)
+		if err == nil {
+			err = tag.checkType(field.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("tag of %v.%s: %v", t, field.Name, err)
+		}
+		if err := checkTagsOf(field.Type, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkType returns an error if constraints of the tag do not apply to
+// a field of type t, or the type t points to. A pattern and lengths apply
+// to strings, numbers of items to slices, arrays and maps, and enum to
+// strings, numbers and booleans.
+func (tag *endpointsTag) checkType(t reflect.Type) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	k := t.Kind()
+	if (tag.pattern != "" || tag.minLength >= 0 || tag.maxLength >= 0) && k != reflect.String {
+		return fmt.Errorf("pattern, minLength and maxLength apply only to strings, not %v", t)
+	}
+	if (tag.minItems >= 0 || tag.maxItems >= 0) &&
+		k != reflect.Slice && k != reflect.Array && k != reflect.Map {
+		return fmt.Errorf("minItems and maxItems apply only to slices, arrays and maps, not %v", t)
+	}
+	if typ, _ := typeToPropFormat(t); len(tag.enum) > 0 && typ == "" {
+		return fmt.Errorf("enum applies only to strings, numbers and booleans, not %v", t)
+	}
+	return nil
 }
 
 // parsePath parses a path template and returns found placeholders.
@@ -744,108 +1382,3 @@ func parseValue(s string, k reflect.Kind) (interface{}, error) {
 
 	return nil, fmt.Errorf("parseValue: Invalid kind %#v value=%q", k, s)
 }
-
-func validateRequest(r interface{}) error {
-	v := reflect.ValueOf(r)
-	if v.Kind() != reflect.Ptr {
-		return fmt.Errorf("%T is not a pointer", r)
-	}
-	v = reflect.Indirect(v)
-	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("%T is not a pointer to a struct", r)
-	}
-
-	t := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		if err := validateField(v.Field(i), t.Field(i)); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func validateField(v reflect.Value, t reflect.StructField) error {
-	// only validate simple types, ignore arrays, slices, chans, etc.
-	if v.Kind() > reflect.Float64 && v.Kind() != reflect.String {
-		return nil
-	}
-
-	tag, err := parseTag(t.Tag)
-	if err != nil {
-		return fmt.Errorf("parse tag: %v", err)
-	}
-
-	isZero := v.Interface() == reflect.Zero(v.Type()).Interface()
-	if isZero && tag.required {
-		return fmt.Errorf("missing field %v", t.Name)
-	}
-
-	if isZero && tag.defaultVal != "" {
-		r, err := parseValue(tag.defaultVal, v.Kind())
-		if err != nil {
-			return fmt.Errorf("parse default value: %v", err)
-		}
-		v.Set(reflect.ValueOf(r))
-	}
-
-	if tag.minVal != "" {
-		cmp, err := compare(v, tag.minVal)
-		if err != nil {
-			return fmt.Errorf("compare with min value: %v", err)
-		}
-		if cmp < 0 {
-			return fmt.Errorf("%v is too small", v)
-		}
-	}
-
-	if tag.maxVal != "" {
-		cmp, err := compare(v, tag.maxVal)
-		if err != nil {
-			return fmt.Errorf("compare with min value: %v", err)
-		}
-		if cmp > 0 {
-			return fmt.Errorf("%v is too big", v)
-		}
-	}
-	return nil
-}
-
-// compare parses the given text to a value of the same type of a and
-// compares them. It returns -1 if a < b, 1 if a > b, or 0 if a == b.
-func compare(a reflect.Value, text string) (int, error) {
-	val, err := parseValue(text, a.Kind())
-	if err != nil {
-		return 0, fmt.Errorf("parse min value: %v", err)
-	}
-	b := reflect.ValueOf(val)
-	cmp := 0
-	switch a.Interface().(type) {
-	case int, int8, int16, int32, int64:
-		if a, b := a.Int(), b.Int(); a < b {
-			cmp = -1
-		} else if a > b {
-			cmp = 1
-		}
-	case uint, uint8, uint16, uint32, uint64:
-		if a, b := a.Uint(), b.Uint(); a < b {
-			cmp = -1
-		} else if a > b {
-			cmp = 1
-		}
-	case float32, float64:
-		if a, b := a.Float(), b.Float(); a < b {
-			cmp = -1
-		} else if a > b {
-			cmp = 1
-		}
-	case string:
-		if a, b := a.String(), b.String(); a < b {
-			cmp = -1
-		} else if a > b {
-			cmp = 1
-		}
-	default:
-		return 0, fmt.Errorf("unsupported type %v", a.Type())
-	}
-	return cmp, nil
-}
@@ -2,10 +2,13 @@ package endpoints
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -224,6 +227,37 @@ func TestAPIPutAuthMethod(t *testing.T) {
 	)
 }
 
+func TestAPIIssuers(t *testing.T) {
+	s := createDummyServer(t).ServiceByName("DummyService")
+	corp := &Issuer{
+		Issuer:    "https://sso.example.com",
+		JWKSURI:   "https://sso.example.com/jwks",
+		Audiences: []string{"dummy-api"},
+	}
+	s.Info().Issuers = map[string]*Issuer{"corp": corp, "firebase": FirebaseIssuer("my-project")}
+	s.MethodByName("PutAuth").Info().Issuers = []string{"corp"}
+
+	d := &APIDescriptor{}
+	if err := s.APIDescriptor(d, "testhost:1234"); err != nil {
+		t.Fatalf("APIDescriptor() = %v", err)
+	}
+	verifyPairs(t,
+		d.Issuers, s.Info().Issuers,
+		d.Methods["dummy.auth"].Issuers, []string{"corp"},
+		d.Methods["dummy.post"].Issuers, []string{"corp", "firebase"},
+	)
+
+	s.MethodByName("PutAuth").Info().Issuers = []string{"google"}
+	if err := s.APIDescriptor(&APIDescriptor{}, "testhost:1234"); err == nil {
+		t.Error("APIDescriptor() = nil; want unknown issuer error")
+	}
+	s.MethodByName("PutAuth").Info().Issuers = nil
+	s.Info().Issuers["corp"] = &Issuer{Issuer: corp.Issuer}
+	if err := s.APIDescriptor(&APIDescriptor{}, "testhost:1234"); err == nil {
+		t.Error("APIDescriptor() = nil; want missing JWKS URI error")
+	}
+}
+
 func TestAPIGetSubMethod(t *testing.T) {
 	d := createDescriptor(t)
 	// apiname.resource.method
@@ -528,6 +562,527 @@ func TestDummyListMsgSchema(t *testing.T) {
 	verifySchema(t, "DummyListMsg", props)
 }
 
+func TestSchemaPropertyMinMax(t *testing.T) {
+	d := createDescriptor(t)
+	s := d.Descriptor.Schemas["DummyMsg"]
+	if s == nil {
+		t.Fatal("want DummyMsg schema")
+	}
+	verifyPairs(t,
+		s.Properties["i"].Min, -200,
+		s.Properties["i"].Max, 200,
+		s.Properties["Uint"].Min, uint32(0),
+		s.Properties["Uint"].Max, uint32(100),
+		s.Properties["Int64"].Min, nil,
+		s.Properties["str"].Max, nil,
+	)
+}
+
+type CompositeItem struct {
+	Name string `json:"name"`
+}
+
+type CompositeMsg struct {
+	ByName   map[string]*CompositeItem `json:"byName"`
+	Counts   map[int]int64             `json:"counts"`
+	Nested   map[string][]string       `json:"nested"`
+	Any      interface{}               `json:"any"`
+	Raw      json.RawMessage           `json:"raw"`
+	Attrs    map[string]interface{}    `json:"attrs"`
+	Triple   [3]float64                `json:"triple"`
+	Items    [2]CompositeItem          `json:"items"`
+	Matrix   [][]int32                 `json:"matrix"`
+	Created  *time.Time                `json:"created"`
+	Modified time.Time                 `json:"modified"`
+	Cursor   canMarshal                `json:"cursor"`
+}
+
+func TestSchemaCompositeTypes(t *testing.T) {
+	schemas := make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "", reflect.TypeOf(CompositeMsg{})); err != nil {
+		t.Fatalf("addSchemaFromType() = %v", err)
+	}
+	if schemas["CompositeItem"] == nil {
+		t.Errorf("want CompositeItem schema in %v", schemas)
+	}
+	item := &APISchemaProperty{Ref: "CompositeItem"}
+	props := schemas["CompositeMsg"].Properties
+	verifyPairs(t,
+		props["byName"], &APISchemaProperty{Type: "object", AdditionalProperties: item},
+		props["counts"], &APISchemaProperty{Type: "object",
+			AdditionalProperties: &APISchemaProperty{Type: "string", Format: "int64"}},
+		props["nested"], &APISchemaProperty{Type: "object", AdditionalProperties: &APISchemaProperty{
+			Type: "array", Items: &APISchemaProperty{Type: "string"}}},
+		props["any"], &APISchemaProperty{Type: "any"},
+		props["raw"], &APISchemaProperty{Type: "any"},
+		props["attrs"], &APISchemaProperty{Type: "object", AdditionalProperties: &APISchemaProperty{Type: "any"}},
+		props["triple"], &APISchemaProperty{Type: "array", Items: &APISchemaProperty{Type: "number", Format: "double"}},
+		props["items"], &APISchemaProperty{Type: "array", Items: item},
+		props["matrix"], &APISchemaProperty{Type: "array", Items: &APISchemaProperty{
+			Type: "array", Items: &APISchemaProperty{Type: "integer", Format: "int32"}}},
+		props["created"], &APISchemaProperty{Type: "string", Format: "date-time"},
+		props["modified"], &APISchemaProperty{Type: "string", Format: "date-time"},
+		props["cursor"], &APISchemaProperty{Type: "string"},
+	)
+
+	type list []list
+	tts := []struct {
+		typ interface{}
+		err string
+	}{
+		{struct{ C chan int }{}, "Unsupported type chan int of property Bad.C"},
+		{struct{ M map[CompositeItem]int }{}, "Unsupported map key type endpoints.CompositeItem of property Bad.M"},
+		{struct{ L list }{}, "Unsupported recursive type endpoints.list of property Bad.L"},
+		{struct{ F []func() }{}, "Unsupported type func() of property Bad.F"},
+	}
+	for i, tt := range tts {
+		err := addSchemaFromType(schemas, "Bad", reflect.TypeOf(tt.typ))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d: addSchemaFromType(%T) = %v; want %q", i, tt.typ, err, tt.err)
+		}
+	}
+}
+
+// Amount is an amount of money in cents, encoded as a JSON number of dollars.
+type Amount struct {
+	cents int64
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(float64(a.cents)/100, 'f', 2, 64)), nil
+}
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return err
+	}
+	a.cents = int64(math.Floor(f*100 + 0.5))
+	return nil
+}
+
+func (a Amount) EndpointsSchema() APISchemaProperty {
+	return APISchemaProperty{Type: "number", Format: "double", Desc: "Amount in dollars"}
+}
+
+// Point describes its schema with a pointer receiver.
+type Point struct {
+	X, Y int
+}
+
+func (p *Point) EndpointsSchema() APISchemaProperty {
+	return APISchemaProperty{Type: "array", Items: &APISchemaProperty{Type: "integer", Format: "int32"}}
+}
+
+// registeredCursor is a page cursor with a schema set by RegisterTypeSchema.
+type registeredCursor struct {
+	Offset int
+}
+
+// registeredCode is a code with a pattern set by RegisterTypeSchema.
+type registeredCode string
+
+func init() {
+	RegisterTypeSchema(reflect.TypeOf(registeredCursor{}), APISchemaProperty{Type: "string", Format: "byte"})
+	RegisterTypeSchema(reflect.TypeOf(registeredCode("")), APISchemaProperty{
+		Type: "string", Pattern: "^[A-Z]{3}$", MinLength: 3, MaxLength: 3, Default: "USD"})
+}
+
+type CustomSchemaMsg struct {
+	Price  Amount           `json:"price" endpoints:"req"`
+	Total  *Amount          `json:"total" endpoints:"desc=Sum of prices"`
+	Prices []Amount         `json:"prices"`
+	Point  Point            `json:"point"`
+	Cursor registeredCursor `json:"cursor"`
+}
+
+func TestSchemaProvider(t *testing.T) {
+	schemas := make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "", reflect.TypeOf(CustomSchemaMsg{})); err != nil {
+		t.Fatalf("addSchemaFromType() = %v", err)
+	}
+	if len(schemas) != 1 {
+		t.Errorf("want only CustomSchemaMsg schema in %v", schemas)
+	}
+	props := schemas["CustomSchemaMsg"].Properties
+	verifyPairs(t,
+		props["price"], &APISchemaProperty{Type: "number", Format: "double", Desc: "Amount in dollars", Required: true},
+		props["total"], &APISchemaProperty{Type: "number", Format: "double", Desc: "Sum of prices"},
+		props["prices"], &APISchemaProperty{Type: "array", Items: &APISchemaProperty{
+			Type: "number", Format: "double", Desc: "Amount in dollars"}},
+		props["point"], &APISchemaProperty{Type: "array", Items: &APISchemaProperty{Type: "integer", Format: "int32"}},
+		props["cursor"], &APISchemaProperty{Type: "string", Format: "byte"},
+	)
+
+	type req struct {
+		Price  Amount           `json:"price"`
+		Total  *Amount          `json:"total"`
+		Cursor registeredCursor `json:"cursor"`
+	}
+	params, err := typeToParamsSpec(reflect.TypeOf(req{}))
+	if err != nil {
+		t.Fatalf("typeToParamsSpec() = %v", err)
+	}
+	if len(params) != 3 {
+		t.Errorf("typeToParamsSpec() = %v; want 3 params", params)
+	}
+	for name, want := range map[string]string{"price": "double", "total": "double", "cursor": "bytes"} {
+		if p := params[name]; p == nil || p.Type != want {
+			t.Errorf("params[%q] = %+v; want type %q", name, p, want)
+		}
+	}
+
+	type codeMsg struct {
+		Code     registeredCode `json:"code" endpoints:"desc=Currency"`
+		Tagged   registeredCode `json:"tagged" endpoints:"pattern=^[A-Z]+$,maxLength=4"`
+		Required registeredCode `json:"required" endpoints:"req"`
+	}
+	schemas = make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "", reflect.TypeOf(codeMsg{})); err != nil {
+		t.Fatalf("addSchemaFromType(codeMsg) = %v", err)
+	}
+	props = schemas["codeMsg"].Properties
+	verifyPairs(t,
+		props["code"], &APISchemaProperty{Type: "string", Pattern: "^[A-Z]{3}$", MinLength: 3, MaxLength: 3,
+			Default: "USD", Desc: "Currency"},
+		props["tagged"], &APISchemaProperty{Type: "string", Pattern: "^[A-Z]+$", MinLength: 3, MaxLength: 4,
+			Default: "USD"},
+		props["required"], &APISchemaProperty{Type: "string", Pattern: "^[A-Z]{3}$", MinLength: 3, MaxLength: 3,
+			Default: "USD", Required: true},
+	)
+	params, err = typeToParamsSpec(reflect.TypeOf(codeMsg{}))
+	if err != nil {
+		t.Fatalf("typeToParamsSpec(codeMsg) = %v", err)
+	}
+	verifyPairs(t,
+		params["code"].Pattern, "^[A-Z]{3}$",
+		params["tagged"].Pattern, "^[A-Z]+$",
+	)
+
+	type badReq struct {
+		Point Point `json:"point"`
+	}
+	if _, err := typeToParamsSpec(reflect.TypeOf(badReq{})); err == nil {
+		t.Errorf("typeToParamsSpec(badReq) = nil; want error")
+	}
+}
+
+// EnumState is a state of an item, with values described by the type.
+type EnumState string
+
+const (
+	EnumStateActive  EnumState = "active"
+	EnumStateDeleted EnumState = "deleted"
+)
+
+func (EnumState) EndpointsEnum() []EnumValue {
+	return []EnumValue{
+		{Value: string(EnumStateActive), Desc: "Visible item"},
+		{Value: string(EnumStateDeleted)},
+	}
+}
+
+// enumLevel is a level with values set by RegisterEnum.
+type enumLevel int
+
+func init() {
+	RegisterEnum(reflect.TypeOf(enumLevel(0)), EnumValue{Value: "1", Desc: "Low"}, EnumValue{Value: "2", Desc: "High"})
+}
+
+type EnumMsg struct {
+	State  EnumState            `json:"state"`
+	PState *EnumState           `json:"pstate"`
+	States []EnumState          `json:"states"`
+	Level  enumLevel            `json:"level"`
+	ByName map[string]enumLevel `json:"byName"`
+	Kind   EnumState            `json:"kind" endpoints:"enum=active"`
+}
+
+func TestSchemaEnum(t *testing.T) {
+	schemas := make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "", reflect.TypeOf(EnumMsg{})); err != nil {
+		t.Fatalf("addSchemaFromType() = %v", err)
+	}
+	state := &APISchemaProperty{Type: "string",
+		Enum: []string{"active", "deleted"}, EnumDescs: []string{"Visible item", ""}}
+	level := &APISchemaProperty{Type: "integer", Format: "int32",
+		Enum: []string{"1", "2"}, EnumDescs: []string{"Low", "High"}}
+	props := schemas["EnumMsg"].Properties
+	verifyPairs(t,
+		props["state"], state,
+		props["pstate"], state,
+		props["states"], &APISchemaProperty{Type: "array", Items: state},
+		props["level"], level,
+		props["byName"], &APISchemaProperty{Type: "object", AdditionalProperties: level},
+		props["kind"], &APISchemaProperty{Type: "string", Enum: []string{"active"}},
+	)
+
+	type req struct {
+		State *EnumState `json:"state"`
+		Level enumLevel  `json:"level"`
+	}
+	params, err := typeToParamsSpec(reflect.TypeOf(req{}))
+	if err != nil {
+		t.Fatalf("typeToParamsSpec() = %v", err)
+	}
+	verifyPairs(t,
+		params["state"].Enum, map[string]*APIEnumParamSpec{
+			"active":  {BackendVal: "active", Desc: "Visible item"},
+			"deleted": {BackendVal: "deleted"},
+		},
+		params["level"].Enum, map[string]*APIEnumParamSpec{
+			"1": {BackendVal: "1", Desc: "Low"},
+			"2": {BackendVal: "2", Desc: "High"},
+		},
+	)
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterEnum(CompositeItem) didn't panic")
+		}
+	}()
+	RegisterEnum(reflect.TypeOf(CompositeItem{}), EnumValue{Value: "a"})
+}
+
+// Cookie has the same name as http.Cookie.
+type Cookie struct {
+	Name string `json:"name"`
+}
+
+type CookiesMsg struct {
+	Mine   *Cookie        `json:"mine"`
+	Theirs []*http.Cookie `json:"theirs"`
+}
+
+type CookieService struct{}
+
+func (s *CookieService) Get(*http.Request, *VoidMessage, *CookiesMsg) error {
+	return nil
+}
+
+func TestSchemaNameCollision(t *testing.T) {
+	want := `Schema name "Cookie" is used by both github.com/GoogleCloudPlatform/go-endpoints/endpoints.Cookie ` +
+		`and net/http.Cookie, rename one of them or override SchemaNameForType`
+
+	schemas := make(map[string]*APISchemaDescriptor)
+	err := addSchemaFromType(schemas, "", reflect.TypeOf(CookiesMsg{}))
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("addSchemaFromType(CookiesMsg) = %v; want %q", err, want)
+	}
+
+	_, err = NewServer("").RegisterService(&CookieService{}, "CookieService", "v1", "", true)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("RegisterService(CookieService) = %v; want %q", err, want)
+	}
+
+	origSchemaNameForType := SchemaNameForType
+	defer func() { SchemaNameForType = origSchemaNameForType }()
+	SchemaNameForType = func(t reflect.Type) string {
+		if t.PkgPath() == "net/http" {
+			return "HTTP" + t.Name()
+		}
+		return t.Name()
+	}
+	schemas = make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "", reflect.TypeOf(CookiesMsg{})); err != nil {
+		t.Fatalf("addSchemaFromType(CookiesMsg) = %v", err)
+	}
+	if schemas["Cookie"] == nil || schemas["HTTPCookie"] == nil {
+		t.Errorf("want Cookie and HTTPCookie schemas in %v", schemas)
+	}
+}
+
+type MyCookieMsg struct {
+	Cookie *Cookie `json:"cookie"`
+}
+
+type MyCookieService struct{}
+
+func (s *MyCookieService) Get(*http.Request, *VoidMessage, *MyCookieMsg) error {
+	return nil
+}
+
+type HTTPCookiesMsg struct {
+	Cookies []*http.Cookie `json:"cookies"`
+}
+
+type HTTPCookieService struct{}
+
+func (s *HTTPCookieService) Get(*http.Request, *VoidMessage, *HTTPCookiesMsg) error {
+	return nil
+}
+
+func TestSchemaNameCollisionServices(t *testing.T) {
+	want := `Schema name "Cookie" is used by both github.com/GoogleCloudPlatform/go-endpoints/endpoints.Cookie ` +
+		`and net/http.Cookie, rename one of them or override SchemaNameForType`
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&MyCookieService{}, "cookies", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService(MyCookieService) = %v", err)
+	}
+	_, err := server.RegisterService(&HTTPCookieService{}, "cookies", "v1", "", true)
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("RegisterService(HTTPCookieService) = %v; want %q", err, want)
+	}
+
+	// Another API has its own schemas.
+	s, err := server.RegisterService(&HTTPCookieService{}, "other", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService(HTTPCookieService) in another API = %v", err)
+	}
+
+	// Documents merging the schemas of both services report the collision.
+	s.Info().Name = "cookies"
+	services := server.services.servicesByAPI("cookies", "v1")
+	if len(services) != 2 {
+		t.Fatalf("servicesByAPI = %d services; want 2", len(services))
+	}
+	err = newDiscoveryDoc(&DiscoveryDoc{}, services, "example.com", "")
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("newDiscoveryDoc = %v; want %q", err, want)
+	}
+	err = newOpenAPIDoc(&OpenAPIDoc{}, services, "example.com", "")
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("newOpenAPIDoc = %v; want %q", err, want)
+	}
+}
+
+type ChanMsg struct {
+	C chan int `json:"c"`
+}
+
+type ChanService struct{}
+
+func (s *ChanService) Get(*http.Request, *VoidMessage, *ChanMsg) error {
+	return nil
+}
+
+func TestRegisterServiceUndescribableSchema(t *testing.T) {
+	s, err := NewServer("").RegisterService(&ChanService{}, "chans", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService(ChanService) = %v", err)
+	}
+	if err := s.APIDescriptor(&APIDescriptor{}, "example.com"); err == nil {
+		t.Errorf("APIDescriptor(ChanService) = nil; want error")
+	}
+}
+
+type TreeNode struct {
+	Name     string      `json:"name"`
+	Children []*TreeNode `json:"children"`
+	Comments []Comment   `json:"comments"`
+}
+
+type Comment struct {
+	Text    string    `json:"text"`
+	Node    *TreeNode `json:"node"`
+	Parent  *Comment  `json:"parent"`
+	Replies []Comment `json:"replies"`
+}
+
+func TestSchemaRecursiveTypes(t *testing.T) {
+	schemas := make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "", reflect.TypeOf(TreeNode{})); err != nil {
+		t.Fatalf("addSchemaFromType(TreeNode) = %v", err)
+	}
+	node, comment := schemas["TreeNode"], schemas["Comment"]
+	if node == nil || comment == nil || len(schemas) != 2 {
+		t.Fatalf("want TreeNode and Comment schemas in %v", schemas)
+	}
+	verifyPairs(t,
+		node.Properties["children"], &APISchemaProperty{Type: "array", Items: &APISchemaProperty{Ref: "TreeNode"}},
+		node.Properties["comments"], &APISchemaProperty{Type: "array", Items: &APISchemaProperty{Ref: "Comment"}},
+		comment.Properties["node"], &APISchemaProperty{Ref: "TreeNode"},
+		comment.Properties["parent"], &APISchemaProperty{Ref: "Comment"},
+		comment.Properties["replies"], &APISchemaProperty{Type: "array", Items: &APISchemaProperty{Ref: "Comment"}},
+	)
+
+	type query struct {
+		Text   string `json:"text"`
+		Parent *query `json:"parent"`
+	}
+	params, err := typeToParamsSpec(reflect.TypeOf(query{}))
+	if err != nil {
+		t.Fatalf("typeToParamsSpec(query) = %v", err)
+	}
+	if len(params) != 1 || params["text"] == nil {
+		t.Errorf("typeToParamsSpec(query) = %v; want only text", params)
+	}
+}
+
+func TestSchemaName(t *testing.T) {
+	tts := []struct{ in, out string }{
+		{"Item", "Item"},
+		{"Page[github.com/user/app/model.Item]", "PageItem"},
+		{"Pair[string,map[string]*example.com/x.Value]", "PairStringMapStringValue"},
+		{"List[[]main.Item]", "ListItem"},
+	}
+	for _, tt := range tts {
+		if out := schemaName(tt.in); out != tt.out {
+			t.Errorf("schemaName(%q) = %q; want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+type ConstraintsMsg struct {
+	Slug  string   `json:"slug" endpoints:"pattern=^[a-z-]+$,minLength=1,maxLength=20"`
+	Color string   `json:"color" endpoints:"enum=red|green"`
+	Tags  []string `json:"tags" endpoints:"minItems=1,maxItems=5"`
+}
+
+func TestSchemaPropertyConstraints(t *testing.T) {
+	schemas := make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "ConstraintsMsg", reflect.TypeOf(ConstraintsMsg{})); err != nil {
+		t.Fatalf("addSchemaFromType() = %v", err)
+	}
+	props := schemas["ConstraintsMsg"].Properties
+	verifyPairs(t,
+		props["slug"].Pattern, "^[a-z-]+$",
+		props["slug"].MinLength, 1,
+		props["slug"].MaxLength, 20,
+		props["slug"].Enum, []string(nil),
+		props["color"].Enum, []string{"red", "green"},
+		props["color"].MaxLength, 0,
+		props["tags"].MinItems, 1,
+		props["tags"].MaxItems, 5,
+	)
+
+	type badMsg struct {
+		Tags []string `endpoints:"enum=a|b"`
+	}
+	err := addSchemaFromType(schemas, "badMsg", reflect.TypeOf(badMsg{}))
+	want := "Tag error on property badMsg.Tags: enum applies only to strings, numbers and booleans, not []string"
+	if err == nil || err.Error() != want {
+		t.Errorf("addSchemaFromType(badMsg) = %v; want %q", err, want)
+	}
+}
+
+func TestParamSpecConstraints(t *testing.T) {
+	type req struct {
+		Slug  string `json:"slug" endpoints:"pattern=^[a-z-]+$"`
+		Color string `json:"color" endpoints:"enum=red|green"`
+	}
+	params, err := typeToParamsSpec(reflect.TypeOf(req{}))
+	if err != nil {
+		t.Fatalf("typeToParamsSpec() = %v", err)
+	}
+	verifyPairs(t,
+		params["slug"].Pattern, "^[a-z-]+$",
+		len(params["slug"].Enum), 0,
+		params["color"].Enum, map[string]*APIEnumParamSpec{
+			"red":   {BackendVal: "red"},
+			"green": {BackendVal: "green"},
+		},
+	)
+
+	type badReq struct {
+		Count int `endpoints:"maxLength=3"`
+	}
+	if _, err := typeToParamsSpec(reflect.TypeOf(badReq{})); err == nil {
+		t.Errorf("typeToParamsSpec(badReq) = nil; want error")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // $SCHEMA_DESCRIPTOR (METHODS)
 
@@ -724,16 +1279,48 @@ func TestParseTag(t *testing.T) {
 		Ignored string `endpoints:"req,ignored_part,desc=Some field"`
 		Opt     int    `endpoints:"d=123,min=1,max=200,desc=Int field"`
 		Invalid uint   `endpoints:"req,d=100"`
+		Str     string `endpoints:"pattern=^[a-z]+(-[a-z]+)*$,minLength=1,maxLength=20,enum=a|b-c"`
+		Items   []int  `endpoints:"minItems=1,maxItems=10"`
+		Pattern string `endpoints:"pattern=[a-"`
+		Length  string `endpoints:"minLength=-1"`
+		Number  []int  `endpoints:"maxItems=ten"`
+		Quoted  string `endpoints:"required,desc='Some, \\'quoted\\' field',pattern='^\\d+$'"`
+		Double  string `endpoints:"d=\"a,b\",desc=\"Say \\\"hi\\\"\""`
+		Empty2  string `endpoints:"d=,desc=''"`
+		Flag    string `endpoints:"req=true"`
+		NoValue string `endpoints:"desc"`
+		Dup     string `endpoints:"req,required"`
+		Open    string `endpoints:"desc='open"`
+		After   string `endpoints:"desc='a'b"`
+		Comma   string `endpoints:"req,"`
+		Lead    string `endpoints:",req"`
+		Path    string `endpoints:"req,path"`
 	}
 
 	testFields := []struct {
 		name string
 		tag  *endpointsTag
 	}{
-		{"Empty", &endpointsTag{false, "", "", "", ""}},
-		{"Ignored", &endpointsTag{true, "", "", "", "Some field"}},
-		{"Opt", &endpointsTag{false, "123", "1", "200", "Int field"}},
+		{"Empty", &endpointsTag{false, false, "", "", "", "", "", -1, -1, -1, -1, nil}},
+		{"Ignored", nil},
+		{"Opt", &endpointsTag{false, false, "123", "1", "200", "Int field", "", -1, -1, -1, -1, nil}},
 		{"Invalid", nil},
+		{"Str", &endpointsTag{false, false, "", "", "", "", "^[a-z]+(-[a-z]+)*$", 1, 20, -1, -1, []string{"a", "b-c"}}},
+		{"Items", &endpointsTag{false, false, "", "", "", "", "", -1, -1, 1, 10, nil}},
+		{"Pattern", nil},
+		{"Length", nil},
+		{"Number", nil},
+		{"Quoted", &endpointsTag{true, false, "", "", "", "Some, 'quoted' field", `^\d+$`, -1, -1, -1, -1, nil}},
+		{"Double", &endpointsTag{false, false, "a,b", "", "", `Say "hi"`, "", -1, -1, -1, -1, nil}},
+		{"Empty2", &endpointsTag{false, false, "", "", "", "", "", -1, -1, -1, -1, nil}},
+		{"Flag", nil},
+		{"NoValue", nil},
+		{"Dup", nil},
+		{"Open", nil},
+		{"After", nil},
+		{"Comma", nil},
+		{"Lead", nil},
+		{"Path", &endpointsTag{true, true, "", "", "", "", "", -1, -1, -1, -1, nil}},
 	}
 
 	typ := reflect.TypeOf(s{})
@@ -1,8 +1,12 @@
 package endpoints
 
 import (
-	"bytes"
-	"crypto/sha256"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // hashes of JWS algorithms
+	_ "crypto/sha512"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,27 +15,30 @@ import (
 	"math/big"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/net/context"
 	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/memcache"
 	"google.golang.org/appengine/user"
 )
 
 const (
-	// DefaultCertURI is Google's public URL which points to JWT certs.
-	DefaultCertURI = ("https://www.googleapis.com/service_accounts/" +
-		"v1/metadata/raw/federated-signon@system.gserviceaccount.com")
+	// DefaultCertURI is Google's public URL which points to JWT certs,
+	// served as a JSON Web Key Set.
+	DefaultCertURI = "https://www.googleapis.com/oauth2/v3/certs"
 	// EmailScope is Google's OAuth 2.0 email scope
 	EmailScope = "https://www.googleapis.com/auth/userinfo.email"
 	// TokeninfoURL is Google's OAuth 2.0 access token verification URL
 	TokeninfoURL = "https://www.googleapis.com/oauth2/v1/tokeninfo"
 	// APIExplorerClientID is the client ID of API explorer.
 	APIExplorerClientID = "292824132082.apps.googleusercontent.com"
+	// FirebaseCertURI is the URL of the JSON Web Key Set of Firebase
+	// Authentication ID tokens.
+	FirebaseCertURI = ("https://www.googleapis.com/service_accounts/" +
+		"v1/jwk/securetoken@system.gserviceaccount.com")
 )
 
 var (
@@ -41,6 +48,10 @@ var (
 	maxTokenLifetimeSecs    = int64(86400) // 1 day in seconds
 	maxAgePattern           = regexp.MustCompile(`\s*max-age\s*=\s*(\d+)\s*`)
 
+	// minCertRefreshInterval limits how often tokens with unknown key IDs
+	// can force certs to be fetched again.
+	minCertRefreshInterval = time.Minute
+
 	// This is a variable on purpose: can be stubbed with a different (fake)
 	// implementation during tests.
 	//
@@ -48,6 +59,10 @@ var (
 	// instead of directly invoking verifySignedJWT().
 	jwtParser = verifySignedJWT
 
+	// googleIssuers verify Google ID tokens accepted by CurrentUser with
+	// audiences and client IDs of its arguments.
+	googleIssuers = []*Issuer{{Issuer: googleIssuer, JWKSURI: DefaultCertURI}}
+
 	// currentUTC returns current time in UTC.
 	// This is a variable on purpose to be able to stub during testing.
 	currentUTC = func() time.Time {
@@ -73,6 +88,108 @@ type Authenticator interface {
 	CurrentOAuthUser(ctx context.Context, scope string) (*user.User, error)
 }
 
+// A PrincipalAuthenticator is an Authenticator which can tell more about
+// the user of a bearer token than user.User does, e.g. its token info.
+type PrincipalAuthenticator interface {
+	Authenticator
+
+	// CurrentOAuthPrincipal returns the principal of this request for
+	// the given scope.
+	//
+	// Returns an error if data for this scope is not available.
+	CurrentOAuthPrincipal(ctx context.Context, scope string) (*Principal, error)
+}
+
+// Issuer is a provider of ID tokens accepted by an API, e.g. Firebase
+// Authentication or an OpenID Connect provider.
+type Issuer struct {
+	// Issuer is the "iss" claim of the provider's tokens.
+	Issuer string `json:"issuer"`
+	// JWKSURI is the URL of the JSON Web Key Set the tokens are signed with.
+	JWKSURI string `json:"jwksUri"`
+	// Audiences lists accepted "aud" claims of the tokens.
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// GoogleIssuer returns an Issuer of Google ID tokens issued to any of
+// audiences, usually OAuth 2.0 client IDs.
+func GoogleIssuer(audiences ...string) *Issuer {
+	return &Issuer{Issuer: googleIssuer, JWKSURI: DefaultCertURI, Audiences: audiences}
+}
+
+// FirebaseIssuer returns an Issuer of Firebase Authentication ID tokens of
+// a Firebase project.
+func FirebaseIssuer(projectID string) *Issuer {
+	return &Issuer{
+		Issuer:    "https://securetoken.google.com/" + projectID,
+		JWKSURI:   FirebaseCertURI,
+		Audiences: []string{projectID},
+	}
+}
+
+// matches returns true if iss is the issuer of tokens with "iss" claim
+// value. Google ID tokens come with and without the URL scheme.
+func (iss *Issuer) matches(value string) bool {
+	return iss.Issuer == value || isGoogleIssuer(iss.Issuer) && isGoogleIssuer(value)
+}
+
+// isGoogleIssuer returns true if iss is the issuer of Google ID tokens.
+func isGoogleIssuer(iss string) bool {
+	return iss == googleIssuer || iss == strings.TrimPrefix(googleIssuer, "https://")
+}
+
+// findIssuer returns the item of issuers which issued tokens with "iss"
+// claim value, or nil.
+func findIssuer(issuers []*Issuer, value string) *Issuer {
+	for _, iss := range issuers {
+		if iss.matches(value) {
+			return iss
+		}
+	}
+	return nil
+}
+
+// trustedIssuers returns sorted names of the issuers of api whose tokens
+// method m accepts: those listed in m.Issuers, or all of them.
+//
+// Returns an error if m lists an issuer api does not have.
+func trustedIssuers(api *ServiceInfo, m *MethodInfo) ([]string, error) {
+	var names []string
+	if m.Issuers == nil {
+		for name := range api.Issuers {
+			names = append(names, name)
+		}
+	} else {
+		for _, name := range m.Issuers {
+			if api.Issuers[name] == nil {
+				return nil, fmt.Errorf("Method %q trusts unknown issuer %q", m.Name, name)
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// methodIssuers returns the issuers trusted by the service method called
+// with c, if any.
+func methodIssuers(c context.Context) []*Issuer {
+	call, _ := c.Value(methodCallKey).(*MethodCall)
+	if call == nil || call.Service.Info() == nil || call.Method.Info() == nil {
+		return nil
+	}
+	api := call.Service.Info()
+	names, err := trustedIssuers(api, call.Method.Info())
+	if err != nil {
+		logger(c).Errorf(c, "%v", err)
+	}
+	issuers := make([]*Issuer, len(names))
+	for i, name := range names {
+		issuers[i] = api.Issuers[name]
+	}
+	return issuers
+}
+
 // contextKey is used to store values on a context.
 type contextKey int
 
@@ -81,6 +198,9 @@ const (
 	invalidKey contextKey = iota
 	requestKey
 	authenticatorKey
+	platformKey
+	methodCallKey
+	principalKey
 )
 
 // HTTPRequest returns the request associated with a context.
@@ -100,14 +220,16 @@ func authenticator(c context.Context) Authenticator {
 var (
 	errNoAuthenticator = errors.New("context has no authenticator (use endpoints.NewContext to create a context)")
 	errNoRequest       = errors.New("no request for context (use endpoints.NewContext to create a context)")
+
+	// errMismatchedClientID is returned for a Bearer token issued to
+	// a client which is not allowed.
+	errMismatchedClientID = errors.New("Mismatched Client ID")
 )
 
-// NewContext returns a new context for an in-flight API (HTTP) request.
+// NewContext returns a new context for an in-flight API (HTTP) request,
+// using DefaultPlatform.
 func NewContext(r *http.Request) context.Context {
-	c := appengine.NewContext(r)
-	c = context.WithValue(c, requestKey, r)
-	c = context.WithValue(c, authenticatorKey, AuthenticatorFactory())
-	return c
+	return DefaultPlatform.NewContext(r)
 }
 
 // parseToken looks for Authorization header and returns a token.
@@ -130,6 +252,8 @@ func parseToken(r *http.Request) string {
 	return ""
 }
 
+// certInfo is a public key in the legacy "keyvalues" format,
+// with base64-encoded modulus and exponent.
 type certInfo struct {
 	Algorithm string `json:"algorithm"`
 	Exponent  string `json:"exponent"`
@@ -137,8 +261,182 @@ type certInfo struct {
 	Modulus   string `json:"modulus"`
 }
 
+// jsonWebKey is a public key of a JSON Web Key Set (RFC 7517), either
+// an RSA key with modulus and exponent or an EC key with curve and point
+// coordinates.
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// certsList is a set of public keys used to sign tokens, either a JSON Web
+// Key Set or a list of keys in the legacy format.
 type certsList struct {
-	KeyValues []*certInfo `json:"keyvalues"`
+	KeyValues []*certInfo   `json:"keyvalues"`
+	Keys      []*jsonWebKey `json:"keys"`
+}
+
+// verificationKey is a public key of a certsList, *rsa.PublicKey or
+// *ecdsa.PublicKey.
+type verificationKey struct {
+	id  string
+	alg string // empty if the key doesn't restrict its algorithm
+	pub crypto.PublicKey
+}
+
+// jwkCurves are the supported elliptic curves of EC keys by "crv" name.
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// publicKeys parses RSA and EC public keys of l. Keys of other types or
+// curves, or not meant for signatures are skipped.
+func (l *certsList) publicKeys() ([]*verificationKey, error) {
+	var keys []*verificationKey
+	for _, k := range l.Keys {
+		var (
+			pub crypto.PublicKey
+			err error
+		)
+		switch {
+		case k.Use != "" && k.Use != "sig":
+			continue
+		case k.KeyType == "RSA":
+			pub, err = newRSAPublicKey(base64.URLEncoding, k.Modulus, k.Exponent)
+		case k.KeyType == "EC" && jwkCurves[k.Curve] != nil:
+			pub, err = newECDSAPublicKey(jwkCurves[k.Curve], k.X, k.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key %q: %v", k.KeyID, err)
+		}
+		keys = append(keys, &verificationKey{id: k.KeyID, alg: k.Algorithm, pub: pub})
+	}
+	for _, cert := range l.KeyValues {
+		pub, err := newRSAPublicKey(base64.StdEncoding, cert.Modulus, cert.Exponent)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key %q: %v", cert.KeyID, err)
+		}
+		keys = append(keys, &verificationKey{id: cert.KeyID, pub: pub})
+	}
+	return keys, nil
+}
+
+// newRSAPublicKey creates an RSA public key from modulus n and exponent e,
+// both encoded with enc.
+func newRSAPublicKey(enc *base64.Encoding, n, e string) (*rsa.PublicKey, error) {
+	modulus, err := decodeBig(enc, n)
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := decodeBig(enc, e)
+	if err != nil {
+		return nil, err
+	}
+	if modulus.Sign() <= 0 {
+		return nil, errors.New("Missing modulus")
+	}
+	if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("Invalid exponent %v", exponent)
+	}
+	return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+}
+
+// newECDSAPublicKey creates an ECDSA public key from base64url-encoded
+// coordinates x and y of a point on curve.
+func newECDSAPublicKey(curve elliptic.Curve, x, y string) (*ecdsa.PublicKey, error) {
+	px, err := decodeBig(base64.URLEncoding, x)
+	if err != nil {
+		return nil, err
+	}
+	py, err := decodeBig(base64.URLEncoding, y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(px, py) {
+		return nil, errors.New("Point is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: px, Y: py}, nil
+}
+
+// jwsAlgorithm is a digital signature algorithm of JWS (RFC 7518).
+type jwsAlgorithm struct {
+	hash  crypto.Hash
+	pss   bool           // RSASSA-PSS rather than RSASSA-PKCS1-v1_5
+	curve elliptic.Curve // curve of ECDSA algorithms, nil for RSA ones
+}
+
+// jwsAlgorithms are the supported algorithms by "alg" header value.
+//
+// "none" and HMAC algorithms are left out on purpose: tokens are only
+// accepted with a signature by a public key of their issuer.
+var jwsAlgorithms = map[string]*jwsAlgorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"PS256": {hash: crypto.SHA256, pss: true},
+	"PS384": {hash: crypto.SHA384, pss: true},
+	"PS512": {hash: crypto.SHA512, pss: true},
+	"ES256": {hash: crypto.SHA256, curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, curve: elliptic.P384()},
+	"ES512": {hash: crypto.SHA512, curve: elliptic.P521()},
+}
+
+// verify returns true if sig is a signature of signed by pub.
+//
+// Keys which don't belong to the algorithm, e.g. RSA keys for ES256
+// or P-384 keys for ES256, never verify a signature.
+func (alg *jwsAlgorithm) verify(pub crypto.PublicKey, signed string, sig []byte) bool {
+	h := alg.hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case alg.curve != nil:
+			return false
+		case alg.pss:
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			return rsa.VerifyPSS(pub, alg.hash, digest, sig, opts) == nil
+		default:
+			return rsa.VerifyPKCS1v15(pub, alg.hash, digest, sig) == nil
+		}
+	case *ecdsa.PublicKey:
+		if alg.curve == nil || pub.Curve != alg.curve {
+			return false
+		}
+		// R and S are concatenated, each padded to the size of the curve.
+		size := (alg.curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+// keysWithID returns those of keys which have ID id.
+func keysWithID(keys []*verificationKey, id string) []*verificationKey {
+	var matched []*verificationKey
+	for _, k := range keys {
+		if k.id == id {
+			matched = append(matched, k)
+		}
+	}
+	return matched
 }
 
 // maxAge parses Cache-Control header value and extracts max-age (in seconds)
@@ -186,31 +484,33 @@ func certExpirationTime(h http.Header) time.Duration {
 	return time.Duration(remainingTime) * time.Second
 }
 
-// cachedCerts fetches public certificates info from DefaultCertURI and
-// caches it for the duration specified in Age header of a response.
-func cachedCerts(c context.Context) (*certsList, error) {
-	namespacedContext, err := appengine.Namespace(c, certNamespace)
-	if err != nil {
-		return nil, err
-	}
-
+// cachedCerts fetches public certificates info from uri, e.g. DefaultCertURI,
+// and caches it for the duration specified in Age header of a response.
+func cachedCerts(c context.Context, uri string) (*certsList, error) {
 	var certs *certsList
 
-	_, err = memcache.JSON.Get(namespacedContext, DefaultCertURI, &certs)
+	certBytes, err := platform(c).Cache.Get(c, uri)
 	if err == nil {
-		return certs, nil
+		if err = json.Unmarshal(certBytes, &certs); err == nil {
+			return certs, nil
+		}
 	}
 
 	// Cache miss or server error.
 	// If any error other than cache miss, it's proably not a good time
-	// to use memcache.
-	var cacheResults = err == memcache.ErrCacheMiss
+	// to use the cache.
+	var cacheResults = err == ErrCacheMiss
 	if !cacheResults {
-		log.Debugf(c, "%s", err.Error())
+		logger(c).Debugf(c, "%s", err.Error())
 	}
+	return fetchCerts(c, uri, cacheResults)
+}
 
-	log.Debugf(c, "Fetching provider certs from: %s", DefaultCertURI)
-	resp, err := newHTTPClient(c).Get(DefaultCertURI)
+// fetchCerts fetches public certificates info from uri, bypassing the cache.
+// The result is cached if cacheResults is true.
+func fetchCerts(c context.Context, uri string, cacheResults bool) (*certsList, error) {
+	logger(c).Debugf(c, "Fetching provider certs from: %s", uri)
+	resp, err := newHTTPClient(c).Get(uri)
 	if err != nil {
 		return nil, err
 	}
@@ -223,6 +523,7 @@ func cachedCerts(c context.Context) (*certsList, error) {
 	if err != nil {
 		return nil, err
 	}
+	var certs *certsList
 	err = json.Unmarshal(certBytes, &certs)
 	if err != nil {
 		return nil, err
@@ -231,32 +532,134 @@ func cachedCerts(c context.Context) (*certsList, error) {
 	if cacheResults {
 		expiration := certExpirationTime(resp.Header)
 		if expiration > 0 {
-			item := &memcache.Item{
-				Key:        DefaultCertURI,
-				Value:      certBytes,
-				Expiration: expiration,
-			}
-			err = memcache.Set(namespacedContext, item)
+			err = platform(c).Cache.Set(c, uri, certBytes, expiration)
 			if err != nil {
-				log.Errorf(c, "Error adding Certs to memcache: %v", err)
+				logger(c).Errorf(c, "Error adding Certs to cache: %v", err)
 			}
 		}
 	}
 	return certs, nil
 }
 
+// signingKeys returns the public keys of uri which may have signed a token
+// with key ID kid, or all the keys if kid is empty.
+//
+// Providers rotate their keys and may sign tokens with a new key before
+// cached certs expire, so certs are fetched again when none of the cached
+// keys has ID kid. Such refreshes happen at most once per
+// minCertRefreshInterval.
+func signingKeys(c context.Context, uri, kid string) ([]*verificationKey, error) {
+	certs, err := cachedCerts(c, uri)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := certs.publicKeys()
+	if err != nil {
+		return nil, err
+	}
+	if kid == "" {
+		return keys, nil
+	}
+	if matched := keysWithID(keys, kid); len(matched) > 0 {
+		return matched, nil
+	}
+
+	if !allowCertRefresh(c, uri) {
+		return nil, fmt.Errorf("Unknown key ID: %s", kid)
+	}
+	logger(c).Infof(c, "Key ID %q not found in cached certs of %s, refreshing", kid, uri)
+	if certs, err = fetchCerts(c, uri, true); err != nil {
+		return nil, err
+	}
+	if keys, err = certs.publicKeys(); err != nil {
+		return nil, err
+	}
+	matched := keysWithID(keys, kid)
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("Unknown key ID: %s", kid)
+	}
+	return matched, nil
+}
+
+// allowCertRefresh reports whether certs of uri can be fetched again because
+// of a token signed with an unknown key, and if so, records the refresh.
+func allowCertRefresh(c context.Context, uri string) bool {
+	cache := platform(c).Cache
+	key := uri + "#refresh"
+	if _, err := cache.Get(c, key); err != ErrCacheMiss {
+		return false
+	}
+	if err := cache.Set(c, key, []byte("1"), minCertRefreshInterval); err != nil {
+		logger(c).Errorf(c, "Error adding cert refresh marker to cache: %v", err)
+	}
+	return true
+}
+
 type signedJWTHeader struct {
 	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
 }
 
 type signedJWT struct {
+	// Audience is the "aud" claim, or its first value if it is an array.
 	Audience string `json:"aud"`
-	ClientID string `json:"azp"`
-	Subject  string `json:"sub"`
-	Email    string `json:"email"`
-	Expires  int64  `json:"exp"`
-	IssuedAt int64  `json:"iat"`
-	Issuer   string `json:"iss"`
+	// Audiences are the values of an "aud" claim which is an array.
+	Audiences []string `json:"-"`
+	ClientID  string   `json:"azp"`
+	Subject   string   `json:"sub"`
+	Email     string   `json:"email"`
+	Expires   int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	Issuer    string   `json:"iss"`
+}
+
+// UnmarshalJSON decodes claims of a token, with an "aud" claim being
+// either a string or an array of strings.
+func (t *signedJWT) UnmarshalJSON(b []byte) error {
+	type claims signedJWT
+	var v struct {
+		claims
+		Audience json.RawMessage `json:"aud"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = signedJWT(v.claims)
+	t.Audience, t.Audiences = "", nil
+	switch {
+	case len(v.Audience) == 0 || string(v.Audience) == "null":
+		return nil
+	case v.Audience[0] == '[':
+		if err := json.Unmarshal(v.Audience, &t.Audiences); err != nil {
+			return err
+		}
+		if len(t.Audiences) > 0 {
+			t.Audience = t.Audiences[0]
+		}
+		return nil
+	}
+	return json.Unmarshal(v.Audience, &t.Audience)
+}
+
+// audiences returns the values of the "aud" claim.
+func (t *signedJWT) audiences() []string {
+	if len(t.Audiences) > 0 {
+		return t.Audiences
+	}
+	if t.Audience != "" {
+		return []string{t.Audience}
+	}
+	return nil
+}
+
+// hasAudience returns true if any value of the "aud" claim is in allowed.
+func (t *signedJWT) hasAudience(allowed []string) bool {
+	for _, aud := range t.audiences() {
+		if contains(allowed, aud) {
+			return true
+		}
+	}
+	return false
 }
 
 // addBase64Pad pads s to be a valid base64-encoded string.
@@ -273,7 +676,13 @@ func addBase64Pad(s string) string {
 // base64ToBig converts base64-encoded string to a big int.
 // Returns error if the encoding is invalid.
 func base64ToBig(s string) (*big.Int, error) {
-	b, err := base64.StdEncoding.DecodeString(addBase64Pad(s))
+	return decodeBig(base64.StdEncoding, s)
+}
+
+// decodeBig converts a big-endian integer encoded with enc to a big int.
+// Padding of s is optional.
+func decodeBig(enc *base64.Encoding, s string) (*big.Int, error) {
+	b, err := enc.DecodeString(addBase64Pad(s))
 	if err != nil {
 		return nil, err
 	}
@@ -282,12 +691,6 @@ func base64ToBig(s string) (*big.Int, error) {
 	return z, nil
 }
 
-// zeroPad prepends 0s to b so that length of the returned slice is size.
-func zeroPad(b []byte, size int) []byte {
-	padded := make([]byte, size-len(b), size)
-	return append(padded, b...)
-}
-
 // contains returns true if value is one of the items of strList.
 func contains(strList []string, value string) bool {
 	for _, choice := range strList {
@@ -301,7 +704,10 @@ func contains(strList []string, value string) bool {
 // verifySignedJWT decodes and verifies JWT token string.
 //
 // Verification is based on
-//   - a certificate exponent and modulus
+//   - the issuer ("iss" field), which must be one of issuers
+//   - a signature by one of the issuer's public keys, selected by the key ID
+//     ("kid" header field) if the token has one, with one of jwsAlgorithms
+//     ("alg" header field)
 //   - expiration and issue timestamps ("exp" and "iat" fields)
 //
 // This method expects JWT token string to be in the standard format, e.g. as
@@ -309,10 +715,10 @@ func contains(strList []string, value string) bool {
 // where all segments are encoded with URL-base64.
 //
 // The caller is responsible for performing further token verification.
-// (Issuer, Audience, ClientID, etc.)
+// (Audience, ClientID, etc.)
 //
 // NOTE: do not call this function directly, use jwtParser() instead.
-func verifySignedJWT(c context.Context, jwt string, now int64) (*signedJWT, error) {
+func verifySignedJWT(c context.Context, jwt string, issuers []*Issuer, now int64) (*signedJWT, error) {
 	segments := strings.Split(jwt, ".")
 	if len(segments) != 3 {
 		return nil, fmt.Errorf("Wrong number of segments in token: %s", jwt)
@@ -328,7 +734,8 @@ func verifySignedJWT(c context.Context, jwt string, now int64) (*signedJWT, erro
 	if err != nil {
 		return nil, err
 	}
-	if header.Algorithm != "RS256" {
+	alg := jwsAlgorithms[header.Algorithm]
+	if alg == nil {
 		return nil, fmt.Errorf("Unexpected encryption algorithm: %s", header.Algorithm)
 	}
 
@@ -343,48 +750,27 @@ func verifySignedJWT(c context.Context, jwt string, now int64) (*signedJWT, erro
 		return nil, err
 	}
 
-	// Get current certs
-	certs, err := cachedCerts(c)
+	signatureBytes, err := base64.URLEncoding.DecodeString(addBase64Pad(segments[2]))
 	if err != nil {
 		return nil, err
 	}
-
-	signatureBytes, err := base64.URLEncoding.DecodeString(addBase64Pad(segments[2]))
+	iss := findIssuer(issuers, token.Issuer)
+	if iss == nil {
+		return nil, fmt.Errorf("Unexpected issuer: %s", token.Issuer)
+	}
+	keys, err := signingKeys(c, iss.JWKSURI, header.KeyID)
 	if err != nil {
 		return nil, err
 	}
-	signature := big.NewInt(0)
-	signature.SetBytes(signatureBytes)
-
-	signed := []byte(fmt.Sprintf("%s.%s", segments[0], segments[1]))
-	h := sha256.New()
-	h.Write(signed)
-	signatureHash := h.Sum(nil)
-	if len(signatureHash) < 32 {
-		signatureHash = zeroPad(signatureHash, 32)
-	}
 
-	z := big.NewInt(0)
+	signed := segments[0] + "." + segments[1]
 	verified := false
-	for _, cert := range certs.KeyValues {
-		exponent, err := base64ToBig(cert.Exponent)
-		if err != nil {
-			return nil, err
-		}
-		modulus, err := base64ToBig(cert.Modulus)
-		if err != nil {
-			return nil, err
-		}
-		signatureHashFromCert := z.Exp(signature, exponent, modulus).Bytes()
-		// Only consider last 32 bytes
-		if len(signatureHashFromCert) > 32 {
-			firstIndex := len(signatureHashFromCert) - 32
-			signatureHashFromCert = signatureHashFromCert[firstIndex:]
-		} else if len(signatureHashFromCert) < 32 {
-			signatureHashFromCert = zeroPad(signatureHashFromCert, 32)
+	for _, key := range keys {
+		if key.alg != "" && key.alg != header.Algorithm {
+			continue
 		}
-		verified = bytes.Equal(signatureHash, signatureHashFromCert)
-		if verified {
+		if alg.verify(key.pub, signed, signatureBytes) {
+			verified = true
 			break
 		}
 	}
@@ -422,61 +808,95 @@ func verifySignedJWT(c context.Context, jwt string, now int64) (*signedJWT, erro
 // by audiences and clientIDs args.
 func verifyParsedToken(c context.Context, token signedJWT, audiences []string, clientIDs []string) bool {
 	// Verify the issuer.
-	if token.Issuer != "accounts.google.com" {
-		log.Warningf(c, "Issuer was not valid: %s", token.Issuer)
+	if !isGoogleIssuer(token.Issuer) {
+		logger(c).Warningf(c, "Issuer was not valid: %s", token.Issuer)
 		return false
 	}
 
 	// Check audiences.
-	if token.Audience == "" {
-		log.Warningf(c, "Invalid aud value in token")
+	if len(token.audiences()) == 0 {
+		logger(c).Warningf(c, "Invalid aud value in token")
 		return false
 	}
 
 	if token.ClientID == "" {
-		log.Warningf(c, "Invalid azp value in token")
+		logger(c).Warningf(c, "Invalid azp value in token")
 		return false
 	}
 
 	// This is only needed if Audience and ClientID differ, which (currently) only
 	// happens on Android. In the case they are equal, we only need the ClientID to
 	// be in the listed of accepted Client IDs.
-	if token.ClientID != token.Audience && !contains(audiences, token.Audience) {
-		log.Warningf(c, "Audience not allowed: %s", token.Audience)
+	issuedToClient := len(token.audiences()) == 1 && token.ClientID == token.Audience
+	if !issuedToClient && !token.hasAudience(audiences) {
+		logger(c).Warningf(c, "Audience not allowed: %v", token.audiences())
 		return false
 	}
 
-	// Check allowed client IDs.
+	// Check allowed client IDs. Without any, tokens of all clients are
+	// accepted as long as they are issued to one of audiences.
 	if len(clientIDs) == 0 {
-		log.Warningf(c, "No allowed client IDs specified. ID token cannot be verified.")
-		return false
+		if !token.hasAudience(audiences) {
+			logger(c).Warningf(c, "Audience not allowed: %v", token.audiences())
+			return false
+		}
 	} else if !contains(clientIDs, token.ClientID) {
-		log.Warningf(c, "Client ID is not allowed: %s", token.ClientID)
+		logger(c).Warningf(c, "Client ID is not allowed: %s", token.ClientID)
 		return false
 	}
 
 	if token.Email == "" {
-		log.Warningf(c, "Invalid email value in token")
+		logger(c).Warningf(c, "Invalid email value in token")
 		return false
 	}
 
 	return true
 }
 
-// currentIDTokenUser returns "appengine/user".User object if provided JWT token
+// currentIDTokenPrincipal returns a Principal if provided JWT token
 // was successfully decoded and passed all verifications.
-func currentIDTokenUser(c context.Context, jwt string, audiences []string, clientIDs []string, now int64) (*user.User, error) {
-	parsedToken, err := jwtParser(c, jwt, now)
+func currentIDTokenPrincipal(c context.Context, jwt string, audiences []string, clientIDs []string, now int64) (*Principal, error) {
+	parsedToken, err := jwtParser(c, jwt, googleIssuers, now)
 	if err != nil {
 		return nil, err
 	}
 
 	if verifyParsedToken(c, *parsedToken, audiences, clientIDs) {
-		return &user.User{
-			ID:       parsedToken.Subject,
-			Email:    parsedToken.Email,
-			ClientID: parsedToken.ClientID,
-		}, nil
+		return newIDTokenPrincipal(jwt, parsedToken), nil
+	}
+
+	return nil, errors.New("No ID token user found.")
+}
+
+// verifyIssuerToken checks that a parsed JWT token of iss was issued to
+// one of its audiences and identifies a user.
+func verifyIssuerToken(c context.Context, token signedJWT, iss *Issuer) bool {
+	if len(iss.Audiences) == 0 {
+		logger(c).Warningf(c, "No audiences specified for issuer %s. ID token cannot be verified.", iss.Issuer)
+		return false
+	} else if !token.hasAudience(iss.Audiences) {
+		logger(c).Warningf(c, "Audience not allowed: %v", token.audiences())
+		return false
+	}
+
+	if token.Subject == "" {
+		logger(c).Warningf(c, "Invalid sub value in token")
+		return false
+	}
+	return true
+}
+
+// currentIssuerPrincipal returns a Principal if provided JWT token
+// was issued by one of issuers and passed all verifications.
+func currentIssuerPrincipal(c context.Context, jwt string, issuers []*Issuer, now int64) (*Principal, error) {
+	parsedToken, err := jwtParser(c, jwt, issuers, now)
+	if err != nil {
+		return nil, err
+	}
+
+	iss := findIssuer(issuers, parsedToken.Issuer)
+	if iss != nil && verifyIssuerToken(c, *parsedToken, iss) {
+		return newIDTokenPrincipal(jwt, parsedToken), nil
 	}
 
 	return nil, errors.New("No ID token user found.")
@@ -490,6 +910,12 @@ func currentIDTokenUser(c context.Context, jwt string, audiences []string, clien
 //   - it is found in Context c
 //   - client ID on that scope matches one of clientIDs in the args
 func CurrentBearerTokenScope(c context.Context, scopes []string, clientIDs []string) (string, error) {
+	return bearerTokenScope(c, scopes, clientIDs, false)
+}
+
+// bearerTokenScope is CurrentBearerTokenScope. If anyClient is true and
+// clientIDs is empty, the token of any client is accepted.
+func bearerTokenScope(c context.Context, scopes []string, clientIDs []string, anyClient bool) (string, error) {
 	auth := authenticator(c)
 	if auth == nil {
 		return "", errNoAuthenticator
@@ -499,6 +925,9 @@ func CurrentBearerTokenScope(c context.Context, scopes []string, clientIDs []str
 		if err != nil {
 			continue
 		}
+		if anyClient && len(clientIDs) == 0 {
+			return scope, nil
+		}
 
 		for _, id := range clientIDs {
 			if id == currentClientID {
@@ -507,8 +936,8 @@ func CurrentBearerTokenScope(c context.Context, scopes []string, clientIDs []str
 		}
 
 		// If none of the client IDs matches, return nil
-		log.Debugf(c, "Couldn't find current client ID %q in %v", currentClientID, clientIDs)
-		return "", errors.New("Mismatched Client ID")
+		logger(c).Debugf(c, "Couldn't find current client ID %q in %v", currentClientID, clientIDs)
+		return "", errMismatchedClientID
 	}
 	// No client ID found for any of the scopes
 	return "", errors.New("No valid scope")
@@ -535,19 +964,50 @@ func CurrentBearerTokenUser(c context.Context, scopes []string, clientIDs []stri
 	return auth.CurrentOAuthUser(c, scope)
 }
 
-// CurrentUser checks for both JWT and Bearer tokens.
+// currentBearerTokenPrincipal returns the principal of a request which is
+// expected to have a Bearer token, see CurrentBearerTokenUser and
+// bearerTokenScope.
+func currentBearerTokenPrincipal(c context.Context, scopes []string, clientIDs []string, anyClient bool) (*Principal, error) {
+	auth := authenticator(c)
+	if auth == nil {
+		return nil, errNoAuthenticator
+	}
+	scope, err := bearerTokenScope(c, scopes, clientIDs, anyClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if pa, ok := auth.(PrincipalAuthenticator); ok {
+		return pa.CurrentOAuthPrincipal(c, scope)
+	}
+	u, err := auth.CurrentOAuthUser(c, scope)
+	if err != nil {
+		return nil, err
+	}
+	return newBearerTokenPrincipal(u), nil
+}
+
+// CurrentPrincipal checks for both JWT and Bearer tokens and returns
+// the authenticated caller with all the claims of its token.
 //
 // It first tries to decode and verify JWT token (if conditions are met)
 // and falls back to Bearer token.
 //
-// The returned user will have only ID, Email and ClientID fields set.
-// User.ID is a Google Account ID, which is different from GAE user ID.
-// For more info on User.ID see 'sub' claim description on
-// https://developers.google.com/identity/protocols/OpenIDConnect#obtainuserinfo
-func CurrentUser(c context.Context, scopes []string, audiences []string, clientIDs []string) (*user.User, error) {
+// When called from a service method served by Server, ID tokens of the
+// issuers the method trusts are accepted as well, see ServiceInfo.Issuers
+// and MethodInfo.Issuers.
+func CurrentPrincipal(c context.Context, scopes []string, audiences []string, clientIDs []string) (*Principal, error) {
+	return currentPrincipal(c, scopes, audiences, clientIDs, false)
+}
+
+// currentPrincipal is CurrentPrincipal. If anyClient is true and clientIDs
+// is empty, tokens of any client are accepted: Bearer tokens with one of
+// scopes, and Google ID tokens issued to one of audiences.
+func currentPrincipal(c context.Context, scopes []string, audiences []string, clientIDs []string, anyClient bool) (*Principal, error) {
+	issuers := methodIssuers(c)
 	// The user hasn't provided any information to allow us to parse either
 	// an ID token or a Bearer token.
-	if len(scopes) == 0 && len(audiences) == 0 && len(clientIDs) == 0 {
+	if len(scopes) == 0 && len(audiences) == 0 && len(clientIDs) == 0 && len(issuers) == 0 {
 		return nil, errors.New("no client ID or scope info provided.")
 	}
 	r := HTTPRequest(c)
@@ -560,22 +1020,86 @@ func CurrentUser(c context.Context, scopes []string, audiences []string, clientI
 		return nil, errors.New("No token in the current context.")
 	}
 
-	// If the only scope is the email scope, check an ID token. Alternatively,
-	// we dould check if token starts with "ya29." or "1/" to decide that it
-	// is a Bearer token. This is what is done in Java.
-	if len(scopes) == 1 && scopes[0] == EmailScope && len(clientIDs) > 0 {
-		log.Debugf(c, "Checking for ID token.")
+	if len(issuers) > 0 {
+		logger(c).Debugf(c, "Checking for ID token of trusted issuers.")
+		p, err := currentIssuerPrincipal(c, token, issuers, currentUTC().Unix())
+		if err == nil {
+			return p, nil
+		}
+	}
+
+	// If the only scope is the email scope, or no scopes are given, check
+	// an ID token. Alternatively, we dould check if token starts with "ya29."
+	// or "1/" to decide that it is a Bearer token. This is what is done in
+	// Java.
+	idTokenClients := len(clientIDs) > 0 || anyClient && len(audiences) > 0
+	if (len(scopes) == 0 || len(scopes) == 1 && scopes[0] == EmailScope) && idTokenClients {
+		logger(c).Debugf(c, "Checking for ID token.")
 		now := currentUTC().Unix()
-		u, err := currentIDTokenUser(c, token, audiences, clientIDs, now)
+		p, err := currentIDTokenPrincipal(c, token, audiences, clientIDs, now)
 		// Only return in case of success, else pass along and try
 		// parsing Bearer token.
 		if err == nil {
-			return u, err
+			return p, err
 		}
 	}
 
-	log.Debugf(c, "Checking for Bearer token.")
-	return CurrentBearerTokenUser(c, scopes, clientIDs)
+	logger(c).Debugf(c, "Checking for Bearer token.")
+	return currentBearerTokenPrincipal(c, scopes, clientIDs, anyClient)
+}
+
+// CurrentUser checks for both JWT and Bearer tokens, like CurrentPrincipal,
+// and returns the caller as an App Engine user.
+//
+// The returned user will have only ID, Email and ClientID fields set,
+// unless it is reported by the Authenticator of a Bearer token.
+// User.ID is a Google Account ID, which is different from GAE user ID.
+// For more info on User.ID see 'sub' claim description on
+// https://developers.google.com/identity/protocols/OpenIDConnect#obtainuserinfo
+func CurrentUser(c context.Context, scopes []string, audiences []string, clientIDs []string) (*user.User, error) {
+	p, err := CurrentPrincipal(c, scopes, audiences, clientIDs)
+	if err != nil {
+		return nil, err
+	}
+	return p.User(), nil
+}
+
+// authorizeCall enforces the auth requirements declared by the method of
+// call, which c must carry, and returns c with the authenticated principal,
+// see PrincipalFromContext.
+//
+// Methods which declare no scopes, audiences, client IDs or issuers are not
+// checked, even if their API has issuers. Methods which declare no client
+// IDs accept tokens of any client: Bearer tokens with one of their scopes
+// and Google ID tokens issued to one of their audiences.
+//
+// Unless the method allows anonymous calls, the error is UnauthorizedError
+// if the caller could not be authenticated, or ForbiddenError if the
+// caller's client is not allowed.
+func authorizeCall(c context.Context, call *MethodCall) (context.Context, error) {
+	info := call.Method.Info()
+	if info == nil {
+		return c, nil
+	}
+	if len(info.Scopes) == 0 && len(info.Audiences) == 0 && len(info.ClientIds) == 0 &&
+		len(info.Issuers) == 0 {
+		return c, nil
+	}
+	p, err := currentPrincipal(c, info.Scopes, info.Audiences, info.ClientIds, true)
+	switch {
+	case err == nil:
+		return WithPrincipal(c, p), nil
+	case err == errNoAuthenticator || err == errNoRequest:
+		return c, err
+	case info.AllowAnonymous:
+		logger(c).Debugf(c, "Anonymous call of %s: %v", info.Name, err)
+		return c, nil
+	}
+	logger(c).Debugf(c, "Unauthorized call of %s: %v", info.Name, err)
+	if err == errMismatchedClientID {
+		return c, NewForbiddenError("Client is not allowed to call %s", info.Name)
+	}
+	return c, NewUnauthorizedError("Valid credentials are required to call %s", info.Name)
 }
 
 func init() {
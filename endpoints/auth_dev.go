@@ -11,9 +11,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"golang.org/x/net/context"
-	"google.golang.org/appengine/log"
 	"google.golang.org/appengine/user"
 )
 
@@ -36,13 +36,13 @@ type tokeninfo struct {
 // fetchTokeninfo retrieves token info from tokeninfoEndpointURL  (tokeninfo API)
 func fetchTokeninfo(c context.Context, token string) (*tokeninfo, error) {
 	url := tokeninfoEndpointURL + "?access_token=" + token
-	log.Debugf(c, "Fetching token info from %q", url)
+	logger(c).Debugf(c, "Fetching token info from %q", url)
 	resp, err := newHTTPClient(c).Get(url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	log.Debugf(c, "Tokeninfo replied with %s", resp.Status)
+	logger(c).Debugf(c, "Tokeninfo replied with %s", resp.Status)
 
 	ti := &tokeninfo{}
 	if err = json.NewDecoder(resp.Body).Decode(ti); err != nil {
@@ -114,6 +114,35 @@ func (tokeninfoAuthenticator) CurrentOAuthUser(c context.Context, scope string)
 	}, nil
 }
 
+// CurrentOAuthPrincipal returns the principal associated with the request
+// in context, with token info turned into claims.
+func (tokeninfoAuthenticator) CurrentOAuthPrincipal(c context.Context, scope string) (*Principal, error) {
+	ti, err := scopedTokeninfo(c, scope)
+	if err != nil {
+		return nil, err
+	}
+	expires := currentUTC().Add(time.Duration(ti.ExpiresIn) * time.Second)
+	return &Principal{
+		ID:       ti.UserID,
+		Email:    ti.Email,
+		ClientID: ti.IssuedTo,
+		Issuer:   googleIssuer,
+		Audience: ti.Audience,
+		Expires:  expires,
+		Method:   AuthBearerToken,
+		Claims: map[string]interface{}{
+			"sub":            ti.UserID,
+			"email":          ti.Email,
+			"email_verified": ti.VerifiedEmail,
+			"azp":            ti.IssuedTo,
+			"aud":            ti.Audience,
+			"scope":          ti.Scope,
+			"exp":            float64(expires.Unix()),
+			"access_type":    ti.AccessType,
+		},
+	}, nil
+}
+
 // tokeninfoAuthenticatorFactory creates a new tokeninfoAuthenticator from r.
 // To be used as auth.go/AuthenticatorFactory.
 func tokeninfoAuthenticatorFactory() Authenticator {
@@ -85,6 +85,25 @@ func (ca *cachingAuthenticator) CurrentOAuthUser(c context.Context, scope string
 	return u, nil
 }
 
+// CurrentOAuthPrincipal returns the principal of this request for the given
+// scope, with what the OAuth API reports turned into claims: "sub",
+// "email", "azp" and "scope", the latter being the given scope. The OAuth API
+// does not tell when the token expires, so Expires is zero.
+func (ca *cachingAuthenticator) CurrentOAuthPrincipal(c context.Context, scope string) (*Principal, error) {
+	u, err := ca.oauthResponse(c, scope)
+	if err != nil {
+		return nil, err
+	}
+	p := newBearerTokenPrincipal(u)
+	p.Claims = map[string]interface{}{
+		"sub":   u.ID,
+		"email": u.Email,
+		"azp":   u.ClientID,
+		"scope": scope,
+	}
+	return p, nil
+}
+
 // Default implentation of endpoints.AuthenticatorFactory.
 func cachingAuthenticatorFactory() Authenticator {
 	// TODO(dhermes): Check whether the prod behaviour is identical to dev.
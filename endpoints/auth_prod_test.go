@@ -0,0 +1,39 @@
+package endpoints
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/user"
+)
+
+func TestCachingAuthenticatorPrincipal(t *testing.T) {
+	const scope = "scope.one"
+	u := &user.User{ID: "123", Email: "dude@gmail.com", ClientID: "my-client-id"}
+	ca := &cachingAuthenticator{oauthResponseCache: map[string]*user.User{scope: u}}
+
+	var auth Authenticator = ca
+	pa, ok := auth.(PrincipalAuthenticator)
+	if !ok {
+		t.Fatal("cachingAuthenticator does not implement PrincipalAuthenticator")
+	}
+	p, err := pa.CurrentOAuthPrincipal(context.Background(), scope)
+	if err != nil {
+		t.Fatalf("CurrentOAuthPrincipal(%q) = %v", scope, err)
+	}
+	verifyPairs(t,
+		p.ID, "123",
+		p.Email, "dude@gmail.com",
+		p.ClientID, "my-client-id",
+		p.Issuer, googleIssuer,
+		p.Method, AuthBearerToken,
+		p.Expires.IsZero(), true,
+		p.User(), u,
+		p.Claims, map[string]interface{}{
+			"sub":   "123",
+			"email": "dude@gmail.com",
+			"azp":   "my-client-id",
+			"scope": scope,
+		},
+	)
+}
@@ -1,7 +1,10 @@
 package endpoints
 
 import (
-	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -121,12 +124,63 @@ func TestBase64ToBig(t *testing.T) {
 	}
 }
 
-func TestZeroPad(t *testing.T) {
-	in := []byte{1, 2, 3}
-	padded := zeroPad(in, 5)
-	want := []byte{0, 0, 1, 2, 3}
-	if !bytes.Equal(padded, want) {
-		t.Errorf("zeroPad(%#v, 5) = %#v; want %#v", in, padded, want)
+func TestCertsListPublicKeys(t *testing.T) {
+	p256 := elliptic.P256().Params()
+	b64 := func(z *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(z.Bytes())
+	}
+	tts := []struct {
+		certs   *certsList
+		wantIDs []string
+		error   bool
+	}{
+		{&certsList{}, nil, false},
+		{&certsList{KeyValues: []*certInfo{{KeyID: "legacy", Modulus: "AOE=", Exponent: "AQAB"}}},
+			[]string{"legacy"}, false},
+		{&certsList{Keys: []*jsonWebKey{
+			{KeyType: "RSA", KeyID: "a", Modulus: "AOE", Exponent: "AQAB"},
+			{KeyType: "EC", KeyID: "b"},
+			{KeyType: "RSA", Use: "enc", KeyID: "c", Modulus: "AOE", Exponent: "AQAB"},
+			{KeyType: "RSA", Use: "sig", KeyID: "d", Modulus: "4Q", Exponent: "Aw"},
+		}}, []string{"a", "d"}, false},
+		{&certsList{Keys: []*jsonWebKey{{KeyType: "RSA", KeyID: "a", Modulus: "AOE", Exponent: "AQ"}}}, nil, true},
+		{&certsList{Keys: []*jsonWebKey{{KeyType: "RSA", KeyID: "a", Exponent: "AQAB"}}}, nil, true},
+		{&certsList{KeyValues: []*certInfo{{KeyID: "a", Modulus: "AOE=", Exponent: "    "}}}, nil, true},
+		{&certsList{Keys: []*jsonWebKey{
+			{KeyType: "EC", KeyID: "p256", Curve: "P-256", X: b64(p256.Gx), Y: b64(p256.Gy)},
+			{KeyType: "EC", KeyID: "k256", Curve: "secp256k1", X: b64(p256.Gx), Y: b64(p256.Gy)},
+		}}, []string{"p256"}, false},
+		{&certsList{Keys: []*jsonWebKey{
+			{KeyType: "EC", KeyID: "p384", Curve: "P-384", X: b64(p256.Gx), Y: b64(p256.Gy)},
+		}}, nil, true},
+	}
+
+	for i, tt := range tts {
+		keys, err := tt.certs.publicKeys()
+		switch {
+		case err != nil && !tt.error:
+			t.Errorf("%d: publicKeys() = %v", i, err)
+		case err == nil && tt.error:
+			t.Errorf("%d: publicKeys() = %v; want error", i, keys)
+		case err == nil:
+			var ids []string
+			for _, k := range keys {
+				ids = append(ids, k.id)
+				switch pub := k.pub.(type) {
+				case *rsa.PublicKey:
+					if pub.N.Int64() != 0xe1 {
+						t.Errorf("%d: publicKeys()[%q].N = %v; want 225", i, k.id, pub.N)
+					}
+				case *ecdsa.PublicKey:
+					if pub.X.Cmp(p256.Gx) != 0 || pub.Y.Cmp(p256.Gy) != 0 {
+						t.Errorf("%d: publicKeys()[%q] = %v; want P-256 base point", i, k.id, pub)
+					}
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("%d: publicKeys() IDs = %v; want %v", i, ids, tt.wantIDs)
+			}
+		}
 	}
 }
 
@@ -172,13 +226,22 @@ func TestCachedCertsCacheHit(t *testing.T) {
 	}{
 		{"", nil},
 		{"{}", &certsList{}},
-		{`{"keyvalues": [{}]}`, &certsList{[]*certInfo{{}}}},
+		{`{"keyvalues": [{}]}`, &certsList{KeyValues: []*certInfo{{}}}},
 		{`{"keyvalues": [
 	    	{"algorithm": "RS256",
 	    	 "exponent": "123",
 	    	 "keyid": "some-id",
 	    	 "modulus": "123"} ]}`,
-			&certsList{[]*certInfo{{"RS256", "123", "some-id", "123"}}}},
+			&certsList{KeyValues: []*certInfo{{"RS256", "123", "some-id", "123"}}}},
+		{`{"keys": [
+	    	{"kty": "RSA",
+	    	 "alg": "RS256",
+	    	 "use": "sig",
+	    	 "kid": "some-id",
+	    	 "n": "123",
+	    	 "e": "AQAB"} ]}`,
+			&certsList{Keys: []*jsonWebKey{{KeyType: "RSA", Algorithm: "RS256", Use: "sig",
+				KeyID: "some-id", Modulus: "123", Exponent: "AQAB"}}}},
 	}
 	ec := NewContext(req)
 	for i, tt := range tts {
@@ -186,7 +249,7 @@ func TestCachedCertsCacheHit(t *testing.T) {
 		if err := memcache.Set(nc, item); err != nil {
 			t.Fatal(err)
 		}
-		out, err := cachedCerts(ec)
+		out, err := cachedCerts(ec, DefaultCertURI)
 		switch {
 		case err != nil && tt.want != nil:
 			t.Errorf("%d: cachedCerts() error %v", i, err)
@@ -241,7 +304,7 @@ func TestCachedCertsCacheMiss(t *testing.T) {
 		}
 		memcache.Delete(nc, DefaultCertURI)
 
-		out, err := cachedCerts(ec)
+		out, err := cachedCerts(ec, DefaultCertURI)
 		switch {
 		case err != nil && tt.want != nil:
 			t.Errorf("%d: cachedCerts() = %v", i, err)
@@ -8,8 +8,6 @@ import (
 	"strings"
 
 	"golang.org/x/net/context"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
 )
 
 // Levels that can be specified for a LogMessage.
@@ -59,14 +57,17 @@ type BackendService struct {
 // Responds with a list of active APIs and their configuration files.
 func (s *BackendService) GetApiConfigs(
 	r *http.Request, req *GetAPIConfigsRequest, resp *APIConfigsList) error {
-	c := appengine.NewContext(r)
-	if req.AppRevision != "" {
-		revision := strings.Split(appengine.VersionID(c), ".")[1]
+	c := s.newContext(r)
+	if versionID := platform(c).VersionID; req.AppRevision != "" && versionID != nil {
+		revision := versionID(c)
+		if parts := strings.Split(revision, "."); len(parts) > 1 {
+			revision = parts[1]
+		}
 		if req.AppRevision != revision {
 			err := fmt.Errorf(
 				"API backend app revision %s not the same as expected %s",
 				revision, req.AppRevision)
-			log.Errorf(c, "%s", err)
+			logger(c).Errorf(c, "%s", err)
 			return err
 		}
 	}
@@ -78,12 +79,12 @@ func (s *BackendService) GetApiConfigs(
 		}
 		d := &APIDescriptor{}
 		if err := service.APIDescriptor(d, r.Host); err != nil {
-			log.Errorf(c, "%s", err)
+			logger(c).Errorf(c, "%s", err)
 			return err
 		}
 		bytes, err := json.Marshal(d)
 		if err != nil {
-			log.Errorf(c, "%s", err)
+			logger(c).Errorf(c, "%s", err)
 			return err
 		}
 		resp.Items = append(resp.Items, string(bytes))
@@ -95,7 +96,7 @@ func (s *BackendService) GetApiConfigs(
 func (s *BackendService) LogMessages(
 	r *http.Request, req *LogMessagesRequest, _ *VoidMessage) error {
 
-	c := appengine.NewContext(r)
+	c := s.newContext(r)
 	for _, msg := range req.Messages {
 		writeLogMessage(c, msg.Level, msg.Message)
 	}
@@ -118,16 +119,24 @@ func writeLogMessage(c context.Context, level logLevel, msg string) {
 	const fmt = "%s"
 	switch level {
 	case levelDebug:
-		log.Debugf(c, fmt, msg)
+		logger(c).Debugf(c, fmt, msg)
 	case levelWarning:
-		log.Warningf(c, fmt, msg)
+		logger(c).Warningf(c, fmt, msg)
 	case levelError:
-		log.Errorf(c, fmt, msg)
+		logger(c).Errorf(c, fmt, msg)
 	case levelCritical:
-		log.Criticalf(c, fmt, msg)
+		logger(c).Criticalf(c, fmt, msg)
 	default:
-		log.Infof(c, fmt, msg)
+		logger(c).Infof(c, fmt, msg)
+	}
+}
+
+// newContext creates a context for r using the platform of the server.
+func (s *BackendService) newContext(r *http.Request) context.Context {
+	if s.server == nil {
+		return NewContext(r)
 	}
+	return s.server.platform().NewContext(r)
 }
 
 func newBackendService(server *Server) *BackendService {
@@ -0,0 +1,515 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Requests and responses are encoded as JSON the same way as by
+// encoding/json, except that int64 and uint64 values are strings, as
+// schemas declare them, see typeToPropFormat. JavaScript clients can't
+// represent all of them as numbers. Values of interface types have no
+// declared format and are encoded by encoding/json as they are, numbers
+// included. Both strings and numbers are accepted in requests.
+
+var (
+	typeOfMarshaler       = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	typeOfJSONUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// encodeJSON writes v to w as JSON, followed by a newline like
+// json.Encoder does.
+func encodeJSON(w io.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(v), false); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodeValue appends v to buf as JSON. Values implementing json.Marshaler
+// or encoding.TextMarshaler, values held by interfaces, and values other
+// than 64-bit integers and containers, are encoded by encoding/json. quoted
+// is true for values of fields with ",string" option.
+func encodeValue(buf *bytes.Buffer, v reflect.Value, quoted bool) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+	t := v.Type()
+	if isMarshaler(t) || v.CanAddr() && isMarshaler(reflect.PtrTo(t)) {
+		return marshalValue(buf, v, quoted)
+	}
+
+	switch v.Kind() {
+	case reflect.Int64:
+		buf.WriteString(`"` + strconv.FormatInt(v.Int(), 10) + `"`)
+	case reflect.Uint64:
+		buf.WriteString(`"` + strconv.FormatUint(v.Uint(), 10) + `"`)
+	case reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return marshalValue(buf, v.Elem(), false)
+	case reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeValue(buf, v.Elem(), quoted)
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+	case reflect.Map:
+		return encodeMap(buf, v)
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return marshalValue(buf, v, false)
+		}
+		fallthrough
+	case reflect.Array:
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, v.Index(i), false); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		return marshalValue(buf, v, quoted)
+	}
+	return nil
+}
+
+// typedValue is a value held by an interface which is encoded as a value of
+// its own type, e.g. a method response, with int64 and uint64 values as
+// strings.
+type typedValue struct {
+	v interface{}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (tv typedValue) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, reflect.ValueOf(tv.v), false); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isMarshaler returns true if values of type t encode themselves.
+func isMarshaler(t reflect.Type) bool {
+	return t.Implements(typeOfMarshaler) || t.Implements(typeOfTextMarshaler)
+}
+
+// marshalValue appends v encoded by encoding/json to buf, as a JSON string
+// if quoted is true.
+func marshalValue(buf *bytes.Buffer, v reflect.Value, quoted bool) error {
+	x := v.Interface()
+	if v.CanAddr() && v.Kind() != reflect.Ptr {
+		x = v.Addr().Interface()
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	if quoted {
+		if b, err = json.Marshal(string(b)); err != nil {
+			return err
+		}
+	}
+	buf.Write(b)
+	return nil
+}
+
+// encodeStruct appends struct v to buf as a JSON object.
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('{')
+	first := true
+	for _, f := range jsonFieldsOf(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || f.omitEmpty && isEmptyJSONValue(fv) {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		b, _ := json.Marshal(f.name)
+		buf.Write(b)
+		buf.WriteByte(':')
+		if err := encodeValue(buf, fv, f.quoted); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// encodeMap appends map v to buf as a JSON object with sorted keys.
+func encodeMap(buf *bytes.Buffer, v reflect.Value) error {
+	if v.IsNil() {
+		buf.WriteString("null")
+		return nil
+	}
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	for _, k := range v.MapKeys() {
+		name, err := mapKeyString(k)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, name)
+		values[name] = v.MapIndex(k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, _ := json.Marshal(k)
+		buf.Write(b)
+		buf.WriteByte(':')
+		if err := encodeValue(buf, values[k], false); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// mapKeyString returns the JSON object key of a map key k.
+func mapKeyString(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", &json.UnsupportedTypeError{Type: k.Type()}
+}
+
+// isEmptyJSONValue returns true if a field with "omitempty" option and
+// value v is omitted, as encoding/json defines it.
+func isEmptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// fieldByIndex returns a nested field of struct v. It returns false if
+// the field is in a nil embedded struct pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// decodeJSON parses JSON data into v, a pointer. Strings are accepted in
+// place of int64 and uint64 numbers, and numbers in place of strings of
+// fields with ",string" option.
+func decodeJSON(data []byte, v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || !hasInt64(t.Elem(), make(map[reflect.Type]bool)) {
+		return json.Unmarshal(data, v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil || dec.Decode(new(interface{})) != io.EOF {
+		// Let encoding/json report the error.
+		return json.Unmarshal(data, v)
+	}
+	tree, changed := normalizeJSON(tree, t.Elem(), false)
+	if changed {
+		b, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		data = b
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasInt64 returns true if values of type t may contain int64 or uint64
+// numbers, or fields with ",string" option, which normalizeJSON converts.
+func hasInt64(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	if reflect.PtrTo(t).Implements(typeOfJSONUnmarshaler) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int64, reflect.Uint64:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return hasInt64(t.Elem(), seen)
+	case reflect.Struct:
+		for _, f := range jsonFieldsOf(t) {
+			if f.quoted || hasInt64(f.typ, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeJSON converts a JSON value decoded with json.Number numbers,
+// which is parsed into a value of type t, into the form encoding/json
+// expects: int64 and uint64 strings into numbers, and numbers into strings
+// if quoted is true. It returns true if anything changed.
+func normalizeJSON(x interface{}, t reflect.Type, quoted bool) (interface{}, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(typeOfJSONUnmarshaler) {
+		return x, false
+	}
+
+	changed := false
+	switch x := x.(type) {
+	case json.Number:
+		if quoted {
+			return string(x), true
+		}
+	case string:
+		if k := t.Kind(); !quoted && (k == reflect.Int64 || k == reflect.Uint64) {
+			return json.Number(x), true
+		}
+	case []interface{}:
+		if k := t.Kind(); k != reflect.Slice && k != reflect.Array {
+			break
+		}
+		for i, item := range x {
+			var c bool
+			if x[i], c = normalizeJSON(item, t.Elem(), false); c {
+				changed = true
+			}
+		}
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for k, item := range x {
+				var c bool
+				if x[k], c = normalizeJSON(item, t.Elem(), false); c {
+					changed = true
+				}
+			}
+		case reflect.Struct:
+			fields := jsonFieldsOf(t)
+			for k, item := range x {
+				f := jsonFieldNamed(fields, k)
+				if f == nil {
+					continue
+				}
+				var c bool
+				if x[k], c = normalizeJSON(item, f.typ, f.quoted); c {
+					changed = true
+				}
+			}
+		}
+	}
+	return x, changed
+}
+
+// jsonFieldNamed returns a field given the name of a JSON object member,
+// preferring an exact match over a case-insensitive one as encoding/json
+// does, or nil.
+func jsonFieldNamed(fields []*jsonField, name string) *jsonField {
+	var fold *jsonField
+	for _, f := range fields {
+		if f.name == name {
+			return f
+		}
+		if fold == nil && strings.EqualFold(f.name, name) {
+			fold = f
+		}
+	}
+	return fold
+}
+
+// jsonField is a field of a struct as encoded by encoding/json.
+type jsonField struct {
+	name string
+	// index is the path of the field through embedded structs, see
+	// reflect.Value.FieldByIndex.
+	index     []int
+	typ       reflect.Type
+	tagged    bool
+	omitEmpty bool
+	// quoted is true for fields with ",string" option, which applies to
+	// strings, numbers and booleans.
+	quoted bool
+}
+
+// jsonFields caches encoded fields by struct type.
+var jsonFields = struct {
+	sync.RWMutex
+	m map[reflect.Type][]*jsonField
+}{m: make(map[reflect.Type][]*jsonField)}
+
+// jsonFieldsOf returns fields of struct type t encoded by encoding/json,
+// in the order of encoding.
+func jsonFieldsOf(t reflect.Type) []*jsonField {
+	jsonFields.RLock()
+	fields, ok := jsonFields.m[t]
+	jsonFields.RUnlock()
+	if ok {
+		return fields
+	}
+	fields = typeJSONFields(t)
+	jsonFields.Lock()
+	jsonFields.m[t] = fields
+	jsonFields.Unlock()
+	return fields
+}
+
+// typeJSONFields finds fields of struct type t encoded by encoding/json.
+// Fields of embedded structs without a name in "json" tag are promoted,
+// and of several fields with the same name the least nested one is encoded,
+// or the tagged one of the least nested ones. Other duplicates are omitted.
+func typeJSONFields(t reflect.Type) []*jsonField {
+	var all []*jsonField
+	current := []*jsonField{{typ: t}}
+	visited := make(map[reflect.Type]bool)
+	for len(current) > 0 {
+		var next []*jsonField
+		for _, embedded := range current {
+			st := embedded.typ
+			if visited[st] {
+				continue
+			}
+			visited[st] = true
+			for i := 0; i < st.NumField(); i++ {
+				sf := st.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.PkgPath != "" && !(sf.Anonymous && ft.Kind() == reflect.Struct) {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				opts := strings.Split(tag, ",")
+				index := append(append([]int(nil), embedded.index...), i)
+				if opts[0] == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, &jsonField{index: index, typ: ft})
+					continue
+				}
+
+				f := &jsonField{name: opts[0], index: index, typ: sf.Type, tagged: opts[0] != ""}
+				if f.name == "" {
+					f.name = sf.Name
+				}
+				for _, opt := range opts[1:] {
+					switch opt {
+					case "omitempty":
+						f.omitEmpty = true
+					case "string":
+						if k := ft.Kind(); k == reflect.Bool || k == reflect.String ||
+							reflect.Int <= k && k <= reflect.Float64 {
+							f.quoted = true
+						}
+					}
+				}
+				all = append(all, f)
+			}
+		}
+		current = next
+	}
+
+	byName := make(map[string][]*jsonField)
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	var fields []*jsonField
+	for _, fs := range byName {
+		if f := dominantField(fs); f != nil {
+			fields = append(fields, f)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
+
+// dominantField returns the encoded field of fields with the same name,
+// given in the order of depth, or nil if there's none.
+func dominantField(fields []*jsonField) *jsonField {
+	depth := len(fields[0].index)
+	var tagged, untagged []*jsonField
+	for _, f := range fields {
+		if len(f.index) > depth {
+			break
+		}
+		if f.tagged {
+			tagged = append(tagged, f)
+		} else {
+			untagged = append(untagged, f)
+		}
+	}
+	switch {
+	case len(tagged) == 1:
+		return tagged[0]
+	case len(tagged) == 0 && len(untagged) == 1:
+		return untagged[0]
+	}
+	return nil
+}
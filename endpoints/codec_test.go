@@ -0,0 +1,137 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type CodecEmbedded struct {
+	Seq  uint64 `json:"seq"`
+	Name string `json:"name"`
+}
+
+type CodecMsg struct {
+	*CodecEmbedded
+	ID       int64                  `json:"id"`
+	Name     string                 `json:"name"`
+	Parent   *int64                 `json:"parent"`
+	Children []int64                `json:"children,omitempty"`
+	Counts   map[string]uint64      `json:"counts,omitempty"`
+	Nested   *CodecMsg              `json:"nested,omitempty"`
+	Size     int                    `json:"size,string"`
+	Limit    int32                  `json:"limit"`
+	Created  time.Time              `json:"created"`
+	Data     []byte                 `json:"data,omitempty"`
+	Raw      json.RawMessage        `json:"raw,omitempty"`
+	Any      interface{}            `json:"any,omitempty"`
+	Cursor   *canMarshal            `json:"cursor,omitempty"`
+	Extra    map[string]interface{} `json:"extra,omitempty"`
+	Skipped  int64                  `json:"-"`
+	internal int64
+}
+
+func TestEncodeJSON(t *testing.T) {
+	parent := int64(math.MaxInt64)
+	tts := []struct {
+		in   interface{}
+		want string
+	}{
+		{&CodecMsg{ID: 1, Name: "a", Created: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)},
+			`{"id":"1","name":"a","parent":null,"size":"0","limit":0,"created":"2015-06-01T00:00:00Z"}`},
+		{&CodecMsg{CodecEmbedded: &CodecEmbedded{Seq: math.MaxUint64, Name: "hidden"}, Parent: &parent,
+			Children: []int64{-1, 2}, Counts: map[string]uint64{"b": 2, "a": 1}, Size: 5, Limit: 7},
+			`{"seq":"18446744073709551615","id":"0","name":"","parent":"9223372036854775807",` +
+				`"children":["-1","2"],"counts":{"a":"1","b":"2"},"size":"5","limit":7,"created":"0001-01-01T00:00:00Z"}`},
+		{&CodecMsg{Nested: &CodecMsg{ID: 2}, Data: []byte("hi"), Raw: json.RawMessage(`{"x":1}`),
+			Any: int64(3), Extra: map[string]interface{}{"n": uint64(4), "s": "t"},
+			Skipped: 5, internal: 6},
+			`{"id":"0","name":"","parent":null,"nested":{"id":"2","name":"","parent":null,"size":"0","limit":0,` +
+				`"created":"0001-01-01T00:00:00Z"},"size":"0","limit":0,"created":"0001-01-01T00:00:00Z",` +
+				`"data":"aGk=","raw":{"x":1},"any":3,"extra":{"n":4,"s":"t"}}`},
+		{&CodecMsg{Any: &CodecEmbedded{Seq: math.MaxUint64}, Extra: map[string]interface{}{"m": map[string]int64{"x": -1}}},
+			`{"id":"0","name":"","parent":null,"size":"0","limit":0,"created":"0001-01-01T00:00:00Z",` +
+				`"any":{"seq":18446744073709551615,"name":""},"extra":{"m":{"x":-1}}}`},
+		{[]interface{}{int64(1), map[int]int64{2: 3}, nil}, `[1,{"2":3},null]`},
+		{[]map[int]int64{{2: 3}}, `[{"2":"3"}]`},
+		{map[string]*CodecEmbedded{"e": {Seq: 1}}, `{"e":{"seq":"1","name":""}}`},
+	}
+	for i, tt := range tts {
+		var buf bytes.Buffer
+		if err := encodeJSON(&buf, tt.in); err != nil {
+			t.Errorf("%d: encodeJSON(%+v) = %v", i, tt.in, err)
+			continue
+		}
+		if out := buf.String(); out != tt.want+"\n" {
+			t.Errorf("%d: encodeJSON(%+v) =\n%s\nwant\n%s", i, tt.in, out, tt.want)
+		}
+	}
+}
+
+func TestEncodeJSONAsEncodingJSON(t *testing.T) {
+	type inner struct {
+		A string `json:"a"`
+		B bool   `json:"b"`
+	}
+	type Conflict struct {
+		A string
+	}
+	type msg struct {
+		inner
+		Conflict
+		A       string            `json:"a"`
+		C       float64           `json:"c,omitempty"`
+		D       *float32          `json:"d,string"`
+		E       bool              `json:",string"`
+		Tags    []string          `json:"tags"`
+		Nested  [2]inner          `json:"nested"`
+		Byte    map[string][]byte `json:"byte"`
+		Escaped string            `json:"escaped"`
+	}
+	f := float32(1.5)
+	in := &msg{inner: inner{A: "inner", B: true}, Conflict: Conflict{A: "conflict"}, A: "outer",
+		D: &f, Tags: []string{"x"}, Byte: map[string][]byte{"k": []byte("v")}, Escaped: "<a & b>"}
+
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, in); err != nil {
+		t.Fatalf("encodeJSON(%+v) = %v", in, err)
+	}
+	want, _ := json.Marshal(in)
+	if out := buf.String(); out != string(want)+"\n" {
+		t.Errorf("encodeJSON(%+v) =\n%s\nwant\n%s", in, out, want)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tts := []struct {
+		in   string
+		want *CodecMsg
+	}{
+		{`{"id":"1","parent":"-2","children":["3",4],"counts":{"a":"5"},"size":6,"limit":7}`,
+			&CodecMsg{ID: 1, Parent: func() *int64 { x := int64(-2); return &x }(), Children: []int64{3, 4},
+				Counts: map[string]uint64{"a": 5}, Size: 6, Limit: 7}},
+		{`{"ID":2,"seq":"18446744073709551615","nested":{"id":"3","size":"4"}}`,
+			&CodecMsg{ID: 2, CodecEmbedded: &CodecEmbedded{Seq: math.MaxUint64}, Nested: &CodecMsg{ID: 3, Size: 4}}},
+		{`{"raw":{"id":"1"},"any":"2","cursor":"x y"}`,
+			&CodecMsg{Raw: json.RawMessage(`{"id":"1"}`), Any: "2", Cursor: &canMarshal{`y"`}}},
+	}
+	for i, tt := range tts {
+		out := &CodecMsg{}
+		if err := decodeJSON([]byte(tt.in), out); err != nil {
+			t.Errorf("%d: decodeJSON(%s) = %v", i, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("%d: decodeJSON(%s) = %+v; want %+v", i, tt.in, out, tt.want)
+		}
+	}
+
+	for _, in := range []string{`{"id":"x"}`, `{"id":"1.5"}`, `{"id":"1"} {}`, `{"id":`, `{"limit":"1"}`} {
+		if err := decodeJSON([]byte(in), &CodecMsg{}); err == nil {
+			t.Errorf("decodeJSON(%s) = nil; want error", in)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DiscoveryDoc is a Google API Discovery document (REST description)
+// of a single API, as served at
+// /_ah/api/discovery/v1/apis/{name}/{version}/rest.
+//
+// See https://developers.google.com/discovery/v1/reference/apis.
+type DiscoveryDoc struct {
+	Kind             string                        `json:"kind"`
+	DiscoveryVersion string                        `json:"discoveryVersion"`
+	ID               string                        `json:"id"`
+	Name             string                        `json:"name"`
+	Version          string                        `json:"version"`
+	Desc             string                        `json:"description,omitempty"`
+	Icons            map[string]string             `json:"icons"`
+	Protocol         string                        `json:"protocol"`
+	RootURL          string                        `json:"rootUrl"`
+	ServicePath      string                        `json:"servicePath"`
+	BaseURL          string                        `json:"baseUrl"`
+	BasePath         string                        `json:"basePath"`
+	BatchPath        string                        `json:"batchPath,omitempty"`
+	Parameters       map[string]*DiscoveryParam    `json:"parameters"`
+	Auth             *DiscoveryAuth                `json:"auth,omitempty"`
+	Schemas          map[string]*DiscoverySchema   `json:"schemas,omitempty"`
+	Methods          map[string]*DiscoveryMethod   `json:"methods,omitempty"`
+	Resources        map[string]*DiscoveryResource `json:"resources,omitempty"`
+}
+
+// DiscoveryAuth describes OAuth 2.0 scopes used by an API.
+type DiscoveryAuth struct {
+	OAuth2 struct {
+		Scopes map[string]*DiscoveryScope `json:"scopes"`
+	} `json:"oauth2"`
+}
+
+// DiscoveryScope is an item of DiscoveryAuth scopes map.
+type DiscoveryScope struct {
+	Desc string `json:"description"`
+}
+
+// DiscoveryResource groups methods and nested resources, e.g. "greets" in
+// "greets.list" method name.
+type DiscoveryResource struct {
+	Methods   map[string]*DiscoveryMethod   `json:"methods,omitempty"`
+	Resources map[string]*DiscoveryResource `json:"resources,omitempty"`
+}
+
+// DiscoveryMethod describes a single API method.
+type DiscoveryMethod struct {
+	ID             string                     `json:"id"`
+	Path           string                     `json:"path"`
+	HTTPMethod     string                     `json:"httpMethod"`
+	Desc           string                     `json:"description,omitempty"`
+	Parameters     map[string]*DiscoveryParam `json:"parameters,omitempty"`
+	ParameterOrder []string                   `json:"parameterOrder,omitempty"`
+	Request        *DiscoveryRef              `json:"request,omitempty"`
+	Response       *DiscoveryRef              `json:"response,omitempty"`
+	Scopes         []string                   `json:"scopes,omitempty"`
+}
+
+// DiscoveryRef references a schema from a method request or response.
+type DiscoveryRef struct {
+	Ref           string `json:"$ref"`
+	ParameterName string `json:"parameterName,omitempty"`
+}
+
+// DiscoveryParam describes a method (or API-wide) parameter.
+type DiscoveryParam struct {
+	Type      string   `json:"type"`
+	Format    string   `json:"format,omitempty"`
+	Desc      string   `json:"description,omitempty"`
+	Location  string   `json:"location"`
+	Required  bool     `json:"required,omitempty"`
+	Repeated  bool     `json:"repeated,omitempty"`
+	Default   string   `json:"default,omitempty"`
+	Min       string   `json:"minimum,omitempty"`
+	Max       string   `json:"maximum,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Enum      []string `json:"enum,omitempty"`
+	EnumDescs []string `json:"enumDescriptions,omitempty"`
+}
+
+// DiscoverySchema is a JSON schema of a type, or of one of its properties.
+type DiscoverySchema struct {
+	ID         string                      `json:"id,omitempty"`
+	Type       string                      `json:"type,omitempty"`
+	Format     string                      `json:"format,omitempty"`
+	Desc       string                      `json:"description,omitempty"`
+	Ref        string                      `json:"$ref,omitempty"`
+	Items      *DiscoverySchema            `json:"items,omitempty"`
+	Properties map[string]*DiscoverySchema `json:"properties,omitempty"`
+	Required   bool                        `json:"required,omitempty"`
+	Default    string                      `json:"default,omitempty"`
+	Min        string                      `json:"minimum,omitempty"`
+	Max        string                      `json:"maximum,omitempty"`
+	Pattern    string                      `json:"pattern,omitempty"`
+	Enum       []string                    `json:"enum,omitempty"`
+	EnumDescs  []string                    `json:"enumDescriptions,omitempty"`
+	// AdditionalProperties describes values of a map.
+	AdditionalProperties *DiscoverySchema `json:"additionalProperties,omitempty"`
+}
+
+// DiscoveryDirectoryList is the list of APIs served at
+// /_ah/api/discovery/v1/apis.
+type DiscoveryDirectoryList struct {
+	Kind             string                    `json:"kind"`
+	DiscoveryVersion string                    `json:"discoveryVersion"`
+	Items            []*DiscoveryDirectoryItem `json:"items"`
+}
+
+// DiscoveryDirectoryItem is an item of DiscoveryDirectoryList.
+type DiscoveryDirectoryItem struct {
+	Kind             string            `json:"kind"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Version          string            `json:"version"`
+	Desc             string            `json:"description,omitempty"`
+	DiscoveryRestURL string            `json:"discoveryRestUrl"`
+	DiscoveryLink    string            `json:"discoveryLink"`
+	Icons            map[string]string `json:"icons"`
+	Preferred        bool              `json:"preferred"`
+}
+
+var (
+	discoveryIcons = map[string]string{
+		"x16": "https://www.gstatic.com/images/branding/product/1x/googleg_16dp.png",
+		"x32": "https://www.gstatic.com/images/branding/product/1x/googleg_32dp.png",
+	}
+
+	// discoveryStdParams are query parameters common to all API methods.
+	// Only those the server honors are listed: responses are always JSON.
+	discoveryStdParams = map[string]*DiscoveryParam{
+		"alt": {Type: "string", Location: "query", Default: "json",
+			Desc: "Data format for the response.",
+			Enum: []string{"json"}, EnumDescs: []string{"Responses with Content-Type of application/json"}},
+	}
+)
+
+// newDiscoveryStdParams returns a copy of discoveryStdParams, which
+// the caller may modify.
+func newDiscoveryStdParams() map[string]*DiscoveryParam {
+	params := make(map[string]*DiscoveryParam, len(discoveryStdParams))
+	for name, p := range discoveryStdParams {
+		cp := *p
+		params[name] = &cp
+	}
+	return params
+}
+
+// newDiscoveryIcons returns a copy of discoveryIcons.
+func newDiscoveryIcons() map[string]string {
+	icons := make(map[string]string, len(discoveryIcons))
+	for k, v := range discoveryIcons {
+		icons[k] = v
+	}
+	return icons
+}
+
+// DiscoveryDoc populates provided DiscoveryDoc with a REST description of
+// its receiver.
+//
+// Args:
+//   - dst, a non-nil pointer to DiscoveryDoc struct
+//   - host, a hostname used for the document's root URL.
+//
+// The document is built from the same data as APIDescriptor and the same
+// errors are returned.
+func (s *RPCService) DiscoveryDoc(dst *DiscoveryDoc, host string) error {
+	if dst == nil {
+		return errors.New("Destination DiscoveryDoc is nil")
+	}
+	if host == "" {
+		return errors.New("Empty host parameter")
+	}
+	return newDiscoveryDoc(dst, []*RPCService{s}, host, apiRootURL(host, defaultAPIRoot, false))
+}
+
+// newDiscoveryDoc populates dst with a REST description of services.
+// All services are expected to have the same API name and version.
+func newDiscoveryDoc(dst *DiscoveryDoc, services []*RPCService, host, rootURL string) error {
+	info := services[0].Info()
+	dst.Kind = "discovery#restDescription"
+	dst.DiscoveryVersion = "v1"
+	dst.ID = info.Name + ":" + info.Version
+	dst.Name = info.Name
+	dst.Version = info.Version
+	dst.Desc = info.Description
+	dst.Icons = newDiscoveryIcons()
+	dst.Protocol = "rest"
+	dst.RootURL = rootURL
+	dst.ServicePath = info.Name + "/" + info.Version + "/"
+	dst.BaseURL = rootURL + dst.ServicePath
+	dst.BasePath = strings.TrimPrefix(dst.BaseURL, hostURL(rootURL))
+	dst.Parameters = newDiscoveryStdParams()
+	dst.Schemas = make(map[string]*DiscoverySchema)
+	dst.Methods = make(map[string]*DiscoveryMethod)
+	dst.Resources = make(map[string]*DiscoveryResource)
+
+	scopes := make(map[string]*DiscoveryScope)
+	types := make(schemaTypes)
+	for _, s := range services {
+		d := &APIDescriptor{}
+		if err := s.APIDescriptor(d, host); err != nil {
+			return err
+		}
+		if err := types.addSchemas(d.Descriptor.Schemas); err != nil {
+			return err
+		}
+		for ref, sd := range d.Descriptor.Schemas {
+			dst.Schemas[ref] = discoverySchema(sd)
+		}
+		for name, apim := range d.Methods {
+			if _, exists := dst.Methods[name]; exists {
+				return fmt.Errorf("Method %q already exists", name)
+			}
+			m, err := discoveryMethod(name, apim, d.Descriptor.Methods[apim.RosyMethod])
+			if err != nil {
+				return err
+			}
+			for _, scope := range m.Scopes {
+				scopes[scope] = &DiscoveryScope{Desc: scope}
+			}
+			if err := addDiscoveryMethod(dst, strings.TrimPrefix(name, d.Name+"."), m); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(scopes) > 0 {
+		dst.Auth = &DiscoveryAuth{}
+		dst.Auth.OAuth2.Scopes = scopes
+	}
+	return nil
+}
+
+// addDiscoveryMethod adds m to the methods of dst or one of its (nested)
+// resources, depending on the dotted method name, e.g. "greets.list".
+func addDiscoveryMethod(dst *DiscoveryDoc, name string, m *DiscoveryMethod) error {
+	parts := strings.Split(name, ".")
+	methods, resources := dst.Methods, dst.Resources
+	for _, p := range parts[:len(parts)-1] {
+		res := resources[p]
+		if res == nil {
+			res = &DiscoveryResource{
+				Methods:   make(map[string]*DiscoveryMethod),
+				Resources: make(map[string]*DiscoveryResource),
+			}
+			resources[p] = res
+		}
+		methods, resources = res.Methods, res.Resources
+	}
+	mname := parts[len(parts)-1]
+	if _, exists := methods[mname]; exists {
+		return fmt.Errorf("Method %q already exists", m.ID)
+	}
+	methods[mname] = m
+	return nil
+}
+
+// discoveryMethod creates a DiscoveryMethod from APIMethod and its
+// schema descriptor.
+func discoveryMethod(id string, apim *APIMethod, md *APIMethodDescriptor) (
+	*DiscoveryMethod, error) {
+
+	m := &DiscoveryMethod{
+		ID:         id,
+		Path:       apim.Path,
+		HTTPMethod: apim.HTTPMethod,
+		Desc:       apim.Desc,
+		Scopes:     apim.Scopes,
+	}
+
+	pathParams, err := parsePath(apim.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(apim.Request.Params) > 0 {
+		m.Parameters = make(map[string]*DiscoveryParam, len(apim.Request.Params))
+	}
+	for name, spec := range apim.Request.Params {
+		p := discoveryParam(spec)
+		p.Location = "query"
+		for _, pp := range pathParams {
+			if pp == name {
+				p.Location = "path"
+				break
+			}
+		}
+		m.Parameters[name] = p
+	}
+	// Path parameters come first, in the order they appear in the path,
+	// followed by other required parameters sorted by name.
+	var required []string
+	for name, p := range m.Parameters {
+		if p.Required && p.Location != "path" {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	m.ParameterOrder = append(pathParams, required...)
+
+	if md != nil && md.Request != nil {
+		m.Request = &DiscoveryRef{Ref: md.Request.Ref, ParameterName: "resource"}
+	}
+	if md != nil && md.Response != nil {
+		m.Response = &DiscoveryRef{Ref: md.Response.Ref}
+	}
+	return m, nil
+}
+
+// discoveryParam converts APIRequestParamSpec into a DiscoveryParam
+// (without location).
+func discoveryParam(spec *APIRequestParamSpec) *DiscoveryParam {
+	p := &DiscoveryParam{
+		Required: spec.Required,
+		Repeated: spec.Repeated,
+		Default:  discoveryValue(spec.Default),
+		Min:      discoveryValue(spec.Min),
+		Max:      discoveryValue(spec.Max),
+		Pattern:  spec.Pattern,
+	}
+	p.Type, p.Format = paramTypeToPropFormat(spec.Type)
+	if len(spec.Enum) > 0 {
+		for name := range spec.Enum {
+			p.Enum = append(p.Enum, name)
+		}
+		sort.Strings(p.Enum)
+		for _, name := range p.Enum {
+			p.EnumDescs = append(p.EnumDescs, spec.Enum[name].Desc)
+		}
+	}
+	return p
+}
+
+// discoverySchema converts APISchemaDescriptor into a DiscoverySchema.
+func discoverySchema(sd *APISchemaDescriptor) *DiscoverySchema {
+	ds := &DiscoverySchema{
+		ID:         sd.ID,
+		Type:       sd.Type,
+		Desc:       sd.Desc,
+		Properties: make(map[string]*DiscoverySchema, len(sd.Properties)),
+	}
+	for name, prop := range sd.Properties {
+		ds.Properties[name] = discoveryProperty(prop)
+	}
+	return ds
+}
+
+// discoveryProperty converts APISchemaProperty into a DiscoverySchema.
+func discoveryProperty(prop *APISchemaProperty) *DiscoverySchema {
+	ds := &DiscoverySchema{
+		Type:      prop.Type,
+		Format:    prop.Format,
+		Desc:      prop.Desc,
+		Ref:       prop.Ref,
+		Required:  prop.Required,
+		Default:   discoveryValue(prop.Default),
+		Min:       discoveryValue(prop.Min),
+		Max:       discoveryValue(prop.Max),
+		Pattern:   prop.Pattern,
+		Enum:      prop.Enum,
+		EnumDescs: prop.EnumDescs,
+	}
+	if prop.Items != nil {
+		ds.Items = discoveryProperty(prop.Items)
+	}
+	if prop.AdditionalProperties != nil {
+		ds.AdditionalProperties = discoveryProperty(prop.AdditionalProperties)
+	}
+	return ds
+}
+
+// discoveryValue formats v as a string, which is how Discovery documents
+// represent default, min and max values. It returns "" if v is nil.
+func discoveryValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// paramTypeToPropFormat converts APIRequestParamSpec type into a pair of
+// (type, format) as used by schema properties, see typeToPropFormat.
+func paramTypeToPropFormat(t string) (string, string) {
+	switch t {
+	case "int32", "uint32":
+		return "integer", t
+	case "int64", "uint64":
+		return "string", t
+	case "float", "double":
+		return "number", t
+	case "bytes":
+		return "string", "byte"
+	}
+	return t, ""
+}
+
+// apiRootURL returns an absolute URL of the API root on host, e.g.
+// "https://host/_ah/api/". Plain HTTP is used for a local dev server unless
+// secure is true.
+func apiRootURL(host, apiRoot string, secure bool) string {
+	scheme := "https"
+	if !secure && isLocalHost(host) {
+		scheme = "http"
+	}
+	return scheme + "://" + host + "/" + strings.Trim(apiRoot, "/") + "/"
+}
+
+// hostURL returns "scheme://host" part of an absolute URL u.
+func hostURL(u string) string {
+	i := strings.Index(u, "://")
+	if i < 0 {
+		return ""
+	}
+	if j := strings.IndexRune(u[i+3:], '/'); j >= 0 {
+		return u[:i+3+j]
+	}
+	return u
+}
+
+// isLocalHost returns true if host (with an optional port) is a loopback
+// address or "localhost".
+func isLocalHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveDiscovery serves discovery documents at path, relative to the
+// discovery root: "apis" for the directory list and
+// "apis/{name}/{version}/rest" for a single API.
+func (s *Server) serveDiscovery(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Method != "GET" {
+		writeError(w, NewAPIError(http.StatusText(http.StatusMethodNotAllowed),
+			fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed))
+		return
+	}
+
+	rootURL := apiRootURL(r.Host, s.apiRoot, r.TLS != nil)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	var (
+		doc interface{}
+		err error
+	)
+	switch {
+	case len(parts) == 1 && parts[0] == "apis":
+		doc = s.discoveryDirectory(rootURL, r.FormValue("name"), r.FormValue("preferred") == "true")
+	case len(parts) == 4 && parts[0] == "apis" && parts[3] == "rest":
+		services := s.services.servicesByAPI(parts[1], parts[2])
+		if len(services) == 0 {
+			err = NewNotFoundError("API %s %s not found", parts[1], parts[2])
+			break
+		}
+		d := &DiscoveryDoc{}
+		err = newDiscoveryDoc(d, services, r.Host, rootURL)
+		doc = d
+	default:
+		err = NewNotFoundError("no discovery document at %q", path)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		writeError(w, err)
+	}
+}
+
+// discoveryDirectory creates a list of all registered APIs, optionally
+// filtered by name and preferred (default) version.
+func (s *Server) discoveryDirectory(rootURL, name string, preferred bool) *DiscoveryDirectoryList {
+	list := &DiscoveryDirectoryList{
+		Kind:             "discovery#directoryList",
+		DiscoveryVersion: "v1",
+		Items:            []*DiscoveryDirectoryItem{},
+	}
+	seen := make(map[string]bool)
+	for _, svc := range s.services.publicServices() {
+		info := svc.Info()
+		id := info.Name + ":" + info.Version
+		if seen[id] || (name != "" && info.Name != name) || (preferred && !info.Default) {
+			continue
+		}
+		seen[id] = true
+		path := "apis/" + info.Name + "/" + info.Version + "/rest"
+		list.Items = append(list.Items, &DiscoveryDirectoryItem{
+			Kind:             "discovery#directoryItem",
+			ID:               id,
+			Name:             info.Name,
+			Version:          info.Version,
+			Desc:             info.Description,
+			DiscoveryRestURL: rootURL + "discovery/v1/" + path,
+			DiscoveryLink:    "./" + path,
+			Icons:            newDiscoveryIcons(),
+			Preferred:        info.Default,
+		})
+	}
+	sort.Sort(directoryItems(list.Items))
+	return list
+}
+
+// directoryItems sorts DiscoveryDirectoryItem by ID.
+type directoryItems []*DiscoveryDirectoryItem
+
+func (d directoryItems) Len() int           { return len(d) }
+func (d directoryItems) Less(i, j int) bool { return d[i].ID < d[j].ID }
+func (d directoryItems) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
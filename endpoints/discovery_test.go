@@ -0,0 +1,257 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"appengine/aetest"
+)
+
+// createDiscoveryDoc creates DiscoveryDoc for DummyService.
+func createDiscoveryDoc(t *testing.T) *DiscoveryDoc {
+	server := createDummyServer(t)
+	d := &DiscoveryDoc{}
+	if err := server.ServiceByName("DummyService").DiscoveryDoc(d, "testhost:1234"); err != nil {
+		t.Fatalf("createDiscoveryDoc: error creating discovery doc: %v", err)
+	}
+	return d
+}
+
+// createDummyServer creates a Server with DummyService registered and
+// configured the same way as in createDescriptor.
+func createDummyServer(t *testing.T) *Server {
+	server := NewServer("")
+	s, err := server.RegisterService(&DummyService{}, "Dummy", "v1", "A service", true)
+	if err != nil {
+		t.Fatalf("createDummyServer: error registering service: %v", err)
+	}
+
+	info := s.MethodByName("Post").Info()
+	info.Name, info.Path, info.HTTPMethod, info.Desc =
+		"post", "post/{i}/{bool_field}/{Float64}", "POST", "A POST method"
+
+	info = s.MethodByName("PutAuth").Info()
+	info.Name, info.Path, info.HTTPMethod, info.Desc =
+		"auth", "auth", "PUT", "Method with auth"
+	info.ClientIds, info.Scopes, info.Audiences =
+		clientIDs, scopes, audiences
+
+	info = s.MethodByName("GetSub").Info()
+	info.Name, info.Path, info.HTTPMethod, info.Desc =
+		"sub.sub", "sub/{simple}/{msg.i}/{msg.str}", "GET", "With substruct"
+
+	info = s.MethodByName("GetList").Info()
+	info.Name, info.Path, info.HTTPMethod, info.Desc =
+		"list", "list", "GET", "Messages list"
+	return server
+}
+
+func TestDiscoveryDoc(t *testing.T) {
+	d := createDiscoveryDoc(t)
+	verifyPairs(t,
+		d.Kind, "discovery#restDescription",
+		d.DiscoveryVersion, "v1",
+		d.ID, "dummy:v1",
+		d.Name, "dummy",
+		d.Version, "v1",
+		d.Desc, "A service",
+		d.Protocol, "rest",
+		d.RootURL, "https://testhost:1234/_ah/api/",
+		d.ServicePath, "dummy/v1/",
+		d.BaseURL, "https://testhost:1234/_ah/api/dummy/v1/",
+		d.BasePath, "/_ah/api/dummy/v1/",
+		len(d.Methods), 3,
+		len(d.Resources), 1,
+		len(d.Schemas), 3,
+		len(d.Auth.OAuth2.Scopes), 2,
+	)
+	for _, s := range scopes {
+		if d.Auth.OAuth2.Scopes[s] == nil {
+			t.Errorf("want scope %q in %v", s, d.Auth.OAuth2.Scopes)
+		}
+	}
+
+	// Only parameters the server honors are advertised, and no batch path.
+	verifyPairs(t,
+		d.BatchPath, "",
+		len(d.Parameters), 1,
+		d.Parameters["alt"].Default, "json",
+	)
+
+	// Modifying a document must not affect the next ones.
+	d.Parameters["alt"].Default = "proto"
+	d.Parameters["extra"] = &DiscoveryParam{}
+	d.Icons["x16"] = "changed"
+	d = createDiscoveryDoc(t)
+	verifyPairs(t,
+		len(d.Parameters), 1,
+		d.Parameters["alt"].Default, "json",
+		d.Icons["x16"], discoveryIcons["x16"],
+	)
+}
+
+func TestDiscoveryMethods(t *testing.T) {
+	d := createDiscoveryDoc(t)
+
+	post := d.Methods["post"]
+	if post == nil {
+		t.Fatalf("want method 'post' in %v", d.Methods)
+	}
+	verifyPairs(t,
+		post.ID, "dummy.post",
+		post.Path, "post/{i}/{bool_field}/{Float64}",
+		post.HTTPMethod, "POST",
+		post.Desc, "A POST method",
+		post.ParameterOrder, []string{"i", "bool_field", "Float64"},
+		post.Request, &DiscoveryRef{Ref: "DummyMsg", ParameterName: "resource"},
+		post.Response, &DiscoveryRef{Ref: "DummySubMsg"},
+		post.Parameters["i"], &DiscoveryParam{
+			Type: "integer", Format: "int32", Location: "path", Required: true,
+			Default: "-100", Min: "-200", Max: "200"},
+		post.Parameters["Float64"], &DiscoveryParam{
+			Type: "number", Format: "double", Location: "path", Required: true,
+			Default: "123.456"},
+	)
+
+	auth := d.Methods["auth"]
+	if auth == nil {
+		t.Fatalf("want method 'auth' in %v", d.Methods)
+	}
+	verifyPairs(t,
+		auth.Scopes, scopes,
+		auth.Response, (*DiscoveryRef)(nil),
+		len(auth.Parameters), 0,
+	)
+
+	sub := d.Resources["sub"]
+	if sub == nil || sub.Methods["sub"] == nil {
+		t.Fatalf("want resource 'sub' with method 'sub' in %v", d.Resources)
+	}
+	get := sub.Methods["sub"]
+	verifyPairs(t,
+		get.ID, "dummy.sub.sub",
+		get.Request, (*DiscoveryRef)(nil),
+		get.ParameterOrder, []string{"simple", "msg.i", "msg.str"},
+		get.Parameters["msg.Int64"], &DiscoveryParam{
+			Type: "string", Format: "int64", Location: "query", Default: "123"},
+		get.Parameters["msg.Bytes"], &DiscoveryParam{
+			Type: "string", Format: "byte", Location: "query"},
+	)
+}
+
+func TestDiscoverySchemas(t *testing.T) {
+	d := createDiscoveryDoc(t)
+
+	list := d.Schemas["DummyListMsg"]
+	if list == nil {
+		t.Fatalf("want schema 'DummyListMsg' in %v", d.Schemas)
+	}
+	want := &DiscoverySchema{Type: "array", Items: &DiscoverySchema{Ref: "DummyMsg"}}
+	if !reflect.DeepEqual(list.Properties["items"], want) {
+		t.Errorf("DummyListMsg.items = %#v; want %#v", list.Properties["items"], want)
+	}
+
+	msg := d.Schemas["DummyMsg"]
+	if msg == nil {
+		t.Fatalf("want schema 'DummyMsg' in %v", d.Schemas)
+	}
+	verifyPairs(t,
+		msg.ID, "DummyMsg",
+		msg.Type, "object",
+		msg.Properties["str"], &DiscoverySchema{Type: "string", Required: true, Desc: "A string field"},
+		msg.Properties["Uint64"], &DiscoverySchema{Type: "string", Format: "uint64", Default: "123"},
+	)
+}
+
+func TestDiscoveryConstraints(t *testing.T) {
+	prop := &APISchemaProperty{Type: "string", Pattern: "^[a-z]+$", MaxLength: 10, Enum: []string{"a", "b"}}
+	param := &APIRequestParamSpec{Type: "string", Pattern: "^[a-z]+$",
+		Enum: map[string]*APIEnumParamSpec{"b": {BackendVal: "b"}, "a": {BackendVal: "a"}}}
+	verifyPairs(t,
+		discoveryProperty(prop), &DiscoverySchema{Type: "string", Pattern: "^[a-z]+$", Enum: []string{"a", "b"}},
+		discoveryParam(param), &DiscoveryParam{Type: "string", Pattern: "^[a-z]+$",
+			Enum: []string{"a", "b"}, EnumDescs: []string{"", ""}},
+	)
+}
+
+func TestDiscoveryEnumDescriptions(t *testing.T) {
+	prop := &APISchemaProperty{Type: "string", Enum: []string{"a", "b"}, EnumDescs: []string{"First", ""}}
+	want := &DiscoverySchema{Type: "string", Enum: []string{"a", "b"}, EnumDescs: []string{"First", ""}}
+	if ds := discoveryProperty(prop); !reflect.DeepEqual(ds, want) {
+		t.Errorf("discoveryProperty(%+v) = %+v; want %+v", prop, ds, want)
+	}
+}
+
+func TestDiscoveryMapProperty(t *testing.T) {
+	prop := &APISchemaProperty{Type: "object", AdditionalProperties: &APISchemaProperty{
+		Type: "array", Items: &APISchemaProperty{Type: "any"}}}
+	want := &DiscoverySchema{Type: "object", AdditionalProperties: &DiscoverySchema{
+		Type: "array", Items: &DiscoverySchema{Type: "any"}}}
+	if ds := discoveryProperty(prop); !reflect.DeepEqual(ds, want) {
+		t.Errorf("discoveryProperty(%+v) = %+v; want %+v", prop, ds, want)
+	}
+}
+
+func TestIsLocalHost(t *testing.T) {
+	verifyPairs(t,
+		isLocalHost("localhost"), true,
+		isLocalHost("localhost:8080"), true,
+		isLocalHost("127.0.0.1:8080"), true,
+		isLocalHost("[::1]:8080"), true,
+		isLocalHost("example.org"), false,
+		isLocalHost("10.0.0.1:8080"), false,
+	)
+}
+
+func TestServeDiscovery(t *testing.T) {
+	server := createDummyServer(t)
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/_ah/api/discovery/v1/apis", http.StatusOK},
+		{"GET", "/_ah/api/discovery/v1/apis/dummy/v1/rest", http.StatusOK},
+		{"GET", "/_ah/api/discovery/v1/apis/dummy/v2/rest", http.StatusNotFound},
+		{"GET", "/_ah/api/discovery/v1/apis/dummy/v1/rpc", http.StatusNotFound},
+		{"POST", "/_ah/api/discovery/v1/apis", http.StatusMethodNotAllowed},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest(tt.method, tt.path, nil)
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		r.Host = "localhost:8080"
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s w.Code = %d; want %d", i, tt.method, tt.path, w.Code, tt.code)
+		}
+	}
+
+	r, _ := inst.NewRequest("GET", "/_ah/api/discovery/v1/apis", nil)
+	r.Host = "localhost:8080"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	var list DiscoveryDirectoryList
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode directory list: %v", err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("len(list.Items) = %d; want 1", len(list.Items))
+	}
+	verifyPairs(t,
+		list.Items[0].ID, "dummy:v1",
+		list.Items[0].DiscoveryRestURL, "http://localhost:8080/_ah/api/discovery/v1/apis/dummy/v1/rest",
+		list.Items[0].DiscoveryLink, "./apis/dummy/v1/rest",
+		list.Items[0].Preferred, true,
+	)
+}
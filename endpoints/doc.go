@@ -88,15 +88,154 @@ Don't forget to add URL matching in app.yaml:
 	  script: _go_app
 
 	# Important! Even though there's a catch all routing above,
-	# without these two lines it's not going to work.
+	# without these lines it's not going to work.
 	# Make sure you have this:
 	- url: /_ah/spi/.*
 	  script: _go_app
+	- url: /_ah/api/.*
+	  script: _go_app
 
 That's it. It is time to start dev server and enjoy the discovery doc:
 http://localhost:8080/_ah/api/explorer
 
 
+REST requests
+
+Besides SPI calls, a Server serves the REST surface of every registered API
+under /_ah/api/{name}/{version}/{path}. A request is matched against
+HTTPMethod and Path of the API methods; path placeholders, query parameters
+and the JSON body (except for GET and DELETE) are bound to the method's
+request type, using JSON field names. Nested fields are addressed with dotted
+names. For instance, with the greeting API above:
+
+	GET /_ah/api/greeting/v1/greetings?limit=5
+
+calls GreetingService.List with GreetingsListReq{Limit: 5}. Methods without
+a response reply with 204 No Content.
+
+The same methods are available through the JSON-RPC 2.0 transport at
+/_ah/api/rpc, used by Google API client libraries. A call addresses a method
+as "{api}.{name}", e.g. "greeting.greets.list", with an optional apiVersion.
+A batch of up to 100 calls, sent as a JSON array, is executed concurrently
+and responses are returned in the same order. Each call sees its own copy of
+the HTTP request. Errors returned by a method are reported with their HTTP
+status code, e.g. 404.
+
+Discovery documents of the registered APIs are served at
+
+	GET /_ah/api/discovery/v1/apis
+	GET /_ah/api/discovery/v1/apis/{name}/{version}/rest
+
+The former lists all public APIs, the latter is a Discovery REST description
+that client library generators and the API Explorer understand. The same
+document can be built with RPCService.DiscoveryDoc.
+
+RPCService.OpenAPI and Server.OpenAPI describe the same REST surface as an
+OpenAPI 3.0 document, in JSON or, with OpenAPIDoc.YAML, in YAML format.
+Scopes, Audiences and ClientIds of the methods are turned into security
+schemes with x-google-auth settings understood by Cloud Endpoints and
+API Gateway.
+
+
+Interceptors
+
+Calls of service methods, both SPI and REST, can be wrapped with
+interceptors, e.g. to measure them or to serve cached responses:
+
+	server.Use(func(c context.Context, call *endpoints.MethodCall, next endpoints.Invoker) (interface{}, error) {
+	  start := time.Now()
+	  resp, err := next(c, call)
+	  log.Infof(c, "%s took %v", call.Method.Info().Name, time.Since(start))
+	  return resp, err
+	})
+
+An interceptor sees the resolved service and method, the decoded request
+and whatever the method returns. Interceptors added with Server.Use wrap
+those added to a single method with ServiceMethod.Use.
+
+
+ID tokens
+
+CurrentUser accepts Google ID tokens issued to the audiences and client IDs
+it is given. ID tokens of other providers, e.g. Firebase Authentication or
+an OpenID Connect provider, are accepted once they are configured as issuers
+of the API:
+
+	api.Info().Issuers = map[string]*endpoints.Issuer{
+	  "firebase": endpoints.FirebaseIssuer("my-project"),
+	  "corp": {
+	    Issuer:    "https://sso.example.com",
+	    JWKSURI:   "https://sso.example.com/.well-known/jwks.json",
+	    Audiences: []string{"my-api"},
+	  },
+	}
+
+Methods trust all the issuers of their API, unless they name some of them:
+
+	api.MethodByName("Delete").Info().Issuers = []string{"corp"}
+
+Tokens must be signed with a key of the issuer's JSON Web Key Set and issued
+to one of its audiences. The key sets are cached by the platform's Cache
+and fetched again when a token is signed with an unknown key. RSA keys sign
+with RS256, RS384, RS512, PS256, PS384 or PS512, and EC keys with ES256,
+ES384 or ES512. Unsigned tokens and HMAC algorithms are always rejected.
+
+CurrentPrincipal returns the caller with all the verified claims of its
+token, including custom ones, instead of an App Engine user:
+
+	p, err := endpoints.CurrentPrincipal(c, scopes, audiences, clientIDs)
+	if err != nil {
+	  return endpoints.UnauthorizedError
+	}
+	role, _ := p.Claims["role"].(string)
+
+Bearer tokens are described by the same claims when the Authenticator of the
+platform implements PrincipalAuthenticator, as the tokeninfo one of the
+standard platform does. The App Engine one only knows what the OAuth API
+reports: "sub", "email", "azp" and "scope" claims, and no expiration time.
+Principals of other Authenticators only carry the fields of the user, with
+nil Claims.
+
+Server checks the credentials of the caller before it calls a method which
+declares Scopes, Audiences, ClientIds or Issuers, the same way
+CurrentPrincipal does. Callers get 401 Unauthorized without valid
+credentials, or 403 Forbidden if their client is not allowed. The principal
+is then available to interceptors and to the method:
+
+	p := endpoints.PrincipalFromContext(c)
+
+Methods which declare none of those are not checked, even if their API has
+issuers. Issuers of the API are trusted by the methods which are checked,
+unless they name some of them. Google ID tokens are accepted by methods
+which declare no Scopes other than the email scope. Methods which declare
+no ClientIds accept tokens of any client: Bearer tokens with one of their
+Scopes, and Google ID tokens issued to one of their Audiences. Methods which
+also serve anonymous callers set AllowAnonymous; PrincipalFromContext
+returns nil for those callers.
+
+
+Running outside App Engine
+
+On App Engine the package relies on App Engine standard for request
+contexts, logging, memcache and urlfetch. Anywhere else, e.g. on Cloud Run or
+Kubernetes or in tests, DefaultPlatform is a platform based on the standard
+library, logging messages of level INFO and above to stderr. Another one can
+be set as the default:
+
+	endpoints.DefaultPlatform = endpoints.NewStandardPlatform(logger)
+
+or as Server.Platform of a single server. Logger, Cache and Transport of
+a Platform can be replaced with your own implementations. The standard
+platform validates bearer tokens with the tokeninfo API and does not check
+the app revision in BackendService.GetApiConfigs unless VersionID is set.
+
+Debug messages, which include request bodies, are logged by a Logger created
+with endpoints.NewStdLoggerLevel(logger, endpoints.LogDebug).
+
+Building with the noappengine tag leaves out App Engine's logging, memcache
+and urlfetch packages. AppEnginePlatform is then a standard platform too.
+
+
 Custom types
 
 You can define your own types and use them directly as a field type in a
@@ -236,22 +375,85 @@ Field tags
 Go Endpoints has its own field tag "endpoints" which you can use to let your
 clients know what a service method data constraints are (on input):
 
-	- req, means "required".
+	- req or required, means the field is required.
+	- path, means the field is a path parameter of the method's default
+	  path, e.g. "get/{id}" instead of "get". Without path fields, fields
+	  tagged with "required" are the path parameters, named after the Go
+	  fields, e.g. "get/{ID}". Set MethodInfo.Path instead to choose any
+	  other path.
 	- d, default value, cannot be used together with req.
 	- min and max constraints. Can be used only on int and uint (8/16/32/64 bits).
-	- desc, a field description. Cannot contain a "," (comma) for now.
+	- desc, a field description.
+	- pattern, a regular expression a string must match, e.g. "^[a-z]+$".
+	- minLength and maxLength, in characters, of a string.
+	- minItems and maxItems, number of items of a slice, an array or a map.
+	- enum, valid values separated by "|", e.g. "enum=red|green|blue".
+	  Can be used on strings, numbers and booleans.
 
 Let's see an example:
 
 	type TaggedStruct struct {
 	    A int    `endpoints:"req,min=0,max=100,desc=An int field"`
 	    B int    `endpoints:"d=10,min=1,max=200"`
-	    C string `endpoints:"req,d=Hello gopher,desc=A string field"`
+	    C string `endpoints:"d=Hello gopher,desc=A string field"`
 	}
 
 	- A field is required and has min & max constrains, is described as "An int field"
 	- B field is not required, defaults to 10 and has min & max constrains
-	- C field is required, defaults to "Hello gopher", is described as "A string field"
+	- C field is not required, defaults to "Hello gopher", is described as "A string field"
+
+A value which contains a "," (comma) must be quoted with single quotes, or
+with double quotes escaped in the struct tag. Inside quotes, a backslash
+escapes the quote or another backslash:
+
+	D string `endpoints:"desc='A description, with a comma',pattern='^\\d{1,3}$'"`
+
+Unknown options and invalid values are reported by RegisterService.
+
+Constraints other than req, min and max don't apply to zero values, e.g. an
+empty string matches any pattern and minLength, since a string field can't
+tell an empty string from a missing one. Use a pointer field to apply them
+to an empty string too. Empty slices and maps are checked, e.g. against
+minItems, unless they are nil, i.e. missing from the request.
+
+Tags of nested structs are enforced too, whether a struct is a field of the
+request, is pointed to or is an element of a slice, array or map. A required
+pointer, slice or map field must not be nil or empty.
+
+A request which violates the constraints is rejected with a ValidationError,
+a Bad Request error listing every violation, so that clients can point out
+all invalid fields at once:
+
+	{
+	  "state": "APPLICATION_ERROR",
+	  "error_name": "Bad Request",
+	  "error_message": "missing field A; 300 is too big",
+	  "field_violations": [
+	    {"field": "A", "constraint": "required", "message": "missing field A"},
+	    {"field": "B", "constraint": "max", "value": 300, "limit": 200,
+	     "message": "300 is too big"}
+	  ]
+	}
+
+Service methods can return their own violations with NewValidationError.
+
+Rules which involve several fields can be checked by a Validate method of
+the request type, or of a struct nested in it, which implements Validator.
+It is called once the struct's fields pass tag validation, and the
+violations it returns are reported along with the others:
+
+	type Period struct {
+	    Start int `json:"start" endpoints:"req"`
+	    End   int `json:"end"`
+	}
+
+	func (p *Period) Validate(c context.Context) error {
+	    if p.End < p.Start {
+	        return &endpoints.FieldViolation{Field: "end", Constraint: "range",
+	            Msg: "end is before start"}
+	    }
+	    return nil
+	}
 
 JSON tag and path templates
 
@@ -279,7 +481,7 @@ input and output:
 	type TaggedStruct struct {
 	    A       int    `endpoints:"req,min=0,max=100,desc=An int field"`
 	    B       int    `json:"myB" endpoints:"d=10,min=1,max=200"`
-	    C       string `json:"c" endpoints:"req,d=Hello gopher,desc=A string field"`
+	    C       string `json:"c" endpoints:"d=Hello gopher,desc=A string field"`
 	    Skipped int    `json:"-"`
 	}
 
@@ -291,10 +493,87 @@ As per Type and Format Summary (https://developers.google.com/discovery/v1/type-
 	support integers up to 2^53). Therefore, a 64-bit integer must be
 	represented as a string in JSON requests/responses
 
-In this case, it is sufficient to append ",string" to the json tag:
+Requests and responses are encoded accordingly: int64 and uint64 values are
+written as strings, in fields, slices, maps and nested structs alike, and
+both strings and numbers are accepted in requests. There's no need to append
+",string" to the json tag, although it still works:
 
 	type Int64Struct struct {
-	  Id int64 `json:",string"`
+	  Id  int64   `json:"id"`
+	  Ids []int64 `json:"ids"`
+	}
+
+Values of types implementing json.Marshaler are encoded as they choose.
+Values held by interface{} fields, slices or maps have no declared format
+and are encoded by encoding/json, 64-bit integers as numbers.
+
+Schema names
+
+Types of requests, responses and their fields are described by schemas
+named after the types, and the schemas of all services of an API share
+names. Types with the same name from different packages, in one or several
+services of an API, are reported as an error by RegisterService, override
+SchemaNameForType to tell them apart. Types can refer to themselves, e.g. trees or threads of
+comments, and instantiated generic types are named after their type
+arguments, e.g. Page[model.Item] as PageItem.
+
+Maps, arrays and arbitrary values
+
+Maps with string or integer keys are described as objects, with
+additionalProperties describing their values, and arrays like slices.
+Fields of interface{} or json.RawMessage type can hold any JSON value:
+
+	type Document struct {
+	  Labels map[string]string      `json:"labels"`
+	  Point  [2]float64             `json:"point"`
+	  Extra  map[string]interface{} `json:"extra"`
+	  Raw    json.RawMessage        `json:"raw"`
+	}
+
+Custom JSON types
+
+Types implementing json.Marshaler and json.Unmarshaler are described as
+strings. A type encoded otherwise can describe its schema by implementing
+SchemaProvider, and types of other packages can be described with
+RegisterTypeSchema:
+
+	type Money struct {
+	  Cents int64
+	}
+
+	func (m Money) EndpointsSchema() endpoints.APISchemaProperty {
+	  return endpoints.APISchemaProperty{Type: "number", Format: "double"}
+	}
+
+	func init() {
+	  endpoints.RegisterTypeSchema(reflect.TypeOf(datastore.Key{}),
+	    endpoints.APISchemaProperty{Type: "string", Format: "websafe-key"})
+	}
+
+Query and path parameters of such types with a number or boolean schema are
+passed to UnmarshalJSON as is, and quoted as JSON strings otherwise.
+
+Enumerations
+
+Valid values of a string, number or boolean type are listed in schemas and
+parameters of the type, and other values are rejected in requests, if the
+type implements EnumProvider or is registered with RegisterEnum. Like other
+constraints, they don't apply to zero values. Items of slices and arrays of
+such types are checked too, and the enum tag option overrides the values of
+the type of a field. Generated clients declare enumerations as types:
+
+	type State string
+
+	const (
+	  Active  State = "active"
+	  Deleted State = "deleted"
+	)
+
+	func (State) EndpointsEnum() []endpoints.EnumValue {
+	  return []endpoints.EnumValue{
+	    {Value: string(Active), Desc: "Visible to everyone"},
+	    {Value: string(Deleted), Desc: "Kept for a month"},
+	  }
 	}
 
 
@@ -87,6 +87,46 @@ func NewConflictError(format string, args ...interface{}) error {
 	return errorf(http.StatusConflict, format, args...)
 }
 
+// FieldViolation is a request field which failed validation.
+type FieldViolation struct {
+	// Field is the JSON path of the field, e.g. "author.name".
+	Field string `json:"field"`
+	// Constraint is the violated constraint, e.g. "required" or "max".
+	Constraint string `json:"constraint"`
+	// Value is the offending value, nil for a missing field.
+	Value interface{} `json:"value,omitempty"`
+	// Limit is the limit of the constraint, e.g. the max value.
+	Limit interface{} `json:"limit,omitempty"`
+	// Msg describes the violation.
+	Msg string `json:"message"`
+}
+
+// FieldViolation is an error
+func (v *FieldViolation) Error() string {
+	return v.Msg
+}
+
+// ValidationError is an APIError with Bad Request status (400) which lists
+// all fields of a request which failed validation.
+type ValidationError struct {
+	APIError
+	Violations []*FieldViolation
+}
+
+// NewValidationError creates a new ValidationError given the violations.
+// Its message lists messages of all violations.
+func NewValidationError(violations ...*FieldViolation) error {
+	msgs := make([]string, len(violations))
+	for i, v := range violations {
+		msgs[i] = v.Msg
+	}
+	code := http.StatusBadRequest
+	return &ValidationError{
+		APIError{http.StatusText(code), strings.Join(msgs, "; "), code},
+		violations,
+	}
+}
+
 // errorResponse is SPI-compatible error response
 type errorResponse struct {
 	// Currently always "APPLICATION_ERROR"
@@ -94,6 +134,8 @@ type errorResponse struct {
 	Name  string `json:"error_name"`
 	Msg   string `json:"error_message,omitempty"`
 	Code  int    `json:"-"`
+	// Violations are set for a ValidationError.
+	Violations []*FieldViolation `json:"field_violations,omitempty"`
 }
 
 // Creates and initializes a new errorResponse.
@@ -102,18 +144,21 @@ type errorResponse struct {
 // Otherwise, a default error name is used and msg argument
 // is errorResponse.Msg.
 func newErrorResponse(err error) *errorResponse {
-	if e, ok := err.(*APIError); ok {
-		return &errorResponse{"APPLICATION_ERROR", e.Name, e.Msg, e.Code}
+	switch e := err.(type) {
+	case *APIError:
+		return &errorResponse{"APPLICATION_ERROR", e.Name, e.Msg, e.Code, nil}
+	case *ValidationError:
+		return &errorResponse{"APPLICATION_ERROR", e.Name, e.Msg, e.Code, e.Violations}
 	}
 	msg := err.Error()
 	for _, code := range knownErrors {
 		if name := http.StatusText(code); strings.HasPrefix(msg, name) {
-			return &errorResponse{"APPLICATION_ERROR", name, strings.Trim(msg[len(name):], " :"), code}
+			return &errorResponse{"APPLICATION_ERROR", name, strings.Trim(msg[len(name):], " :"), code, nil}
 		}
 	}
 	//for compatibility, Before behavior, always return 400 HTTP Status Code.
 	// TODO(alex): where is 400 coming from?
-	return &errorResponse{"APPLICATION_ERROR", http.StatusText(http.StatusInternalServerError), msg, http.StatusBadRequest}
+	return &errorResponse{"APPLICATION_ERROR", http.StatusText(http.StatusInternalServerError), msg, http.StatusBadRequest, nil}
 }
 
 // writeError writes SPI-compatible error response.
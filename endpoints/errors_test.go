@@ -49,3 +49,26 @@ func TestAPIErrorResponse(t *testing.T) {
 			BadRequestError, res, want)
 	}
 }
+
+func TestValidationErrorResponse(t *testing.T) {
+	violations := []*FieldViolation{
+		{Field: "id", Constraint: "required", Msg: "missing field ID"},
+		{Field: "limit", Constraint: "max", Value: 101, Limit: 100, Msg: "101 is too big"},
+	}
+	err := NewValidationError(violations...)
+	if msg := err.Error(); msg != "missing field ID; 101 is too big" {
+		t.Errorf("NewValidationError().Error() = %q", msg)
+	}
+
+	res := newErrorResponse(err)
+	want := &errorResponse{
+		State:      "APPLICATION_ERROR",
+		Name:       "Bad Request",
+		Msg:        "missing field ID; 101 is too big",
+		Code:       http.StatusBadRequest,
+		Violations: violations,
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("newErrorResponse(%#v) = %#v; want %#v", err, res, want)
+	}
+}
@@ -0,0 +1,124 @@
+package endpoints
+
+import (
+	"net/http"
+	"reflect"
+
+	"golang.org/x/net/context"
+)
+
+// MethodCall is a call of a service method, as seen by interceptors.
+type MethodCall struct {
+	// Service and Method are the resolved service method.
+	Service *RPCService
+	Method  *ServiceMethod
+	// Request is the decoded and validated request, a pointer to
+	// a Method.ReqType value. Interceptors may modify it but must not
+	// replace it with a value of another type.
+	Request interface{}
+	// HTTPRequest is the original HTTP request.
+	HTTPRequest *http.Request
+}
+
+// Invoker calls a service method. It returns the method's response, or nil
+// if the method does not have one.
+type Invoker func(c context.Context, call *MethodCall) (interface{}, error)
+
+// Interceptor wraps a service method call.
+//
+// It can inspect the call, replace the context passed to next, inspect or
+// replace the response and error returned by next, or return without
+// calling next at all, e.g. with a cached response. A non-nil response is
+// encoded as JSON in place of the method's response.
+type Interceptor func(c context.Context, call *MethodCall, next Invoker) (interface{}, error)
+
+// Use adds interceptors to all method calls served by s.
+//
+// Server-wide interceptors run before (i.e. wrap) per-method ones and
+// are applied in the order they were added. Use is not safe to call
+// concurrently with serving requests.
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+// Use adds interceptors to calls of m only, see Server.Use.
+func (m *ServiceMethod) Use(interceptors ...Interceptor) {
+	m.interceptors = append(m.interceptors, interceptors...)
+}
+
+// chain returns an Invoker calling next through interceptors, with the
+// first interceptor being the outermost one.
+func chain(interceptors []Interceptor, next Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		next = wrapInvoker(interceptors[i], next)
+	}
+	return next
+}
+
+// wrapInvoker returns an Invoker calling next through ic.
+func wrapInvoker(ic Interceptor, next Invoker) Invoker {
+	return func(c context.Context, call *MethodCall) (interface{}, error) {
+		return ic(c, call, next)
+	}
+}
+
+// callMethod is the innermost Invoker that calls the service method
+// with its precompiled methodInvoker.
+func callMethod(c context.Context, call *MethodCall) (interface{}, error) {
+	return call.Method.invoke(call.Service.rcvr, c, call.HTTPRequest, call.Request)
+}
+
+// methodInvoker calls a service method of rcvr with either c or r,
+// depending on the method's first argument, and a decoded request. It
+// returns the method's response, or nil if the method does not have one.
+type methodInvoker func(rcvr reflect.Value, c context.Context, r *http.Request, req interface{}) (interface{}, error)
+
+// newMethodInvoker compiles a methodInvoker of m once, when the method is
+// registered, so that calls do not need to inspect the method's signature.
+func newMethodInvoker(m *ServiceMethod) methodInvoker {
+	fn := m.method.Func
+	numIn, numOut := fn.Type().NumIn(), fn.Type().NumOut()
+	wantsContext := m.wantsContext
+	respType := m.RespType
+	// The context argument may be of an interface type equivalent to, but
+	// not identical with, Context.
+	ctxType := fn.Type().In(1)
+	convertContext := wantsContext && ctxType != typeOfContext
+
+	return func(rcvr reflect.Value, c context.Context, r *http.Request, req interface{}) (interface{}, error) {
+		var buf [4]reflect.Value
+		args := buf[:numIn]
+		args[0] = rcvr
+		if wantsContext {
+			// Pass a Value of the interface type itself, so that Call
+			// does not need to convert c to context.Context.
+			ctx := c
+			args[1] = reflect.ValueOf(&ctx).Elem()
+			if convertContext {
+				args[1] = args[1].Convert(ctxType)
+			}
+		} else {
+			args[1] = reflect.ValueOf(r)
+		}
+		if numIn > 2 {
+			args[2] = reflect.ValueOf(req)
+		}
+		var respValue reflect.Value
+		if numIn > 3 {
+			respValue = reflect.New(respType)
+			args[3] = respValue
+		}
+
+		res := fn.Call(args)
+		if numOut == 2 {
+			respValue = res[0]
+		}
+		if err := res[numOut-1].Interface(); err != nil {
+			return nil, err.(error)
+		}
+		if !respValue.IsValid() {
+			return nil, nil
+		}
+		return respValue.Interface(), nil
+	}
+}
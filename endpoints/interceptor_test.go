@@ -0,0 +1,322 @@
+package endpoints
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"appengine/aetest"
+)
+
+// tracingInterceptor returns an Interceptor which records its name in
+// trace before and after calling next.
+func tracingInterceptor(name string, trace *[]string) Interceptor {
+	return func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+		*trace = append(*trace, name)
+		resp, err := next(c, call)
+		*trace = append(*trace, name+" done")
+		return resp, err
+	}
+}
+
+func TestServerUse(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	var (
+		trace []string
+		calls []*MethodCall
+	)
+	server.Use(
+		tracingInterceptor("first", &trace),
+		tracingInterceptor("second", &trace),
+		func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+			calls = append(calls, call)
+			if c.Value(methodCallKey) != call {
+				t.Errorf("context has method call %v; want %v", c.Value(methodCallKey), call)
+			}
+			return next(c, call)
+		})
+	server.services.services["ServerTestService"].methods["MsgWithReturn"].Use(
+		tracingInterceptor("method", &trace))
+
+	r, _ := inst.NewRequest("POST", "/ServerTestService.MsgWithReturn", strings.NewReader(`{"name":"gopher"}`))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if res := strings.TrimSpace(w.Body.String()); res != `{"name":"gopher"}` {
+		t.Errorf("res = %q; want %q", res, `{"name":"gopher"}`)
+	}
+	want := []string{"first", "second", "method", "method done", "second done", "first done"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace = %v; want %v", trace, want)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("len(calls) = %d; want 1", len(calls))
+	}
+	verifyPairs(t,
+		calls[0].Service.name, "ServerTestService",
+		calls[0].Method.method.Name, "MsgWithReturn",
+		calls[0].Request, &TestMsg{Name: "gopher"},
+		calls[0].HTTPRequest, r,
+	)
+
+	// Method interceptors apply to their method only.
+	trace = nil
+	r, _ = inst.NewRequest("POST", "/ServerTestService.Msg", strings.NewReader(`{"name":"gopher"}`))
+	server.ServeHTTP(httptest.NewRecorder(), r)
+	want = []string{"first", "second", "second done", "first done"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace = %v; want %v", trace, want)
+	}
+}
+
+func TestInterceptorResponse(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		method string
+		ic     Interceptor
+		code   int
+		out    string
+	}{
+		// Short-circuit with a cached response.
+		{"MsgWithReturn", func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+			return &TestMsg{Name: "cached"}, nil
+		}, http.StatusOK, `{"name":"cached"}`},
+		// Transform the response.
+		{"Msg", func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+			resp, err := next(c, call)
+			if err != nil {
+				return nil, err
+			}
+			resp.(*TestMsg).Name = strings.ToUpper(resp.(*TestMsg).Name)
+			return resp, nil
+		}, http.StatusOK, `{"name":"GOPHER"}`},
+		// Modify the request.
+		{"MsgWithContext", func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+			call.Request.(*TestMsg).Name = "modified"
+			return next(c, call)
+		}, http.StatusOK, `{"name":"modified"}`},
+		// Replace an error.
+		{"NotFound", func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+			if _, err := next(c, call); err != NotFoundError {
+				t.Errorf("err = %v; want %v", err, NotFoundError)
+			}
+			return nil, ForbiddenError
+		}, http.StatusForbidden, ``},
+		// Reject a call.
+		{"MsgWithReturn", func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+			return nil, UnauthorizedError
+		}, http.StatusUnauthorized, ``},
+	}
+
+	for i, tt := range tts {
+		server := createAPIServer()
+		server.Use(tt.ic)
+		r, _ := inst.NewRequest("POST", "/ServerTestService."+tt.method, strings.NewReader(`{"name":"gopher"}`))
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s code = %d; want %d", i, tt.method, w.Code, tt.code)
+		}
+		if res := strings.TrimSpace(w.Body.String()); tt.code == http.StatusOK && res != tt.out {
+			t.Errorf("%d: %s res = %q; want %q", i, tt.method, res, tt.out)
+		}
+	}
+}
+
+func TestInterceptorREST(t *testing.T) {
+	server := createRESTServer(t)
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	var got *MethodCall
+	server.ServiceByName("RESTTestService").MethodByName("Count").Use(
+		func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+			got = call
+			return &TestMsg{Name: "intercepted"}, nil
+		})
+
+	r, _ := inst.NewRequest("GET", "/_ah/api/rest/v1/items/count", strings.NewReader(""))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if res := strings.TrimSpace(w.Body.String()); res != `{"name":"intercepted"}` {
+		t.Errorf("res = %q; want %q", res, `{"name":"intercepted"}`)
+	}
+	if got == nil || got.Method.Info().Name != "items.count" {
+		t.Errorf("got = %+v; want items.count call", got)
+	}
+}
+
+func TestNewMethodInvoker(t *testing.T) {
+	server := createAPIServer()
+	service := server.ServiceByName("ServerTestService")
+	r := httptest.NewRequest("POST", "/", strings.NewReader(""))
+	c := context.Background()
+
+	tts := []struct {
+		method string
+		req    interface{}
+		want   interface{}
+		err    error
+	}{
+		{"Msg", &TestMsg{Name: "a"}, &TestMsg{Name: "a"}, nil},
+		{"MsgWithReturn", &TestMsg{Name: "b"}, &TestMsg{Name: "b"}, nil},
+		{"MsgWithContext", &TestMsg{Name: "c"}, &TestMsg{Name: "c"}, nil},
+		{"MsgWithRequest", &TestMsg{Name: "d"}, &TestMsg{Name: "d"}, nil},
+		{"MsgWithoutRequest", nil, &TestMsg{}, nil},
+		{"MsgWithoutResponse", &TestMsg{}, nil, nil},
+		{"MsgWithoutRequestNorResponse", nil, nil, nil},
+		{"Void", &VoidMessage{}, &VoidMessage{}, nil},
+		{"NotFound", &TestMsg{}, nil, NotFoundError},
+	}
+	for i, tt := range tts {
+		m := service.MethodByName(tt.method)
+		resp, err := m.invoke(service.rcvr, c, r, tt.req)
+		if err != tt.err {
+			t.Errorf("%d: %s err = %v; want %v", i, tt.method, err, tt.err)
+		}
+		if !reflect.DeepEqual(resp, tt.want) {
+			t.Errorf("%d: %s resp = %#v; want %#v", i, tt.method, resp, tt.want)
+		}
+	}
+}
+
+// otherContext has the methods of Context without being the same type.
+type otherContext interface {
+	Deadline() (time.Time, bool)
+	Done() <-chan struct{}
+	Err() error
+	Value(key interface{}) interface{}
+}
+
+// concreteContext implements Context, but cannot hold any Context.
+type concreteContext struct {
+	context.Context
+}
+
+type ContextTypeService struct{}
+
+func (s *ContextTypeService) Other(c otherContext, req *TestMsg) (*TestMsg, error) {
+	name, _ := c.Value(contextDecoratorKey).(string)
+	return &TestMsg{Name: name}, nil
+}
+
+func (s *ContextTypeService) Concrete(c *concreteContext, req *TestMsg) (*TestMsg, error) {
+	return req, nil
+}
+
+func TestNewMethodInvokerContextType(t *testing.T) {
+	service, err := NewServer("").RegisterService(&ContextTypeService{}, "ctx", "v1", "", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	if m := service.MethodByName("Concrete"); m != nil {
+		t.Errorf("MethodByName(Concrete) = %v; want nil", m)
+	}
+	m := service.MethodByName("Other")
+	if m == nil || !m.wantsContext {
+		t.Fatalf("MethodByName(Other) = %+v; want a method taking a context", m)
+	}
+
+	c := context.WithValue(context.Background(), contextDecoratorKey, "gopher")
+	resp, err := m.invoke(service.rcvr, c, nil, &TestMsg{})
+	if err != nil {
+		t.Fatalf("Other() = %v", err)
+	}
+	if want := (&TestMsg{Name: "gopher"}); !reflect.DeepEqual(resp, want) {
+		t.Errorf("Other() = %#v; want %#v", resp, want)
+	}
+}
+
+type BenchMsg struct {
+	ID    string   `json:"id" endpoints:"req"`
+	Limit int      `json:"limit" endpoints:"d=10,min=1,max=100"`
+	Score float64  `json:"score" endpoints:"max=1"`
+	Name  string   `json:"name" endpoints:"desc=Name of the item"`
+	Tags  []string `json:"tags"`
+}
+
+type BenchService struct{}
+
+func (s *BenchService) Get(c context.Context, req *BenchMsg) (*BenchMsg, error) {
+	return req, nil
+}
+
+func (s *BenchService) Fill(r *http.Request, req *BenchMsg, resp *BenchMsg) error {
+	*resp = *req
+	return nil
+}
+
+func createBenchServer(b *testing.B) *Server {
+	server := NewServer("")
+	server.Platform = NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	if _, err := server.RegisterService(&BenchService{}, "bench", "v1", "Bench API", true); err != nil {
+		b.Fatalf("error registering service: %v", err)
+	}
+	return server
+}
+
+func BenchmarkCallMethod(b *testing.B) {
+	server := createBenchServer(b)
+	service := server.ServiceByName("BenchService")
+	for _, name := range []string{"Get", "Fill"} {
+		b.Run(name, func(b *testing.B) {
+			call := &MethodCall{
+				Service:     service,
+				Method:      service.MethodByName(name),
+				Request:     &BenchMsg{ID: "x"},
+				HTTPRequest: httptest.NewRequest("POST", "/", nil),
+			}
+			c := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := callMethod(c, call); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	server := createBenchServer(b)
+	const body = `{"id":"x","limit":5,"score":0.5,"name":"gopher"}`
+	for _, tt := range []struct{ name, path string }{
+		{"SPI", "/_ah/spi/BenchService.Get"},
+		{"REST", "/_ah/api/bench/v1/get"},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := httptest.NewRequest("POST", tt.path, strings.NewReader(body))
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					b.Fatalf("%s: code = %d: %s", tt.path, w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
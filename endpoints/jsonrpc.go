@@ -0,0 +1,332 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// rpcPath is the path of JSON-RPC endpoint, relative to the API root.
+const rpcPath = "rpc"
+
+// Limits of JSON-RPC batches: the number of calls of a batch and the number
+// of them executed at the same time.
+const (
+	maxRPCBatchSize   = 100
+	maxRPCConcurrency = 8
+)
+
+// JSON-RPC 2.0 error codes of protocol errors. Errors returned by service
+// methods use HTTP status codes instead, e.g. 404.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+)
+
+// rpcRequest is a single JSON-RPC 2.0 call, as sent by Google API client
+// libraries.
+//
+// ID is empty for notifications. Unlike a missing id, "id": null is kept
+// and gets a response.
+type rpcRequest struct {
+	JSONRPC    string                     `json:"jsonrpc"`
+	ID         json.RawMessage            `json:"id"`
+	Method     string                     `json:"method"`
+	APIVersion string                     `json:"apiVersion"`
+	Params     map[string]json.RawMessage `json:"params"`
+}
+
+// rpcResponse is a response to a single JSON-RPC 2.0 call.
+type rpcResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+// rpcError is the error member of rpcResponse.
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    []*rpcErrorData `json:"data,omitempty"`
+}
+
+// rpcErrorData details an error returned by a service method. Each field
+// violation of a ValidationError is detailed separately, with its
+// constraint as the reason and the field as the location.
+type rpcErrorData struct {
+	Domain       string `json:"domain"`
+	Reason       string `json:"reason"`
+	Message      string `json:"message"`
+	Location     string `json:"location,omitempty"`
+	LocationType string `json:"locationType,omitempty"`
+}
+
+// serveJSONRPC serves a JSON-RPC 2.0 request, either a single call or
+// a batch of calls. Calls of a batch are executed concurrently, at most
+// maxRPCConcurrency at a time, and their responses are written in the same
+// order. Calls without an id (notifications) are executed but not responded
+// to.
+//
+// Each call gets its own copy of r, with a fresh body, so that interceptors
+// of concurrent calls do not share it.
+func (s *Server) serveJSONRPC(c context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, NewAPIError(http.StatusText(http.StatusMethodNotAllowed),
+			fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger(c).Debugf(c, "JSON-RPC request body: %s", body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	var raws []json.RawMessage
+	if batch {
+		err = json.Unmarshal(body, &raws)
+	} else {
+		raws = []json.RawMessage{body}
+		err = json.Unmarshal(body, new(json.RawMessage))
+	}
+	if err != nil {
+		writeRPC(w, newRPCError(nil, rpcParseError, "Parse error: %v", err))
+		return
+	}
+	switch {
+	case len(raws) == 0:
+		writeRPC(w, newRPCError(nil, rpcInvalidRequest, "Invalid request: empty batch"))
+		return
+	case len(raws) > maxRPCBatchSize:
+		writeRPC(w, newRPCError(nil, rpcInvalidRequest,
+			"Invalid request: batch of %d calls exceeds the limit of %d", len(raws), maxRPCBatchSize))
+		return
+	}
+
+	resps := make([]*rpcResponse, len(raws))
+	sem := make(chan struct{}, maxRPCConcurrency)
+	var wg sync.WaitGroup
+	for i, raw := range raws {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, raw json.RawMessage) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			cr := r.Clone(c)
+			cr.Body = ioutil.NopCloser(bytes.NewReader(body))
+			resps[i] = s.callJSONRPC(context.WithValue(c, requestKey, cr), cr, raw)
+		}(i, raw)
+	}
+	wg.Wait()
+
+	// Drop responses to notifications.
+	out := resps[:0]
+	for _, resp := range resps {
+		if resp != nil {
+			out = append(out, resp)
+		}
+	}
+	switch {
+	case len(out) == 0:
+		w.WriteHeader(http.StatusNoContent)
+	case batch:
+		writeRPC(w, out)
+	default:
+		writeRPC(w, out[0])
+	}
+}
+
+// callJSONRPC executes a single JSON-RPC call. It returns nil if the call
+// is a notification.
+func (s *Server) callJSONRPC(c context.Context, r *http.Request, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return newRPCError(nil, rpcInvalidRequest, "Invalid request: %v", err)
+	}
+	var id *json.RawMessage
+	if len(req.ID) > 0 {
+		id = &req.ID
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return newRPCError(id, rpcInvalidRequest, "Invalid request")
+	}
+
+	resp := &rpcResponse{JSONRPC: "2.0", ID: id}
+	serviceSpec, methodSpec, err := s.services.rpcMethod(req.Method, req.APIVersion)
+	if err != nil {
+		resp = newRPCError(id, rpcMethodNotFound, "%v", err)
+	} else if result, err := s.callRPCMethod(c, r, serviceSpec, methodSpec, req.Params); err != nil {
+		resp.Error = newRPCMethodError(err)
+	} else {
+		resp.Result = typedValue{result}
+	}
+
+	if id == nil {
+		return nil
+	}
+	return resp
+}
+
+// newRPCMethodError creates the error member of a response to a call of
+// a method which returned err.
+func newRPCMethodError(err error) *rpcError {
+	errResp := newErrorResponse(err)
+	rpcErr := &rpcError{Code: errResp.Code, Message: errResp.Msg}
+	for _, v := range errResp.Violations {
+		rpcErr.Data = append(rpcErr.Data, &rpcErrorData{
+			Domain:       "global",
+			Reason:       v.Constraint,
+			Message:      v.Msg,
+			Location:     v.Field,
+			LocationType: "parameter",
+		})
+	}
+	if rpcErr.Data == nil {
+		rpcErr.Data = []*rpcErrorData{
+			{Domain: "global", Reason: errResp.Name, Message: errResp.Msg},
+		}
+	}
+	return rpcErr
+}
+
+// callRPCMethod binds params to a new request value of methodSpec,
+// validates it and invokes the method. The result is an empty object if
+// the method does not have a response. A panic is reported as
+// InternalServerError.
+func (s *Server) callRPCMethod(c context.Context, r *http.Request,
+	serviceSpec *RPCService, methodSpec *ServiceMethod, params map[string]json.RawMessage) (
+	result interface{}, err error) {
+
+	defer s.recoverPanic(c, r, serviceSpec, methodSpec, &err)
+
+	reqValue := reflect.New(methodSpec.ReqType)
+	if err := bindRPCParams(reqValue.Elem(), params); err != nil {
+		return nil, err
+	}
+	if err := validateRequest(c, reqValue.Interface()); err != nil {
+		return nil, err
+	}
+	resp, err := s.invoke(c, r, serviceSpec, methodSpec, reqValue)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return struct{}{}, nil
+	}
+	return resp, nil
+}
+
+// bindRPCParams sets fields of the struct v from JSON-RPC params.
+//
+// Params are the request fields, with the request body optionally nested
+// in "resource" member, as sent by Google API client libraries. Values
+// encoded as strings, e.g. int64 ids, are parsed the same way as REST
+// query parameters. Dotted names address nested fields.
+func bindRPCParams(v reflect.Value, params map[string]json.RawMessage) error {
+	if raw, ok := params["resource"]; ok {
+		if _, isField := fieldByJSONName(v, "resource"); !isField {
+			if err := decodeJSON(raw, v.Addr().Interface()); err != nil {
+				return NewBadRequestError("invalid resource: %v", err)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw := params[name]
+		f, isField := fieldByJSONName(v, name)
+		if isField {
+			if err := decodeJSON(raw, f.Addr().Interface()); err == nil {
+				continue
+			}
+		} else if name == "resource" {
+			continue
+		}
+		// Either a dotted name or a value encoded as a string.
+		// Unknown params are ignored.
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			if !isField {
+				continue
+			}
+			return NewBadRequestError("invalid value of %q parameter: %s", name, raw)
+		}
+		if _, err := setParam(v, name, []string{str}); err != nil {
+			return NewBadRequestError("invalid value of %q parameter: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// rpcMethod finds a method of a public service given its JSON-RPC name,
+// "{api}.{method}", e.g. "greeting.greets.list". MethodInfo.Name alone is
+// accepted too, as long as it is not ambiguous.
+//
+// An empty version selects default versions of APIs.
+func (m *serviceMap) rpcMethod(name, version string) (*RPCService, *ServiceMethod, error) {
+	var (
+		service *RPCService
+		method  *ServiceMethod
+		matches int
+	)
+	for _, s := range m.publicServices() {
+		if (version != "" && s.info.Version != version) || (version == "" && !s.info.Default) {
+			continue
+		}
+		for _, sm := range s.methods {
+			if sm.info == nil {
+				continue
+			}
+			if s.info.Name+"."+sm.info.Name == name {
+				return s, sm, nil
+			}
+			if sm.info.Name == name {
+				service, method = s, sm
+				matches++
+			}
+		}
+	}
+	switch {
+	case matches > 1:
+		return nil, nil, fmt.Errorf("Method %q is ambiguous, use {api}.%s name", name, name)
+	case matches == 0:
+		return nil, nil, fmt.Errorf("Method not found: %s", name)
+	}
+	return service, method, nil
+}
+
+// newRPCError creates a JSON-RPC response with a protocol error.
+func newRPCError(id *json.RawMessage, code int, format string, args ...interface{}) *rpcResponse {
+	return &rpcResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &rpcError{Code: code, Message: fmt.Sprintf(format, args...)},
+	}
+}
+
+// writeRPC writes JSON-RPC response(s) v. JSON-RPC responses are always
+// sent with 200 OK status, errors are reported in the response body.
+func writeRPC(w http.ResponseWriter, v interface{}) {
+	if err := encodeJSON(w, v); err != nil {
+		writeError(w, err)
+	}
+}
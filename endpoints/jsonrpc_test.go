@@ -0,0 +1,223 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"appengine/aetest"
+)
+
+func TestBindRPCParams(t *testing.T) {
+	tts := []struct {
+		params string
+		want   *RESTTestMsg
+		fails  bool
+	}{
+		{`{"id":"123","name":"gopher"}`, &RESTTestMsg{ID: 123, Name: "gopher"}, false},
+		{`{"id":123,"limit":5}`, &RESTTestMsg{ID: 123, Limit: 5}, false},
+		{`{"id":"7","resource":{"id":1,"name":"body"}}`, &RESTTestMsg{ID: 7, Name: "body"}, false},
+		{`{"tags":["a","b"],"nested.name":"inner"}`,
+			&RESTTestMsg{Tags: []string{"a", "b"}, Nested: &TestMsg{Name: "inner"}}, false},
+		{`{"unknown":1,"other":"x"}`, &RESTTestMsg{}, false},
+		{`{"limit":"ten"}`, nil, true},
+		{`{"limit":[1]}`, nil, true},
+		{`{"resource":"body"}`, nil, true},
+	}
+
+	for i, tt := range tts {
+		var params map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.params), &params); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		v := reflect.New(reflect.TypeOf(RESTTestMsg{}))
+		err := bindRPCParams(v.Elem(), params)
+		switch {
+		case err != nil && !tt.fails:
+			t.Errorf("%d: bindRPCParams(%s) = %v", i, tt.params, err)
+		case err == nil && tt.fails:
+			t.Errorf("%d: bindRPCParams(%s) = %+v; want error", i, tt.params, v.Interface())
+		case err == nil && !reflect.DeepEqual(v.Interface(), tt.want):
+			t.Errorf("%d: bindRPCParams(%s) = %+v; want %+v", i, tt.params, v.Interface(), tt.want)
+		}
+	}
+}
+
+func TestServiceMapRPCMethod(t *testing.T) {
+	server := createRESTServer(t)
+	if _, err := server.RegisterService(&RESTTestServiceV2{}, "rest", "v2", "REST API", false); err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+
+	tts := []struct {
+		name, version, service, method string
+	}{
+		{"rest.items.get", "", "RESTTestService", "Get"},
+		{"items.get", "", "RESTTestService", "Get"},
+		{"rest.items.get", "v1", "RESTTestService", "Get"},
+		{"rest.get", "v2", "RESTTestServiceV2", "Get"},
+		{"rest.items.get", "v2", "", ""},
+		{"rest.items.unknown", "", "", ""},
+		{"getApiConfigs", "", "", ""},
+	}
+
+	for i, tt := range tts {
+		s, m, err := server.services.rpcMethod(tt.name, tt.version)
+		if tt.method == "" {
+			if err == nil {
+				t.Errorf("%d: rpcMethod(%q, %q) = %s; want error", i, tt.name, tt.version, m.method.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: rpcMethod(%q, %q) = %v", i, tt.name, tt.version, err)
+			continue
+		}
+		if s.Name() != tt.service || m.method.Name != tt.method {
+			t.Errorf("%d: rpcMethod(%q, %q) = %s.%s; want %s.%s",
+				i, tt.name, tt.version, s.Name(), m.method.Name, tt.service, tt.method)
+		}
+	}
+}
+
+func TestServerServeJSONRPC(t *testing.T) {
+	server := createRESTServer(t)
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		in, out string
+		code    int
+	}{
+		{`{"jsonrpc":"2.0","id":"gapiRpc","method":"rest.items.count","apiVersion":"v1"}`,
+			`{"jsonrpc":"2.0","id":"gapiRpc","result":{"name":"count"}}`, http.StatusOK},
+		{`{"jsonrpc":"2.0","id":1,"method":"items.get","params":{"id":"5","name":"x"}}`,
+			`{"jsonrpc":"2.0","id":1,"result":{"id":"5","name":"x","limit":10,"tags":null,"flag":null,"data":null,"date":null,"small":0,"nested":null}}`,
+			http.StatusOK},
+		{`{"jsonrpc":"2.0","id":1,"method":"rest.items.delete","params":{"id":"1"}}`,
+			`{"jsonrpc":"2.0","id":1,"result":{}}`, http.StatusOK},
+		{`{"jsonrpc":"2.0","id":1,"method":"rest.items.delete","params":{"id":"0"}}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":404,"message":"no such item","data":[{"domain":"global","reason":"Not Found","message":"no such item"}]}}`,
+			http.StatusOK},
+		{`{"jsonrpc":"2.0","id":1,"method":"rest.items.get","params":{"limit":1000}}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":400,"message":"1000 is too big","data":[{"domain":"global","reason":"max","message":"1000 is too big","location":"limit","locationType":"parameter"}]}}`,
+			http.StatusOK},
+		{`{"jsonrpc":"2.0","id":1,"method":"rest.nothing"}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found: rest.nothing"}}`,
+			http.StatusOK},
+		{`{"id":1,"method":"rest.items.count"}`,
+			`{"jsonrpc":"2.0","id":1,"error":{"code":-32600,"message":"Invalid request"}}`, http.StatusOK},
+		{`{"jsonrpc":"2.0","id":1,`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error: unexpected end of JSON input"}}`,
+			http.StatusOK},
+		{`[]`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid request: empty batch"}}`,
+			http.StatusOK},
+		{`{"jsonrpc":"2.0","method":"rest.items.count"}`, ``, http.StatusNoContent},
+		{`{"jsonrpc":"2.0","id":null,"method":"rest.items.count"}`,
+			`{"jsonrpc":"2.0","id":null,"result":{"name":"count"}}`, http.StatusOK},
+		{"[" + strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"rest.items.count"},`, maxRPCBatchSize) +
+			`{"jsonrpc":"2.0","id":1,"method":"rest.items.count"}]`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid request: batch of 101 calls exceeds the limit of 100"}}`,
+			http.StatusOK},
+		{`[{"jsonrpc":"2.0","id":"a","method":"rest.items.count"},` +
+			`{"jsonrpc":"2.0","method":"rest.items.count"},` +
+			`{"jsonrpc":"2.0","id":"b","method":"rest.items.delete","params":{"id":"0"}},` +
+			`{"jsonrpc":"2.0","id":"c","method":"rest.items.delete","params":{"id":"1"}}]`,
+			`[{"jsonrpc":"2.0","id":"a","result":{"name":"count"}},` +
+				`{"jsonrpc":"2.0","id":"b","error":{"code":404,"message":"no such item","data":[{"domain":"global","reason":"Not Found","message":"no such item"}]}},` +
+				`{"jsonrpc":"2.0","id":"c","result":{}}]`,
+			http.StatusOK},
+	}
+
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/_ah/api/rpc", strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		out := strings.TrimSpace(w.Body.String())
+		if w.Code != tt.code {
+			t.Errorf("%d: %s w.Code = %d; want %d", i, tt.in, w.Code, tt.code)
+		}
+		if out != tt.out {
+			t.Errorf("%d: %s\nout  = %s\nwant = %s", i, tt.in, out, tt.out)
+		}
+	}
+
+	r, _ := inst.NewRequest("GET", "/_ah/api/rpc", strings.NewReader(""))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /_ah/api/rpc w.Code = %d; want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestServerServeJSONRPCBatch(t *testing.T) {
+	server := createRESTServer(t)
+	server.Platform = NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+
+	var (
+		mu       sync.Mutex
+		running  int
+		most     int
+		requests = make(map[*http.Request]bool)
+	)
+	server.Use(func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+		body, err := ioutil.ReadAll(call.HTTPRequest.Body)
+		mu.Lock()
+		if err != nil || len(body) == 0 {
+			t.Errorf("reading body of the call = %q, %v", body, err)
+		}
+		if HTTPRequest(c) != call.HTTPRequest {
+			t.Errorf("HTTPRequest(c) = %p; want %p", HTTPRequest(c), call.HTTPRequest)
+		}
+		requests[call.HTTPRequest] = true
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return next(c, call)
+	})
+
+	calls := make([]string, maxRPCBatchSize)
+	for i := range calls {
+		calls[i] = `{"jsonrpc":"2.0","id":` + strconv.Itoa(i) + `,"method":"rest.items.count"}`
+	}
+	r := httptest.NewRequest("POST", "/_ah/api/rpc", strings.NewReader("["+strings.Join(calls, ",")+"]"))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	var resps []*rpcResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resps); err != nil {
+		t.Fatalf("decoding response %s: %v", w.Body, err)
+	}
+	verifyPairs(t,
+		w.Code, http.StatusOK,
+		len(resps), maxRPCBatchSize,
+		len(requests), maxRPCBatchSize,
+		requests[r], false,
+		most <= maxRPCConcurrency, true,
+	)
+}
@@ -1,8 +1,26 @@
 package endpoints
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -143,7 +161,7 @@ func TestVerifySignedJWT(t *testing.T) {
 	ec := NewContext(r)
 
 	for i, tt := range tts {
-		jwt, err := verifySignedJWT(ec, tt.token, tt.now.Unix())
+		jwt, err := verifySignedJWT(ec, tt.token, googleIssuers, tt.now.Unix())
 		switch {
 		case err != nil && tt.want != nil:
 			t.Errorf("%d: verifySignedJWT(%q, %d) = %v; want %#v",
@@ -160,6 +178,489 @@ func TestVerifySignedJWT(t *testing.T) {
 	}
 }
 
+// testPrivateKey parses privateKeyPem.
+func testPrivateKey(t *testing.T) *rsa.PrivateKey {
+	block, _ := pem.Decode([]byte(privateKeyPem))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signTestJWT creates a token of jwtValidTokenObject with key ID kid,
+// signed by key.
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string) string {
+	return signTestClaims(t, key, kid, &jwtValidTokenObject)
+}
+
+// signTestClaims creates a token of claims with key ID kid, signed by key.
+func signTestClaims(t *testing.T, key *rsa.PrivateKey, kid string, claims *signedJWT) string {
+	return encodeTestJWT(t, &signedJWTHeader{Algorithm: "RS256", KeyID: kid}, claims,
+		testSigner(t, "RS256", key))
+}
+
+// encodeTestJWT creates a token of header and claims, signed by sign.
+// Claims are usually a *signedJWT, or a map for claims it can't encode.
+func encodeTestJWT(t *testing.T, header *signedJWTHeader, claims interface{},
+	sign func(signed string) []byte) string {
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(signed))
+}
+
+// testSigner returns a function which signs with key using JWS algorithm
+// alg, e.g. "RS256", "PS384" or "ES512".
+func testSigner(t *testing.T, alg string, key crypto.Signer) func(string) []byte {
+	hash := map[string]crypto.Hash{
+		"256": crypto.SHA256,
+		"384": crypto.SHA384,
+		"512": crypto.SHA512,
+	}[alg[2:]]
+	return func(signed string) []byte {
+		h := hash.New()
+		h.Write([]byte(signed))
+		digest := h.Sum(nil)
+
+		var (
+			sig []byte
+			err error
+		)
+		switch alg[:2] {
+		case "RS":
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hash, digest)
+		case "PS":
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			sig, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hash, digest, opts)
+		case "ES":
+			ec := key.(*ecdsa.PrivateKey)
+			var r, s *big.Int
+			if r, s, err = ecdsa.Sign(rand.Reader, ec, digest); err == nil {
+				size := (ec.Curve.Params().BitSize + 7) / 8
+				sig = make([]byte, 2*size)
+				r.FillBytes(sig[:size])
+				s.FillBytes(sig[size:])
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+}
+
+// testJWK returns a JSON Web Key of pub, an RSA or ECDSA key.
+func testJWK(kid string, pub crypto.PublicKey) *jsonWebKey {
+	enc := base64.RawURLEncoding
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &jsonWebKey{KeyType: "RSA", Use: "sig", KeyID: kid,
+			Modulus:  enc.EncodeToString(pub.N.Bytes()),
+			Exponent: enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		return &jsonWebKey{KeyType: "EC", Use: "sig", KeyID: kid,
+			Curve: pub.Curve.Params().Name,
+			X:     enc.EncodeToString(pub.X.Bytes()),
+			Y:     enc.EncodeToString(pub.Y.Bytes()),
+		}
+	}
+	panic(fmt.Sprintf("unsupported key %T", pub))
+}
+
+// testJWKSResponse returns a cacheable response with a JSON Web Key Set
+// of keys, indexed by their IDs.
+func testJWKSResponse(keys map[string]crypto.PublicKey) *http.Response {
+	set := &certsList{}
+	for kid, pub := range keys {
+		set.Keys = append(set.Keys, testJWK(kid, pub))
+	}
+	return testCertsResponse(set)
+}
+
+// testCertsResponse returns a cacheable response with certs.
+func testCertsResponse(certs *certsList) *http.Response {
+	body, _ := json.Marshal(certs)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Cache-Control": {"max-age=3600"},
+			"Age":           {"0"},
+		},
+		Body: ioutil.NopCloser(strings.NewReader(string(body))),
+	}
+}
+
+func TestVerifySignedJWTKeyID(t *testing.T) {
+	key := testPrivateKey(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := newTestRoundTripper(testJWKSResponse(map[string]crypto.PublicKey{
+		"goog-1": &key.PublicKey,
+		"goog-2": &other.PublicKey,
+	}))
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+	c := p.NewContext(httptest.NewRequest("GET", "/", nil))
+
+	tts := []struct {
+		token string
+		valid bool
+	}{
+		{signTestJWT(t, key, "goog-1"), true},
+		{signTestJWT(t, key, ""), true},
+		{signTestJWT(t, other, "goog-2"), true},
+		{signTestJWT(t, key, "goog-2"), false},
+		{signTestJWT(t, other, "goog-1"), false},
+		{jwtValidTokenString, true},
+		{jwtInvalidKeyToken, false},
+	}
+	for i, tt := range tts {
+		jwt, err := verifySignedJWT(c, tt.token, googleIssuers, jwtValidTokenTime.Unix())
+		switch {
+		case err != nil && tt.valid:
+			t.Errorf("%d: verifySignedJWT(%q) = %v", i, tt.token, err)
+		case err == nil && !tt.valid:
+			t.Errorf("%d: verifySignedJWT(%q) = %#v; want error", i, tt.token, jwt)
+		case err == nil && !reflect.DeepEqual(jwt, &jwtValidTokenObject):
+			t.Errorf("%d: verifySignedJWT(%q) = %#v; want %#v", i, tt.token, jwt, &jwtValidTokenObject)
+		}
+	}
+	if rt.Count() != 1 {
+		t.Errorf("rt.Count() = %d; want 1", rt.Count())
+	}
+}
+
+func TestVerifySignedJWTKeyRotation(t *testing.T) {
+	key := testPrivateKey(t)
+	old, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := newTestRoundTripper(
+		testJWKSResponse(map[string]crypto.PublicKey{"old": &old.PublicKey}),
+		testJWKSResponse(map[string]crypto.PublicKey{"old": &old.PublicKey, "new": &key.PublicKey}),
+	)
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+	c := p.NewContext(httptest.NewRequest("GET", "/", nil))
+	now := jwtValidTokenTime.Unix()
+
+	if _, err := verifySignedJWT(c, signTestJWT(t, old, "old"), googleIssuers, now); err != nil {
+		t.Fatalf("verifySignedJWT(old) = %v", err)
+	}
+	if _, err := verifySignedJWT(c, signTestJWT(t, key, "new"), googleIssuers, now); err != nil {
+		t.Errorf("verifySignedJWT(new) = %v", err)
+	}
+	if rt.Count() != 2 {
+		t.Errorf("rt.Count() = %d; want 2", rt.Count())
+	}
+
+	// Refreshed certs are cached and unknown keys don't force another fetch.
+	if _, err := verifySignedJWT(c, signTestJWT(t, key, "new"), googleIssuers, now); err != nil {
+		t.Errorf("verifySignedJWT(new) = %v", err)
+	}
+	if jwt, err := verifySignedJWT(c, signTestJWT(t, key, "unknown"), googleIssuers, now); err == nil {
+		t.Errorf("verifySignedJWT(unknown) = %#v; want error", jwt)
+	}
+	if rt.Count() != 2 {
+		t.Errorf("rt.Count() = %d; want 2", rt.Count())
+	}
+}
+
+func TestVerifySignedJWTAlgorithms(t *testing.T) {
+	rsaKey := testPrivateKey(t)
+	ecKeys := make(map[string]*ecdsa.PrivateKey)
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ecKeys[curve.Params().Name] = key
+	}
+	rs256Only := testJWK("rs256-only", &rsaKey.PublicKey)
+	rs256Only.Algorithm = "RS256"
+	certs := &certsList{Keys: []*jsonWebKey{testJWK("rsa", &rsaKey.PublicKey), rs256Only}}
+	for name, key := range ecKeys {
+		certs.Keys = append(certs.Keys, testJWK(name, &key.PublicKey))
+	}
+	rt := newTestRoundTripper(testCertsResponse(certs))
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+	c := p.NewContext(httptest.NewRequest("GET", "/", nil))
+
+	hs256 := func(signed string) []byte {
+		mac := hmac.New(sha256.New, rsaKey.PublicKey.N.Bytes())
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	}
+	derES256 := func(signed string) []byte {
+		digest := sha256.Sum256([]byte(signed))
+		sig, err := ecdsa.SignASN1(rand.Reader, ecKeys["P-256"], digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	none := func(string) []byte { return nil }
+
+	tts := []struct {
+		alg, kid string
+		sign     func(string) []byte
+		valid    bool
+	}{
+		{"RS256", "rsa", testSigner(t, "RS256", rsaKey), true},
+		{"RS384", "rsa", testSigner(t, "RS384", rsaKey), true},
+		{"RS512", "rsa", testSigner(t, "RS512", rsaKey), true},
+		{"PS256", "rsa", testSigner(t, "PS256", rsaKey), true},
+		{"PS384", "rsa", testSigner(t, "PS384", rsaKey), true},
+		{"PS512", "rsa", testSigner(t, "PS512", rsaKey), true},
+		{"ES256", "P-256", testSigner(t, "ES256", ecKeys["P-256"]), true},
+		{"ES384", "P-384", testSigner(t, "ES384", ecKeys["P-384"]), true},
+		{"ES512", "P-521", testSigner(t, "ES512", ecKeys["P-521"]), true},
+		{"ES256", "", testSigner(t, "ES256", ecKeys["P-256"]), true},
+		{"RS256", "rs256-only", testSigner(t, "RS256", rsaKey), true},
+
+		// Keys restricted to another algorithm.
+		{"RS384", "rs256-only", testSigner(t, "RS384", rsaKey), false},
+		// Signatures of another algorithm than the header's.
+		{"PS256", "rsa", testSigner(t, "RS256", rsaKey), false},
+		{"RS256", "rsa", testSigner(t, "PS256", rsaKey), false},
+		{"RS384", "rsa", testSigner(t, "RS256", rsaKey), false},
+		{"ES384", "P-384", testSigner(t, "ES256", ecKeys["P-384"]), false},
+		// Keys of another type or curve than the algorithm's.
+		{"ES256", "rsa", testSigner(t, "RS256", rsaKey), false},
+		{"ES256", "P-384", testSigner(t, "ES256", ecKeys["P-256"]), false},
+		{"ES384", "P-256", testSigner(t, "ES256", ecKeys["P-256"]), false},
+		// ASN.1 instead of JWS encoding of ECDSA signatures.
+		{"ES256", "P-256", derES256, false},
+		// Unsigned tokens and symmetric algorithms keyed with a public key.
+		{"none", "", none, false},
+		{"none", "rsa", none, false},
+		{"HS256", "rsa", hs256, false},
+	}
+	for i, tt := range tts {
+		token := encodeTestJWT(t, &signedJWTHeader{Algorithm: tt.alg, KeyID: tt.kid},
+			&jwtValidTokenObject, tt.sign)
+		jwt, err := verifySignedJWT(c, token, googleIssuers, jwtValidTokenTime.Unix())
+		switch {
+		case err != nil && tt.valid:
+			t.Errorf("%d: verifySignedJWT(%s, %q) = %v", i, tt.alg, tt.kid, err)
+		case err == nil && !tt.valid:
+			t.Errorf("%d: verifySignedJWT(%s, %q) = %#v; want error", i, tt.alg, tt.kid, jwt)
+		}
+	}
+}
+
+func TestVerifySignedJWTPadding(t *testing.T) {
+	key := testPrivateKey(t)
+	rt := newTestRoundTripper(testJWKSResponse(map[string]crypto.PublicKey{"goog-1": &key.PublicKey}))
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+	c := p.NewContext(httptest.NewRequest("GET", "/", nil))
+
+	// A signature of the right hash without PKCS#1 v1.5 padding and
+	// DigestInfo prefix.
+	token := signTestJWT(t, key, "goog-1")
+	signed := token[:strings.LastIndex(token, ".")]
+	hash := sha256.Sum256([]byte(signed))
+	em := make([]byte, key.Size())
+	for i := range em[1 : len(em)-len(hash)] {
+		em[i+1] = 0xaa
+	}
+	copy(em[len(em)-len(hash):], hash[:])
+	sig := new(big.Int).Exp(new(big.Int).SetBytes(em), key.D, key.N).Bytes()
+	forged := fmt.Sprintf("%s.%s", signed, base64.RawURLEncoding.EncodeToString(sig))
+
+	now := jwtValidTokenTime.Unix()
+	if _, err := verifySignedJWT(c, token, googleIssuers, now); err != nil {
+		t.Errorf("verifySignedJWT(%q) = %v", token, err)
+	}
+	if jwt, err := verifySignedJWT(c, forged, googleIssuers, now); err == nil {
+		t.Errorf("verifySignedJWT(%q) = %#v; want error", forged, jwt)
+	}
+}
+
+func TestCurrentIssuerPrincipal(t *testing.T) {
+	key := testPrivateKey(t)
+	corpKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corp := &Issuer{
+		Issuer:    "https://sso.example.com",
+		JWKSURI:   "https://sso.example.com/jwks",
+		Audiences: []string{"my-api"},
+	}
+	issuers := []*Issuer{GoogleIssuer("my-client-id"), FirebaseIssuer("my-project"), corp}
+
+	rt := newTestRoundTripper(
+		testJWKSResponse(map[string]crypto.PublicKey{"fb": &key.PublicKey}),
+		testJWKSResponse(map[string]crypto.PublicKey{"corp": &corpKey.PublicKey}),
+		testJWKSResponse(map[string]crypto.PublicKey{"goog": &key.PublicKey}),
+	)
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+	c := p.NewContext(httptest.NewRequest("GET", "/", nil))
+
+	claims := func(iss, aud, sub string) *signedJWT {
+		return &signedJWT{
+			Issuer:   iss,
+			Audience: aud,
+			Subject:  sub,
+			Expires:  jwtValidTokenObject.Expires,
+			IssuedAt: jwtValidTokenObject.IssuedAt,
+		}
+	}
+	corpAudiences := func(aud ...string) string {
+		return encodeTestJWT(t, &signedJWTHeader{Algorithm: "RS256", KeyID: "corp"}, map[string]interface{}{
+			"iss": corp.Issuer,
+			"aud": aud,
+			"sub": "corp-user",
+			"exp": jwtValidTokenObject.Expires,
+			"iat": jwtValidTokenObject.IssuedAt,
+		}, testSigner(t, "RS256", corpKey))
+	}
+	firebase := "https://securetoken.google.com/my-project"
+	tts := []struct {
+		token  string
+		wantID string
+	}{
+		{signTestClaims(t, key, "fb", claims(firebase, "my-project", "fb-user")), "fb-user"},
+		{signTestClaims(t, corpKey, "corp", claims(corp.Issuer, "my-api", "corp-user")), "corp-user"},
+		{signTestClaims(t, key, "goog", claims("https://accounts.google.com", "my-client-id", "1")), "1"},
+		{signTestClaims(t, key, "goog", claims("accounts.google.com", "my-client-id", "2")), "2"},
+		{signTestClaims(t, corpKey, "corp", claims(corp.Issuer, "my-project", "corp-user")), ""},
+		{signTestClaims(t, corpKey, "corp", claims(corp.Issuer, "my-api", "")), ""},
+		{signTestClaims(t, corpKey, "fb", claims(firebase, "my-project", "fb-user")), ""},
+		{signTestClaims(t, key, "fb", claims("https://evil.example.com", "my-project", "fb-user")), ""},
+		{corpAudiences("other-api", "my-api"), "corp-user"},
+		{corpAudiences("other-api"), ""},
+		{corpAudiences(), ""},
+	}
+	for i, tt := range tts {
+		p, err := currentIssuerPrincipal(c, tt.token, issuers, jwtValidTokenTime.Unix())
+		switch {
+		case err != nil && tt.wantID != "":
+			t.Errorf("%d: currentIssuerPrincipal(%q) = %v; want ID %q", i, tt.token, err, tt.wantID)
+		case err == nil && tt.wantID == "":
+			t.Errorf("%d: currentIssuerPrincipal(%q) = %#v; want error", i, tt.token, p)
+		case err == nil && (p.ID != tt.wantID || p.Claims["sub"] != tt.wantID):
+			t.Errorf("%d: currentIssuerPrincipal(%q) = %#v; want ID %q", i, tt.token, p, tt.wantID)
+		}
+	}
+
+	var uris []string
+	for _, r := range rt.reqs {
+		uris = append(uris, r.URL.String())
+	}
+	verifyPairs(t, uris, []string{FirebaseCertURI, corp.JWKSURI, DefaultCertURI})
+}
+
+func TestSignedJWTAudience(t *testing.T) {
+	tts := []struct {
+		in        string
+		audience  string
+		audiences []string
+	}{
+		{`{"aud":"my-api","sub":"1"}`, "my-api", nil},
+		{`{"aud":["my-api","other-api"],"sub":"1"}`, "my-api", []string{"my-api", "other-api"}},
+		{`{"aud":[],"sub":"1"}`, "", []string{}},
+		{`{"aud":null,"sub":"1"}`, "", nil},
+		{`{"sub":"1"}`, "", nil},
+	}
+	for i, tt := range tts {
+		var token signedJWT
+		if err := json.Unmarshal([]byte(tt.in), &token); err != nil {
+			t.Errorf("%d: json.Unmarshal(%s) = %v", i, tt.in, err)
+			continue
+		}
+		verifyPairs(t,
+			token.Subject, "1",
+			token.Audience, tt.audience,
+			token.Audiences, tt.audiences,
+		)
+	}
+
+	var token signedJWT
+	if err := json.Unmarshal([]byte(`{"aud":1}`), &token); err == nil {
+		t.Errorf("json.Unmarshal(aud = 1) = %#v; want error", token)
+	}
+
+	token = signedJWT{Audience: "my-api", Audiences: []string{"my-api", "other-api"}}
+	verifyPairs(t,
+		token.hasAudience([]string{"other-api"}), true,
+		token.hasAudience([]string{"third-api"}), false,
+	)
+}
+
+func TestCurrentUserMethodIssuers(t *testing.T) {
+	key := testPrivateKey(t)
+	rt := newTestRoundTripper(testJWKSResponse(map[string]crypto.PublicKey{"fb": &key.PublicKey}))
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	currentUTC = func() time.Time {
+		return jwtValidTokenTime
+	}
+
+	s := createDummyServer(t).ServiceByName("DummyService")
+	s.Info().Issuers = map[string]*Issuer{
+		"corp":     {Issuer: "https://sso.example.com", JWKSURI: "https://sso.example.com/jwks"},
+		"firebase": FirebaseIssuer("my-project"),
+	}
+	token := signTestClaims(t, key, "fb", &signedJWT{
+		Issuer:   "https://securetoken.google.com/my-project",
+		Audience: "my-project",
+		Subject:  "fb-user",
+		Expires:  jwtValidTokenObject.Expires,
+		IssuedAt: jwtValidTokenObject.IssuedAt,
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	tts := []struct {
+		method  string
+		issuers []string
+		wantID  string
+	}{
+		{"GetList", nil, "fb-user"},
+		{"GetList", []string{"firebase"}, "fb-user"},
+		{"PutAuth", []string{"corp"}, ""},
+		{"PutAuth", []string{}, ""},
+	}
+	for i, tt := range tts {
+		m := s.MethodByName(tt.method)
+		m.Info().Issuers = tt.issuers
+		c := context.WithValue(p.NewContext(r), methodCallKey, &MethodCall{Service: s, Method: m})
+		u, err := CurrentUser(c, nil, nil, nil)
+		switch {
+		case err != nil && tt.wantID != "":
+			t.Errorf("%d: CurrentUser() = %v; want ID %q", i, err, tt.wantID)
+		case err == nil && tt.wantID == "":
+			t.Errorf("%d: CurrentUser() = %#v; want error", i, u)
+		case err == nil && u.ID != tt.wantID:
+			t.Errorf("%d: CurrentUser().ID = %q; want %q", i, u.ID, tt.wantID)
+		}
+	}
+	if rt.Count() != 1 {
+		t.Errorf("rt.Count() = %d; want 1", rt.Count())
+	}
+}
+
 func TestVerifyParsedToken(t *testing.T) {
 	const (
 		goog     = "accounts.google.com"
@@ -200,7 +701,7 @@ func TestVerifyParsedToken(t *testing.T) {
 	}
 }
 
-func TestCurrentIDTokenUser(t *testing.T) {
+func TestCurrentIDTokenPrincipal(t *testing.T) {
 	jwtOrigParser := jwtParser
 	defer func() {
 		jwtParser = jwtOrigParser
@@ -233,7 +734,7 @@ func TestCurrentIDTokenUser(t *testing.T) {
 
 	var currToken *signedJWT
 
-	jwtParser = func(context.Context, string, int64) (*signedJWT, error) {
+	jwtParser = func(context.Context, string, []*Issuer, int64) (*signedJWT, error) {
 		if currToken == nil {
 			return nil, errors.New("Fake verification failed")
 		}
@@ -242,18 +743,27 @@ func TestCurrentIDTokenUser(t *testing.T) {
 
 	for i, tt := range tts {
 		currToken = tt.token
-		user, err := currentIDTokenUser(c,
+		p, err := currentIDTokenPrincipal(c,
 			jwtValidTokenString, aud, azp, jwtValidTokenTime.Unix())
 		switch {
 		case tt.wantEmail != "" && err != nil:
-			t.Errorf("%d: currentIDTokenUser(%q, %v, %v, %d) = %v; want email = %q",
+			t.Errorf("%d: currentIDTokenPrincipal(%q, %v, %v, %d) = %v; want email = %q",
 				i, jwtValidTokenString, aud, azp, jwtValidTokenTime.Unix(), err, tt.wantEmail)
 		case tt.wantEmail == "" && err == nil:
-			t.Errorf("%d: currentIDTokenUser(%q, %v, %v, %d) = %#v; want error",
-				i, jwtValidTokenString, aud, azp, jwtValidTokenTime.Unix(), user)
-		case err == nil && tt.wantEmail != user.Email:
-			t.Errorf("%d: currentIDTokenUser(%q, %v, %v, %d) = %#v; want email = %q",
-				i, jwtValidTokenString, aud, azp, jwtValidTokenTime.Unix(), user, tt.wantEmail)
+			t.Errorf("%d: currentIDTokenPrincipal(%q, %v, %v, %d) = %#v; want error",
+				i, jwtValidTokenString, aud, azp, jwtValidTokenTime.Unix(), p)
+		case err == nil && tt.wantEmail != p.Email:
+			t.Errorf("%d: currentIDTokenPrincipal(%q, %v, %v, %d) = %#v; want email = %q",
+				i, jwtValidTokenString, aud, azp, jwtValidTokenTime.Unix(), p, tt.wantEmail)
+		case err == nil:
+			// Claims come from the token string rather than the fake parser.
+			verifyPairs(t,
+				p.Method, AuthIDToken,
+				p.Issuer, tt.token.Issuer,
+				p.Expires, time.Unix(tt.token.Expires, 0).UTC(),
+				p.Claims["azp"], "hello-android",
+				p.User().Email, tt.wantEmail,
+			)
 		}
 	}
 }
@@ -0,0 +1,781 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIVersion is the version of OpenAPI Specification documents created
+// by RPCService.OpenAPI and Server.OpenAPI.
+const OpenAPIVersion = "3.0.3"
+
+// Names of security schemes of OpenAPI documents. Methods with different
+// sets of ID token audiences get their own "google_id_token_N" scheme.
+// Issuers of ServiceInfo.Issuers get an "issuer_NAME" scheme.
+const (
+	openAPIOAuth2Scheme  = "google_oauth2"
+	openAPIIDTokenScheme = "google_id_token"
+	openAPIIssuerScheme  = "issuer_"
+)
+
+// Google OAuth 2.0 endpoints used in security schemes.
+const (
+	googleAuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleIssuer  = "https://accounts.google.com"
+	googleJWKSURI = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+// OpenAPIDoc is an OpenAPI 3.0 document describing the REST surface of
+// one or more APIs.
+//
+// See https://spec.openapis.org/oas/v3.0.3.
+type OpenAPIDoc struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Servers    []*OpenAPIServer           `json:"servers"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+}
+
+// OpenAPIInfo is the metadata of an OpenAPI document.
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Desc    string `json:"description,omitempty"`
+	Version string `json:"version"`
+}
+
+// OpenAPIServer is the base URL of all paths of an OpenAPI document.
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIPathItem maps lower case HTTP methods, e.g. "get", to operations
+// available on a path.
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+// OpenAPIOperation describes a single API method.
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Desc        string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+}
+
+// OpenAPIParameter describes a path or query parameter of an operation.
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody describes a JSON request body of an operation.
+type OpenAPIRequestBody struct {
+	Content map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes a response of an operation.
+type OpenAPIResponse struct {
+	Desc    string                       `json:"description"`
+	Content map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType is a schema of a request or response body.
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema is a schema of a type, one of its properties or
+// a parameter.
+type OpenAPISchema struct {
+	Ref        string                    `json:"$ref,omitempty"`
+	Type       string                    `json:"type,omitempty"`
+	Format     string                    `json:"format,omitempty"`
+	Desc       string                    `json:"description,omitempty"`
+	Items      *OpenAPISchema            `json:"items,omitempty"`
+	Properties map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required   []string                  `json:"required,omitempty"`
+	Default    interface{}               `json:"default,omitempty"`
+	Min        interface{}               `json:"minimum,omitempty"`
+	Max        interface{}               `json:"maximum,omitempty"`
+	Pattern    string                    `json:"pattern,omitempty"`
+	MinLength  int                       `json:"minLength,omitempty"`
+	MaxLength  int                       `json:"maxLength,omitempty"`
+	MinItems   int                       `json:"minItems,omitempty"`
+	MaxItems   int                       `json:"maxItems,omitempty"`
+	// Enum lists valid values, of the type of the schema.
+	Enum []interface{} `json:"enum,omitempty"`
+	// AdditionalProperties describes values of a map.
+	AdditionalProperties *OpenAPISchema `json:"additionalProperties,omitempty"`
+}
+
+// OpenAPIComponents holds schemas and security schemes referenced from
+// operations.
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// OpenAPISecurityScheme describes how an operation is authorized.
+type OpenAPISecurityScheme struct {
+	Type         string             `json:"type"`
+	Desc         string             `json:"description,omitempty"`
+	Scheme       string             `json:"scheme,omitempty"`
+	BearerFormat string             `json:"bearerFormat,omitempty"`
+	Flows        *OpenAPIOAuthFlows `json:"flows,omitempty"`
+	GoogleAuth   *OpenAPIGoogleAuth `json:"x-google-auth,omitempty"`
+}
+
+// OpenAPIOAuthFlows lists OAuth 2.0 flows of a security scheme.
+type OpenAPIOAuthFlows struct {
+	Implicit *OpenAPIOAuthFlow `json:"implicit,omitempty"`
+}
+
+// OpenAPIOAuthFlow is an OAuth 2.0 flow and scopes available with it.
+type OpenAPIOAuthFlow struct {
+	AuthorizationURL string            `json:"authorizationUrl"`
+	Scopes           map[string]string `json:"scopes"`
+}
+
+// OpenAPIGoogleAuth is the x-google-auth extension of a security scheme.
+// Cloud Endpoints and API Gateway use it to validate JWTs.
+type OpenAPIGoogleAuth struct {
+	Issuer    string   `json:"issuer"`
+	JWKSURI   string   `json:"jwksUri"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// OpenAPI populates provided OpenAPIDoc with an OpenAPI 3.0 description of
+// its receiver's REST surface.
+//
+// Args:
+//   - dst, a non-nil pointer to OpenAPIDoc struct
+//   - host, a hostname used for the document's server URL.
+//
+// The document is built from the same data as APIDescriptor and the same
+// errors are returned.
+func (s *RPCService) OpenAPI(dst *OpenAPIDoc, host string) error {
+	if dst == nil {
+		return errors.New("Destination OpenAPIDoc is nil")
+	}
+	if host == "" {
+		return errors.New("Empty host parameter")
+	}
+	rootURL := apiRootURL(host, defaultAPIRoot, false)
+	if err := newOpenAPIDoc(dst, []*RPCService{s}, host, rootURL); err != nil {
+		return err
+	}
+	dst.Info = OpenAPIInfo{
+		Title:   s.info.Name,
+		Desc:    s.info.Description,
+		Version: s.info.Version,
+	}
+	return nil
+}
+
+// OpenAPI populates provided OpenAPIDoc with an OpenAPI 3.0 description of
+// all public services registered with s, see RPCService.OpenAPI.
+//
+// When the services make up a single API, the document is titled after it.
+// Otherwise the title is host and the version lists all "name:version" pairs.
+func (s *Server) OpenAPI(dst *OpenAPIDoc, host string) error {
+	if dst == nil {
+		return errors.New("Destination OpenAPIDoc is nil")
+	}
+	if host == "" {
+		return errors.New("Empty host parameter")
+	}
+	services := s.services.publicServices()
+	if len(services) == 0 {
+		return errors.New("No public services registered")
+	}
+	rootURL := apiRootURL(host, s.apiRoot, false)
+	if err := newOpenAPIDoc(dst, services, host, rootURL); err != nil {
+		return err
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, svc := range services {
+		id := svc.info.Name + ":" + svc.info.Version
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 1 {
+		info := services[0].info
+		dst.Info = OpenAPIInfo{Title: info.Name, Desc: info.Description, Version: info.Version}
+		return nil
+	}
+	sort.Strings(ids)
+	dst.Info = OpenAPIInfo{Title: host, Version: strings.Join(ids, ", ")}
+	return nil
+}
+
+// YAML encodes d in YAML format.
+func (d *OpenAPIDoc) YAML() ([]byte, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(b)
+}
+
+// newOpenAPIDoc populates dst with everything but Info from services.
+func newOpenAPIDoc(dst *OpenAPIDoc, services []*RPCService, host, rootURL string) error {
+	descs := make([]*APIDescriptor, 0, len(services))
+	versions := make(map[string]map[string]bool)
+	for _, s := range services {
+		d := &APIDescriptor{}
+		if err := s.APIDescriptor(d, host); err != nil {
+			return err
+		}
+		descs = append(descs, d)
+		if versions[d.Name] == nil {
+			versions[d.Name] = make(map[string]bool)
+		}
+		versions[d.Name][d.Version] = true
+	}
+
+	dst.OpenAPI = OpenAPIVersion
+	dst.Servers = []*OpenAPIServer{{URL: strings.TrimSuffix(rootURL, "/")}}
+	dst.Paths = make(map[string]OpenAPIPathItem)
+	dst.Components.Schemas = make(map[string]*OpenAPISchema)
+	sec := newOpenAPISecurity(descs)
+	if len(sec.schemes) > 0 {
+		dst.Components.SecuritySchemes = sec.schemes
+	}
+
+	types := make(schemaTypes)
+	for _, d := range descs {
+		if err := types.addSchemas(d.Descriptor.Schemas); err != nil {
+			return err
+		}
+		for ref, sd := range d.Descriptor.Schemas {
+			dst.Components.Schemas[ref] = openAPISchema(sd)
+		}
+		for name, apim := range d.Methods {
+			// Operation IDs must be unique within a document.
+			id := name
+			if len(versions[d.Name]) > 1 {
+				id = d.Name + "." + d.Version + strings.TrimPrefix(name, d.Name)
+			}
+			op, err := openAPIOperation(id, apim, d.Descriptor.Methods[apim.RosyMethod])
+			if err != nil {
+				return err
+			}
+			op.Tags = []string{d.Name}
+			op.Security = sec.requirements(d, apim)
+
+			path := "/" + d.Name + "/" + d.Version + "/" + strings.TrimPrefix(apim.Path, "/")
+			item := dst.Paths[path]
+			if item == nil {
+				item = make(OpenAPIPathItem)
+				dst.Paths[path] = item
+			}
+			verb := strings.ToLower(apim.HTTPMethod)
+			if _, exists := item[verb]; exists {
+				return fmt.Errorf(`"%s %s" is already registered`, apim.HTTPMethod, path)
+			}
+			item[verb] = op
+		}
+	}
+	return nil
+}
+
+// openAPIOperation creates an OpenAPIOperation from APIMethod and its
+// schema descriptor.
+func openAPIOperation(id string, apim *APIMethod, md *APIMethodDescriptor) (
+	*OpenAPIOperation, error) {
+
+	op := &OpenAPIOperation{
+		OperationID: id,
+		Desc:        apim.Desc,
+		Responses:   make(map[string]*OpenAPIResponse),
+	}
+
+	pathParams, err := parsePath(apim.Path)
+	if err != nil {
+		return nil, err
+	}
+	// Path parameters come first, in the order they appear in the path,
+	// followed by query parameters sorted by name.
+	inPath := make(map[string]bool, len(pathParams))
+	for _, name := range pathParams {
+		inPath[name] = true
+	}
+	var query []string
+	for name := range apim.Request.Params {
+		if !inPath[name] {
+			query = append(query, name)
+		}
+	}
+	sort.Strings(query)
+	for _, name := range append(pathParams, query...) {
+		spec := apim.Request.Params[name]
+		if spec == nil {
+			continue
+		}
+		p := &OpenAPIParameter{
+			Name:     name,
+			In:       "query",
+			Required: spec.Required,
+			Schema:   openAPIParamSchema(spec),
+		}
+		if inPath[name] {
+			p.In, p.Required = "path", true
+		}
+		op.Parameters = append(op.Parameters, p)
+	}
+
+	if md != nil && md.Request != nil {
+		op.RequestBody = &OpenAPIRequestBody{Content: openAPIJSONContent(md.Request.Ref)}
+	}
+	if md != nil && md.Response != nil {
+		op.Responses["200"] = &OpenAPIResponse{
+			Desc:    "A successful response",
+			Content: openAPIJSONContent(md.Response.Ref),
+		}
+	} else {
+		op.Responses["204"] = &OpenAPIResponse{Desc: "No Content"}
+	}
+	return op, nil
+}
+
+// openAPIJSONContent returns a JSON body content referencing schema ref.
+func openAPIJSONContent(ref string) map[string]*OpenAPIMediaType {
+	return map[string]*OpenAPIMediaType{
+		"application/json": {Schema: &OpenAPISchema{Ref: openAPIRef(ref)}},
+	}
+}
+
+// openAPIRef returns a reference to a schema in the components section.
+func openAPIRef(ref string) string {
+	return "#/components/schemas/" + ref
+}
+
+// openAPIParamSchema converts APIRequestParamSpec into an OpenAPISchema.
+func openAPIParamSchema(spec *APIRequestParamSpec) *OpenAPISchema {
+	s := &OpenAPISchema{}
+	s.Type, s.Format = paramTypeToPropFormat(spec.Type)
+	s.Default = openAPIValue(s.Type, spec.Default)
+	if s.Type == "integer" || s.Type == "number" {
+		s.Min, s.Max = spec.Min, spec.Max
+	}
+	s.Pattern = spec.Pattern
+	var enum []string
+	for name := range spec.Enum {
+		enum = append(enum, name)
+	}
+	sort.Strings(enum)
+	s.Enum = openAPIEnum(s.Type, enum)
+	if spec.Repeated {
+		s = &OpenAPISchema{Type: "array", Items: s}
+	}
+	return s
+}
+
+// openAPISchema converts APISchemaDescriptor into an OpenAPISchema.
+func openAPISchema(sd *APISchemaDescriptor) *OpenAPISchema {
+	s := &OpenAPISchema{
+		Type:       sd.Type,
+		Desc:       sd.Desc,
+		Properties: make(map[string]*OpenAPISchema, len(sd.Properties)),
+	}
+	for name, prop := range sd.Properties {
+		s.Properties[name] = openAPIProperty(prop)
+		if prop.Required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// openAPIProperty converts APISchemaProperty into an OpenAPISchema.
+func openAPIProperty(prop *APISchemaProperty) *OpenAPISchema {
+	if prop.Ref != "" {
+		// Siblings of $ref are ignored by OpenAPI 3.0 tools.
+		return &OpenAPISchema{Ref: openAPIRef(prop.Ref)}
+	}
+	s := &OpenAPISchema{
+		Type:    prop.Type,
+		Format:  prop.Format,
+		Desc:    prop.Desc,
+		Default: openAPIValue(prop.Type, prop.Default),
+		Pattern: prop.Pattern,
+		Enum:    openAPIEnum(prop.Type, prop.Enum),
+	}
+	s.MinLength, s.MaxLength = prop.MinLength, prop.MaxLength
+	s.MinItems, s.MaxItems = prop.MinItems, prop.MaxItems
+	if s.Type == "integer" || s.Type == "number" {
+		s.Min, s.Max = prop.Min, prop.Max
+	}
+	if s.Type == "any" {
+		// A schema without a type matches any value.
+		s.Type = ""
+	}
+	if prop.Items != nil {
+		s.Items = openAPIProperty(prop.Items)
+	}
+	if prop.AdditionalProperties != nil {
+		s.AdditionalProperties = openAPIProperty(prop.AdditionalProperties)
+	}
+	return s
+}
+
+// openAPIValue converts a default value v of a schema of type typ so that
+// it matches the type, e.g. int64 values are strings.
+func openAPIValue(typ string, v interface{}) interface{} {
+	if v == nil || typ != "string" {
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// openAPIEnum converts enum values, which are strings as written in tags,
+// to values of a schema of type typ, e.g. numbers of an integer schema.
+// Values which are not of the type are kept as strings.
+func openAPIEnum(typ string, values []string) []interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	enum := make([]interface{}, len(values))
+	for i, v := range values {
+		enum[i] = v
+		switch typ {
+		case "integer":
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				enum[i] = n
+			} else if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+				enum[i] = n
+			}
+		case "number":
+			if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				enum[i] = f
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(v); err == nil {
+				enum[i] = b
+			}
+		}
+	}
+	return enum
+}
+
+// openAPISecurity holds security schemes of a set of APIs.
+type openAPISecurity struct {
+	schemes map[string]*OpenAPISecurityScheme
+	// idTokens maps comma separated ID token audiences to scheme names.
+	idTokens map[string]string
+	// issuers maps issuers of each API, by name, to scheme names.
+	issuers map[*APIDescriptor]map[string]string
+}
+
+// newOpenAPISecurity creates security schemes from auth settings of
+// all methods of descs: an OAuth 2.0 scheme with all the scopes,
+// an ID token scheme for each distinct set of audiences and a bearer
+// token scheme for each distinct issuer.
+func newOpenAPISecurity(descs []*APIDescriptor) *openAPISecurity {
+	sec := &openAPISecurity{
+		schemes:  make(map[string]*OpenAPISecurityScheme),
+		idTokens: make(map[string]string),
+		issuers:  make(map[*APIDescriptor]map[string]string),
+	}
+	scopes := make(map[string]string)
+	auds := make(map[string][]string)
+	for _, d := range descs {
+		for _, m := range d.Methods {
+			for _, scope := range m.Scopes {
+				scopes[scope] = scope
+			}
+			if a := openAPIAudiences(m); len(a) > 0 {
+				auds[strings.Join(a, ",")] = a
+			}
+		}
+	}
+
+	if len(scopes) > 0 {
+		sec.schemes[openAPIOAuth2Scheme] = &OpenAPISecurityScheme{
+			Type: "oauth2",
+			Desc: "Google OAuth 2.0 access token",
+			Flows: &OpenAPIOAuthFlows{Implicit: &OpenAPIOAuthFlow{
+				AuthorizationURL: googleAuthURL,
+				Scopes:           scopes,
+			}},
+		}
+	}
+
+	keys := make([]string, 0, len(auds))
+	for k := range auds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		name := openAPIIDTokenScheme
+		if i > 0 {
+			name += "_" + strconv.Itoa(i+1)
+		}
+		sec.idTokens[k] = name
+		sec.schemes[name] = &OpenAPISecurityScheme{
+			Type: "oauth2",
+			Desc: "Google ID token",
+			Flows: &OpenAPIOAuthFlows{Implicit: &OpenAPIOAuthFlow{
+				AuthorizationURL: googleAuthURL,
+				Scopes:           map[string]string{},
+			}},
+			GoogleAuth: &OpenAPIGoogleAuth{
+				Issuer:    googleIssuer,
+				JWKSURI:   googleJWKSURI,
+				Audiences: auds[k],
+			},
+		}
+	}
+
+	for _, d := range descs {
+		sec.addIssuers(d)
+	}
+	return sec
+}
+
+// addIssuers adds a scheme for each issuer of d. Issuers of different APIs
+// with the same name and settings share a scheme.
+func (sec *openAPISecurity) addIssuers(d *APIDescriptor) {
+	names := make([]string, 0, len(d.Issuers))
+	for name := range d.Issuers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sec.issuers[d] = make(map[string]string, len(names))
+	for _, name := range names {
+		iss := d.Issuers[name]
+		scheme := &OpenAPISecurityScheme{
+			Type:         "http",
+			Desc:         "ID token of " + iss.Issuer,
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+			GoogleAuth: &OpenAPIGoogleAuth{
+				Issuer:    iss.Issuer,
+				JWKSURI:   iss.JWKSURI,
+				Audiences: iss.Audiences,
+			},
+		}
+		key := openAPIIssuerScheme + name
+		for i := 2; sec.schemes[key] != nil; i++ {
+			if reflect.DeepEqual(sec.schemes[key], scheme) {
+				break
+			}
+			key = openAPIIssuerScheme + name + "_" + strconv.Itoa(i)
+		}
+		sec.schemes[key] = scheme
+		sec.issuers[d][name] = key
+	}
+}
+
+// requirements returns security requirements of m, a method of d, any of
+// which is enough to call the method.
+func (sec *openAPISecurity) requirements(d *APIDescriptor, m *APIMethod) []map[string][]string {
+	var reqs []map[string][]string
+	if len(m.Scopes) > 0 {
+		reqs = append(reqs, map[string][]string{openAPIOAuth2Scheme: m.Scopes})
+	}
+	if a := openAPIAudiences(m); len(a) > 0 {
+		name := sec.idTokens[strings.Join(a, ",")]
+		reqs = append(reqs, map[string][]string{name: {}})
+	}
+	for _, iss := range m.Issuers {
+		reqs = append(reqs, map[string][]string{sec.issuers[d][iss]: {}})
+	}
+	return reqs
+}
+
+// openAPIAudiences returns sorted audiences of ID tokens accepted by m.
+// Client IDs are included since verifyParsedToken accepts tokens issued
+// to any of them.
+func openAPIAudiences(m *APIMethod) []string {
+	seen := make(map[string]bool)
+	var auds []string
+	for _, list := range [][]string{m.Audiences, m.ClientIds} {
+		for _, a := range list {
+			if !seen[a] {
+				seen[a] = true
+				auds = append(auds, a)
+			}
+		}
+	}
+	sort.Strings(auds)
+	return auds
+}
+
+// jsonToYAML converts a JSON document into YAML, preserving the order of
+// object keys.
+func jsonToYAML(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeYAML(&buf, v, 0, "")
+	return buf.Bytes(), nil
+}
+
+// orderedObject is a JSON object with keys in their original order.
+type orderedObject struct {
+	keys []string
+	vals []interface{}
+}
+
+// decodeOrdered decodes the next JSON value from dec. Objects are decoded
+// into *orderedObject, arrays into []interface{}.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := &orderedObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, key.(string))
+			obj.vals = append(obj.vals, val)
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// writeYAML writes v in block style at the given indentation. The first
+// line starts with lead instead of indentation, which is how items of
+// a sequence ("- ") are written.
+func writeYAML(w io.Writer, v interface{}, indent int, lead string) {
+	pad := strings.Repeat(" ", indent)
+	if lead == "" {
+		lead = pad
+	}
+	switch v := v.(type) {
+	case *orderedObject:
+		for i, key := range v.keys {
+			if i > 0 {
+				lead = pad
+			}
+			fmt.Fprintf(w, "%s%s:", lead, yamlScalar(key))
+			writeYAMLValue(w, v.vals[i], indent+2)
+		}
+	case []interface{}:
+		for i, item := range v {
+			if i > 0 {
+				lead = pad
+			}
+			if isYAMLScalar(item) {
+				fmt.Fprintf(w, "%s- %s\n", lead, yamlScalar(item))
+				continue
+			}
+			writeYAML(w, item, indent+2, lead+"- ")
+		}
+	}
+}
+
+// writeYAMLValue writes v following a mapping key.
+func writeYAMLValue(w io.Writer, v interface{}, indent int) {
+	switch {
+	case isYAMLScalar(v):
+		fmt.Fprintf(w, " %s\n", yamlScalar(v))
+	default:
+		fmt.Fprintln(w)
+		writeYAML(w, v, indent, "")
+	}
+}
+
+// isYAMLScalar returns true if v is written on a single line: a scalar,
+// an empty object or an empty array.
+func isYAMLScalar(v interface{}) bool {
+	switch v := v.(type) {
+	case *orderedObject:
+		return len(v.keys) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return true
+}
+
+// yamlScalar formats a scalar value produced by decodeOrdered. Strings are
+// double-quoted unless that is not needed to read them back as strings.
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case *orderedObject:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	case string:
+		if isPlainYAMLString(v) {
+			return v
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// isPlainYAMLString returns true if s can be written as a plain (unquoted)
+// YAML scalar without being read back as a number, boolean or null.
+func isPlainYAMLString(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "y", "n", "on", "off", "null", "~":
+		return false
+	}
+	if c := s[0]; !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$') {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '_', c == '-', c == '.', c == '/', c == '$':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,294 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// createOpenAPIDoc creates OpenAPIDoc for DummyService.
+func createOpenAPIDoc(t *testing.T) *OpenAPIDoc {
+	server := createDummyServer(t)
+	d := &OpenAPIDoc{}
+	if err := server.ServiceByName("DummyService").OpenAPI(d, "testhost:1234"); err != nil {
+		t.Fatalf("createOpenAPIDoc: error creating OpenAPI doc: %v", err)
+	}
+	return d
+}
+
+func TestOpenAPIDoc(t *testing.T) {
+	d := createOpenAPIDoc(t)
+	verifyPairs(t,
+		d.OpenAPI, OpenAPIVersion,
+		d.Info, OpenAPIInfo{Title: "dummy", Desc: "A service", Version: "v1"},
+		d.Servers[0].URL, "https://testhost:1234/_ah/api",
+		len(d.Paths), 4,
+		len(d.Components.Schemas), 3,
+		len(d.Components.SecuritySchemes), 2,
+	)
+
+	post := d.Paths["/dummy/v1/post/{i}/{bool_field}/{Float64}"]["post"]
+	if post == nil {
+		t.Fatalf("want POST operation in %v", d.Paths)
+	}
+	verifyPairs(t,
+		post.OperationID, "dummy.post",
+		post.Desc, "A POST method",
+		post.Tags, []string{"dummy"},
+		len(post.Parameters), 3,
+		post.RequestBody.Content["application/json"].Schema.Ref, "#/components/schemas/DummyMsg",
+		post.Responses["200"].Content["application/json"].Schema.Ref, "#/components/schemas/DummySubMsg",
+		len(post.Security), 0,
+	)
+	verifyPairs(t,
+		post.Parameters[0], &OpenAPIParameter{Name: "i", In: "path", Required: true,
+			Schema: &OpenAPISchema{Type: "integer", Format: "int32", Default: -100, Min: -200, Max: 200}},
+		post.Parameters[1].Name, "bool_field",
+		post.Parameters[2].Name, "Float64",
+	)
+
+	get := d.Paths["/dummy/v1/sub/{simple}/{msg.i}/{msg.str}"]["get"]
+	if get == nil {
+		t.Fatalf("want GET operation in %v", d.Paths)
+	}
+	verifyPairs(t,
+		get.OperationID, "dummy.sub.sub",
+		get.RequestBody, (*OpenAPIRequestBody)(nil),
+		get.Parameters[0].Name, "simple",
+		get.Parameters[1].Name, "msg.i",
+		get.Parameters[2].Name, "msg.str",
+		get.Parameters[3].In, "query",
+	)
+	for _, p := range get.Parameters {
+		if p.Name == "msg.Int64" {
+			verifyPairs(t, p.Schema, &OpenAPISchema{Type: "string", Format: "int64", Default: "123"})
+		}
+	}
+}
+
+func TestOpenAPISecurity(t *testing.T) {
+	d := createOpenAPIDoc(t)
+
+	auth := d.Paths["/dummy/v1/auth"]["put"]
+	if auth == nil {
+		t.Fatalf("want PUT operation in %v", d.Paths)
+	}
+	want := []map[string][]string{
+		{"google_oauth2": scopes},
+		{"google_id_token": {}},
+	}
+	verifyPairs(t,
+		auth.Security, want,
+		auth.Responses["204"], &OpenAPIResponse{Desc: "No Content"},
+	)
+
+	oauth2 := d.Components.SecuritySchemes["google_oauth2"]
+	idToken := d.Components.SecuritySchemes["google_id_token"]
+	if oauth2 == nil || idToken == nil {
+		t.Fatalf("want google_oauth2 and google_id_token in %v", d.Components.SecuritySchemes)
+	}
+	verifyPairs(t,
+		oauth2.Type, "oauth2",
+		len(oauth2.Flows.Implicit.Scopes), len(scopes),
+		oauth2.GoogleAuth, (*OpenAPIGoogleAuth)(nil),
+		idToken.GoogleAuth, &OpenAPIGoogleAuth{
+			Issuer:    googleIssuer,
+			JWKSURI:   googleJWKSURI,
+			Audiences: []string{dummyClientID, dummyAudience},
+		},
+	)
+}
+
+func TestOpenAPIIssuers(t *testing.T) {
+	server := createDummyServer(t)
+	s := server.ServiceByName("DummyService")
+	s.Info().Issuers = map[string]*Issuer{
+		"corp":     {Issuer: "https://sso.example.com", JWKSURI: "https://sso.example.com/jwks"},
+		"firebase": FirebaseIssuer("my-project"),
+	}
+	s.MethodByName("PutAuth").Info().Issuers = []string{"corp"}
+
+	d := &OpenAPIDoc{}
+	if err := s.OpenAPI(d, "testhost:1234"); err != nil {
+		t.Fatalf("OpenAPI() = %v", err)
+	}
+	verifyPairs(t,
+		len(d.Components.SecuritySchemes), 4,
+		d.Paths["/dummy/v1/auth"]["put"].Security, []map[string][]string{
+			{"google_oauth2": scopes},
+			{"google_id_token": {}},
+			{"issuer_corp": {}},
+		},
+		d.Paths["/dummy/v1/list"]["get"].Security, []map[string][]string{
+			{"issuer_corp": {}},
+			{"issuer_firebase": {}},
+		},
+		d.Components.SecuritySchemes["issuer_firebase"], &OpenAPISecurityScheme{
+			Type:         "http",
+			Desc:         "ID token of https://securetoken.google.com/my-project",
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+			GoogleAuth: &OpenAPIGoogleAuth{
+				Issuer:    "https://securetoken.google.com/my-project",
+				JWKSURI:   FirebaseCertURI,
+				Audiences: []string{"my-project"},
+			},
+		},
+	)
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	d := createOpenAPIDoc(t)
+
+	msg := d.Components.Schemas["DummyMsg"]
+	sub := d.Components.Schemas["DummySubMsg"]
+	list := d.Components.Schemas["DummyListMsg"]
+	if msg == nil || sub == nil || list == nil {
+		t.Fatalf("want DummyMsg, DummySubMsg and DummyListMsg in %v", d.Components.Schemas)
+	}
+	verifyPairs(t,
+		msg.Type, "object",
+		msg.Required, []string{"str"},
+		msg.Properties["str"], &OpenAPISchema{Type: "string", Desc: "A string field"},
+		msg.Properties["Uint"], &OpenAPISchema{Type: "integer", Format: "uint32", Min: uint32(0), Max: uint32(100)},
+		msg.Properties["Uint64"], &OpenAPISchema{Type: "string", Format: "uint64", Default: "123"},
+		sub.Properties["msg"], &OpenAPISchema{Ref: "#/components/schemas/DummyMsg"},
+		list.Properties["items"], &OpenAPISchema{Type: "array",
+			Items: &OpenAPISchema{Ref: "#/components/schemas/DummyMsg"}},
+	)
+}
+
+func TestOpenAPIConstraints(t *testing.T) {
+	str := &APISchemaProperty{Type: "string", Pattern: "^[a-z]+$", MinLength: 1, MaxLength: 10}
+	list := &APISchemaProperty{Type: "array", MinItems: 1, MaxItems: 5,
+		Items: &APISchemaProperty{Type: "string", Enum: []string{"a", "b"}}}
+	param := &APIRequestParamSpec{Type: "string", Pattern: "^[a-z]+$"}
+	verifyPairs(t,
+		openAPIProperty(str), &OpenAPISchema{Type: "string", Pattern: "^[a-z]+$", MinLength: 1, MaxLength: 10},
+		openAPIProperty(list), &OpenAPISchema{Type: "array", MinItems: 1, MaxItems: 5,
+			Items: &OpenAPISchema{Type: "string", Enum: []interface{}{"a", "b"}}},
+		openAPIParamSchema(param), &OpenAPISchema{Type: "string", Pattern: "^[a-z]+$"},
+	)
+}
+
+func TestOpenAPIEnum(t *testing.T) {
+	level := &APISchemaProperty{Type: "integer", Format: "int32", Enum: []string{"1", "2"}}
+	ratio := &APISchemaProperty{Type: "number", Format: "double", Enum: []string{"0.5", "1"}}
+	flag := &APISchemaProperty{Type: "boolean", Enum: []string{"true"}}
+	id := &APISchemaProperty{Type: "string", Format: "int64", Enum: []string{"1", "2"}}
+	param := &APIRequestParamSpec{Type: "uint32", Enum: map[string]*APIEnumParamSpec{
+		"3": {BackendVal: "3"}, "1": {BackendVal: "1"}}}
+	verifyPairs(t,
+		openAPIProperty(level).Enum, []interface{}{int64(1), int64(2)},
+		openAPIProperty(ratio).Enum, []interface{}{0.5, 1.0},
+		openAPIProperty(flag).Enum, []interface{}{true},
+		openAPIProperty(id).Enum, []interface{}{"1", "2"},
+		openAPIParamSchema(param).Enum, []interface{}{int64(1), int64(3)},
+	)
+
+	b, err := json.Marshal(openAPIProperty(level))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"type":"integer","format":"int32","enum":[1,2]}`; string(b) != want {
+		t.Errorf("json.Marshal(level) = %s; want %s", b, want)
+	}
+}
+
+func TestOpenAPIMapProperty(t *testing.T) {
+	byName := &APISchemaProperty{Type: "object", AdditionalProperties: &APISchemaProperty{Ref: "Item"}}
+	attrs := &APISchemaProperty{Type: "object", AdditionalProperties: &APISchemaProperty{Type: "any"}}
+	verifyPairs(t,
+		openAPIProperty(byName), &OpenAPISchema{Type: "object",
+			AdditionalProperties: &OpenAPISchema{Ref: "#/components/schemas/Item"}},
+		openAPIProperty(attrs), &OpenAPISchema{Type: "object", AdditionalProperties: &OpenAPISchema{}},
+		openAPIProperty(&APISchemaProperty{Type: "any", Desc: "Any value"}), &OpenAPISchema{Desc: "Any value"},
+	)
+}
+
+// RESTTestServiceV2 is another version of RESTTestService.
+type RESTTestServiceV2 struct {
+	RESTTestService
+}
+
+func TestServerOpenAPI(t *testing.T) {
+	server := createDummyServer(t)
+	if _, err := server.RegisterService(&RESTTestService{}, "rest", "v1", "REST API", true); err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	if _, err := server.RegisterService(&RESTTestServiceV2{}, "rest", "v2", "REST API", false); err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+
+	d := &OpenAPIDoc{}
+	if err := server.OpenAPI(d, "localhost:8080"); err != nil {
+		t.Fatalf("server.OpenAPI: %v", err)
+	}
+	verifyPairs(t,
+		d.Info, OpenAPIInfo{Title: "localhost:8080", Version: "dummy:v1, rest:v1, rest:v2"},
+		d.Servers[0].URL, "http://localhost:8080/_ah/api",
+		d.Paths["/dummy/v1/auth"]["put"].OperationID, "dummy.auth",
+		d.Paths["/rest/v1/get"]["post"].OperationID, "rest.v1.get",
+		d.Paths["/rest/v2/get"]["post"].OperationID, "rest.v2.get",
+	)
+
+	if err := NewServer("").OpenAPI(d, "localhost:8080"); err == nil {
+		t.Error("want error for a server without services")
+	}
+}
+
+func TestJSONToYAML(t *testing.T) {
+	in := `{"openapi":"3.0.3","info":{"title":"a: b","version":"1"},` +
+		`"paths":{"/x/{id}":{"get":{"tags":["x"],"parameters":[{"name":"id","required":true},{"name":"n","default":1.5}],` +
+		`"security":[{"a":[]}],"responses":{}}}},"list":[["a","b"],[]],"nothing":null,"yes":"no"}`
+	want := `openapi: "3.0.3"
+info:
+  title: "a: b"
+  version: "1"
+paths:
+  "/x/{id}":
+    get:
+      tags:
+        - x
+      parameters:
+        - name: id
+          required: true
+        - name: "n"
+          default: 1.5
+      security:
+        - a: []
+      responses: {}
+list:
+  - - a
+    - b
+  - []
+nothing: null
+"yes": "no"
+`
+	out, err := jsonToYAML([]byte(in))
+	if err != nil {
+		t.Fatalf("jsonToYAML: %v", err)
+	}
+	if string(out) != want {
+		t.Errorf("jsonToYAML(%s) =\n%s\nwant\n%s", in, out, want)
+	}
+}
+
+func TestOpenAPIDocYAML(t *testing.T) {
+	d := createOpenAPIDoc(t)
+	b, err := d.YAML()
+	if err != nil {
+		t.Fatalf("d.YAML(): %v", err)
+	}
+	out := string(b)
+	for _, want := range []string{
+		"openapi: \"3.0.3\"\n",
+		"\n  \"/dummy/v1/post/{i}/{bool_field}/{Float64}\":\n    post:\n      operationId: dummy.post\n",
+		"\n            $ref: \"#/components/schemas/DummyMsg\"\n",
+		"\n        - google_id_token: []\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Logger writes log messages of the package and of BackendService.LogMessages.
+type Logger interface {
+	Debugf(c context.Context, format string, args ...interface{})
+	Infof(c context.Context, format string, args ...interface{})
+	Warningf(c context.Context, format string, args ...interface{})
+	Errorf(c context.Context, format string, args ...interface{})
+	Criticalf(c context.Context, format string, args ...interface{})
+}
+
+// Cache stores small values for a limited time, e.g. public certs used to
+// verify ID tokens.
+type Cache interface {
+	// Get returns the value stored under key, or ErrCacheMiss.
+	Get(c context.Context, key string) ([]byte, error)
+	// Set stores value under key. A zero expiration means no expiration.
+	Set(c context.Context, key string, value []byte, expiration time.Duration) error
+}
+
+// ErrCacheMiss is returned by Cache.Get when there is no value for a key.
+var ErrCacheMiss = errors.New("endpoints: cache miss")
+
+// Platform provides the services of the environment a server runs in.
+//
+// AppEnginePlatform is used on App Engine standard, NewStandardPlatform
+// creates a platform based on the standard library only, suitable for any
+// Go binary, e.g. on Cloud Run or Kubernetes.
+type Platform struct {
+	// BaseContext returns the context a new request context is derived from.
+	BaseContext func(r *http.Request) context.Context
+	// Logger writes log messages.
+	Logger Logger
+	// Cache caches certs used to verify ID tokens.
+	Cache Cache
+	// Transport returns the transport of outgoing HTTP requests made
+	// on behalf of c, e.g. fetching certs or token info.
+	Transport func(c context.Context) http.RoundTripper
+	// AuthenticatorFactory creates the Authenticator of every new context.
+	// If nil, the package's AuthenticatorFactory is used.
+	AuthenticatorFactory func() Authenticator
+	// VersionID returns the version of the running app in "major.minor"
+	// format. BackendService.GetApiConfigs compares the minor part with
+	// the requested app revision. If nil, the revision is not checked.
+	VersionID func(c context.Context) string
+}
+
+// DefaultPlatform is used by NewContext and by servers with a nil Platform.
+// It is AppEnginePlatform on App Engine, including the development server,
+// and a standard platform logging to stderr anywhere else.
+var DefaultPlatform = NewStandardPlatform(nil)
+
+// newHTTPClient returns a new HTTP client using the transport of
+// the context's platform.
+func newHTTPClient(c context.Context) *http.Client {
+	return &http.Client{Transport: platform(c).Transport(c)}
+}
+
+// NewContext returns a new context for an in-flight API (HTTP) request.
+func (p *Platform) NewContext(r *http.Request) context.Context {
+	factory := p.AuthenticatorFactory
+	if factory == nil {
+		factory = AuthenticatorFactory
+	}
+	c := p.BaseContext(r)
+	c = context.WithValue(c, platformKey, p)
+	c = context.WithValue(c, requestKey, r)
+	c = context.WithValue(c, authenticatorKey, factory())
+	return c
+}
+
+// platform returns the Platform of a context created with
+// Platform.NewContext, or DefaultPlatform.
+func platform(c context.Context) *Platform {
+	if p, ok := c.Value(platformKey).(*Platform); ok {
+		return p
+	}
+	return DefaultPlatform
+}
+
+// logger returns the Logger of a context's platform.
+func logger(c context.Context) Logger {
+	return platform(c).Logger
+}
+
+// NewStandardPlatform returns a Platform which uses the standard library
+// only: request contexts, an in-memory cache, http.DefaultTransport and
+// the tokeninfo API to validate bearer tokens. Messages of level LogInfo
+// and above are logged to l, or to stderr if l is nil, see NewStdLogger.
+func NewStandardPlatform(l *log.Logger) *Platform {
+	return &Platform{
+		BaseContext: func(r *http.Request) context.Context {
+			return r.Context()
+		},
+		Logger: NewStdLogger(l),
+		Cache:  NewMemoryCache(),
+		Transport: func(context.Context) http.RoundTripper {
+			return http.DefaultTransport
+		},
+		AuthenticatorFactory: tokeninfoAuthenticatorFactory,
+	}
+}
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+// Log levels, from the least to the most severe.
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarning
+	LogError
+	LogCritical
+)
+
+var logLevelNames = [...]string{"DEBUG", "INFO", "WARNING", "ERROR", "CRITICAL"}
+
+// stdLogger is a Logger writing to a standard library logger, prefixing
+// messages with their level.
+type stdLogger struct {
+	l   *log.Logger
+	min LogLevel
+}
+
+// NewStdLogger returns a Logger writing to l, or to stderr if l is nil.
+// Debug messages, which include request bodies, are left out, see
+// NewStdLoggerLevel.
+func NewStdLogger(l *log.Logger) Logger {
+	return NewStdLoggerLevel(l, LogInfo)
+}
+
+// NewStdLoggerLevel returns a Logger writing messages of level min and
+// above to l, or to stderr if l is nil.
+func NewStdLoggerLevel(l *log.Logger, min LogLevel) Logger {
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &stdLogger{l, min}
+}
+
+func (s *stdLogger) logf(level LogLevel, format string, args ...interface{}) {
+	if level < s.min {
+		return
+	}
+	s.l.Output(3, logLevelNames[level]+": "+fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) Debugf(_ context.Context, format string, args ...interface{}) {
+	s.logf(LogDebug, format, args...)
+}
+
+func (s *stdLogger) Infof(_ context.Context, format string, args ...interface{}) {
+	s.logf(LogInfo, format, args...)
+}
+
+func (s *stdLogger) Warningf(_ context.Context, format string, args ...interface{}) {
+	s.logf(LogWarning, format, args...)
+}
+
+func (s *stdLogger) Errorf(_ context.Context, format string, args ...interface{}) {
+	s.logf(LogError, format, args...)
+}
+
+func (s *stdLogger) Criticalf(_ context.Context, format string, args ...interface{}) {
+	s.logf(LogCritical, format, args...)
+}
+
+// memoryCache is a Cache keeping values in memory of the process.
+type memoryCache struct {
+	items map[string]*memoryCacheItem
+	sync.Mutex
+}
+
+type memoryCacheItem struct {
+	value   []byte
+	expires time.Time // zero if the item never expires
+}
+
+// NewMemoryCache returns a Cache keeping values in memory. It is safe for
+// concurrent use. Expired values are dropped when they are looked up.
+func NewMemoryCache() Cache {
+	return &memoryCache{items: make(map[string]*memoryCacheItem)}
+}
+
+func (mc *memoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	mc.Lock()
+	defer mc.Unlock()
+	item, ok := mc.items[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	if !item.expires.IsZero() && !currentUTC().Before(item.expires) {
+		delete(mc.items, key)
+		return nil, ErrCacheMiss
+	}
+	return item.value, nil
+}
+
+func (mc *memoryCache) Set(_ context.Context, key string, value []byte, expiration time.Duration) error {
+	item := &memoryCacheItem{value: value}
+	if expiration > 0 {
+		item.expires = currentUTC().Add(expiration)
+	}
+	mc.Lock()
+	mc.items[key] = item
+	mc.Unlock()
+	return nil
+}
@@ -0,0 +1,84 @@
+//go:build !noappengine
+// +build !noappengine
+
+package endpoints
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+)
+
+// AppEnginePlatform is the Platform of App Engine standard environment.
+// It logs with appengine/log, caches in memcache and makes outgoing
+// requests with urlfetch.
+var AppEnginePlatform = &Platform{
+	BaseContext: appengine.NewContext,
+	Logger:      appengineLogger{},
+	Cache:       memcacheCache{namespace: certNamespace},
+	Transport: func(c context.Context) http.RoundTripper {
+		return httpTransportFactory(c)
+	},
+	VersionID: appengine.VersionID,
+}
+
+func init() {
+	if appengine.IsAppEngine() || appengine.IsDevAppServer() {
+		DefaultPlatform = AppEnginePlatform
+	}
+}
+
+// appengineLogger is a Logger using appengine/log.
+type appengineLogger struct{}
+
+func (appengineLogger) Debugf(c context.Context, format string, args ...interface{}) {
+	log.Debugf(c, format, args...)
+}
+
+func (appengineLogger) Infof(c context.Context, format string, args ...interface{}) {
+	log.Infof(c, format, args...)
+}
+
+func (appengineLogger) Warningf(c context.Context, format string, args ...interface{}) {
+	log.Warningf(c, format, args...)
+}
+
+func (appengineLogger) Errorf(c context.Context, format string, args ...interface{}) {
+	log.Errorf(c, format, args...)
+}
+
+func (appengineLogger) Criticalf(c context.Context, format string, args ...interface{}) {
+	log.Criticalf(c, format, args...)
+}
+
+// memcacheCache is a Cache storing values in memcache under namespace.
+type memcacheCache struct {
+	namespace string
+}
+
+func (mc memcacheCache) Get(c context.Context, key string) ([]byte, error) {
+	nc, err := appengine.Namespace(c, mc.namespace)
+	if err != nil {
+		return nil, err
+	}
+	item, err := memcache.Get(nc, key)
+	if err == memcache.ErrCacheMiss {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (mc memcacheCache) Set(c context.Context, key string, value []byte, expiration time.Duration) error {
+	nc, err := appengine.Namespace(c, mc.namespace)
+	if err != nil {
+		return err
+	}
+	return memcache.Set(nc, &memcache.Item{Key: key, Value: value, Expiration: expiration})
+}
@@ -0,0 +1,27 @@
+//go:build noappengine
+// +build noappengine
+
+package endpoints
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// AppEnginePlatform is a standard platform in builds with the noappengine
+// tag, which leave out App Engine's logging, memcache and urlfetch, so that
+// code referring to it still builds.
+var AppEnginePlatform = func() *Platform {
+	p := NewStandardPlatform(nil)
+	p.Transport = func(c context.Context) http.RoundTripper {
+		return httpTransportFactory(c)
+	}
+	return p
+}()
+
+// httpTransportFactory creates a new HTTP transport for outgoing requests.
+// This is made a variable on purpose, to be stubbed during testing.
+var httpTransportFactory = func(c context.Context) http.RoundTripper {
+	return http.DefaultTransport
+}
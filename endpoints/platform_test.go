@@ -0,0 +1,185 @@
+package endpoints
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestMemoryCache(t *testing.T) {
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2015, 1, 1, 12, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	c := context.Background()
+	cache := NewMemoryCache()
+	if _, err := cache.Get(c, "key"); err != ErrCacheMiss {
+		t.Errorf("Get(key) err = %v; want ErrCacheMiss", err)
+	}
+	cache.Set(c, "key", []byte("value"), time.Minute)
+	cache.Set(c, "forever", []byte("always"), 0)
+
+	tts := []struct {
+		after time.Duration
+		key   string
+		want  string
+	}{
+		{0, "key", "value"},
+		{59 * time.Second, "key", "value"},
+		{time.Minute, "key", ""},
+		{time.Hour, "forever", "always"},
+	}
+	start := now
+	for i, tt := range tts {
+		now = start.Add(tt.after)
+		v, err := cache.Get(c, tt.key)
+		switch {
+		case tt.want == "" && err != ErrCacheMiss:
+			t.Errorf("%d: Get(%q) = %q, %v; want ErrCacheMiss", i, tt.key, v, err)
+		case tt.want != "" && (err != nil || string(v) != tt.want):
+			t.Errorf("%d: Get(%q) = %q, %v; want %q", i, tt.key, v, err, tt.want)
+		}
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	tts := []struct {
+		min  LogLevel
+		want string
+	}{
+		{LogDebug, "DEBUG: debug 1\nINFO: info\nWARNING: warning\nERROR: error x\nCRITICAL: critical\n"},
+		{LogInfo, "INFO: info\nWARNING: warning\nERROR: error x\nCRITICAL: critical\n"},
+		{LogError, "ERROR: error x\nCRITICAL: critical\n"},
+	}
+	for _, tt := range tts {
+		var buf bytes.Buffer
+		l := NewStdLoggerLevel(log.New(&buf, "", 0), tt.min)
+		c := context.Background()
+		l.Debugf(c, "debug %d", 1)
+		l.Infof(c, "info")
+		l.Warningf(c, "warning")
+		l.Errorf(c, "error %s", "x")
+		l.Criticalf(c, "critical")
+
+		if buf.String() != tt.want {
+			t.Errorf("log of level %d = %q; want %q", tt.min, buf.String(), tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+	l.Debugf(context.Background(), "request body")
+	l.Infof(context.Background(), "info")
+	if want := "INFO: info\n"; buf.String() != want {
+		t.Errorf("log = %q; want %q", buf.String(), want)
+	}
+}
+
+func TestStandardPlatformServeHTTP(t *testing.T) {
+	var buf bytes.Buffer
+	server := createRESTServer(t)
+	server.Platform = NewStandardPlatform(nil)
+	server.Platform.Logger = NewStdLoggerLevel(log.New(&buf, "", 0), LogDebug)
+
+	var got *Platform
+	server.Use(func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+		got = platform(c)
+		if HTTPRequest(c) != call.HTTPRequest {
+			t.Errorf("HTTPRequest(c) = %v; want %v", HTTPRequest(c), call.HTTPRequest)
+		}
+		if _, ok := authenticator(c).(tokeninfoAuthenticator); !ok {
+			t.Errorf("authenticator(c) = %T; want tokeninfoAuthenticator", authenticator(c))
+		}
+		return next(c, call)
+	})
+
+	r := httptest.NewRequest("GET", "/_ah/api/rest/v1/items/count", strings.NewReader(""))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if res := strings.TrimSpace(w.Body.String()); res != `{"name":"count"}` {
+		t.Errorf("res = %q; want %q", res, `{"name":"count"}`)
+	}
+	if got != server.Platform {
+		t.Errorf("platform(c) = %p; want %p", got, server.Platform)
+	}
+	if !strings.Contains(buf.String(), "DEBUG: REST request GET") {
+		t.Errorf("log = %q; want REST request debug message", buf.String())
+	}
+}
+
+func TestStandardPlatformBackend(t *testing.T) {
+	var buf bytes.Buffer
+	server := createDummyServer(t)
+	server.Platform = NewStandardPlatform(log.New(&buf, "", 0))
+	backend := newBackendService(server)
+
+	r := httptest.NewRequest("POST", "/_ah/spi/BackendService.GetApiConfigs", strings.NewReader(""))
+	resp := &APIConfigsList{}
+	if err := backend.GetApiConfigs(r, &GetAPIConfigsRequest{AppRevision: "123"}, resp); err != nil {
+		t.Fatalf("GetApiConfigs() = %v", err)
+	}
+	if len(resp.Items) != 1 {
+		t.Errorf("len(resp.Items) = %d; want 1", len(resp.Items))
+	}
+
+	server.Platform.VersionID = func(context.Context) string { return "v1.456" }
+	if err := backend.GetApiConfigs(r, &GetAPIConfigsRequest{AppRevision: "123"}, resp); err == nil {
+		t.Errorf("GetApiConfigs(AppRevision: 123) = nil; want error")
+	}
+	if !strings.Contains(buf.String(), "ERROR: API backend app revision 456") {
+		t.Errorf("log = %q; want app revision error", buf.String())
+	}
+
+	buf.Reset()
+	req := &LogMessagesRequest{Messages: []*LogMessage{
+		{Level: levelWarning, Message: "careful"},
+		{Message: "hello"},
+	}}
+	if err := backend.LogMessages(r, req, nil); err != nil {
+		t.Fatalf("LogMessages() = %v", err)
+	}
+	if buf.String() != "WARNING: careful\nINFO: hello\n" {
+		t.Errorf("log = %q; want %q", buf.String(), "WARNING: careful\nINFO: hello\n")
+	}
+}
+
+func TestStandardPlatformCachedCerts(t *testing.T) {
+	rt := newTestRoundTripper(&http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Cache-Control": {"max-age=3600"},
+			"Age":           {"0"},
+		},
+		Body: ioutil.NopCloser(strings.NewReader(`{"keyvalues": [{"keyid": "some-id"}]}`)),
+	})
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+
+	c := p.NewContext(httptest.NewRequest("GET", "/", nil))
+	want := &certsList{KeyValues: []*certInfo{{KeyID: "some-id"}}}
+	for i := 0; i < 2; i++ {
+		certs, err := cachedCerts(c, DefaultCertURI)
+		if err != nil {
+			t.Fatalf("%d: cachedCerts() = %v", i, err)
+		}
+		if !reflect.DeepEqual(certs, want) {
+			t.Errorf("%d: cachedCerts() = %#v; want %#v", i, certs, want)
+		}
+	}
+	if rt.Count() != 1 {
+		t.Errorf("rt.Count() = %d; want 1", rt.Count())
+	}
+	if _, err := p.Cache.Get(c, DefaultCertURI); err != nil {
+		t.Errorf("Cache.Get(%q) = %v", DefaultCertURI, err)
+	}
+}
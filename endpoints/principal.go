@@ -0,0 +1,130 @@
+package endpoints
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/user"
+)
+
+// AuthMethod tells how the principal of a request was authenticated.
+type AuthMethod int
+
+const (
+	// AuthIDToken is a signed ID token (JWT) of Google or of an issuer
+	// of the API.
+	AuthIDToken AuthMethod = iota + 1
+	// AuthBearerToken is an OAuth 2.0 access token.
+	AuthBearerToken
+)
+
+// String returns a readable name of m.
+func (m AuthMethod) String() string {
+	switch m {
+	case AuthIDToken:
+		return "id_token"
+	case AuthBearerToken:
+		return "bearer_token"
+	}
+	return "unknown"
+}
+
+// Principal is the authenticated caller of an API method, as returned by
+// CurrentPrincipal.
+type Principal struct {
+	// ID identifies the principal for its issuer, e.g. a Google Account ID.
+	// It is the "sub" claim of an ID token.
+	ID string
+	// Email is the principal's email address, if known.
+	Email string
+	// ClientID is the OAuth 2.0 client the token was issued to.
+	ClientID string
+	// Issuer and Audience are the "iss" and "aud" claims of the token.
+	Issuer   string
+	Audience string
+	// Expires is the expiration time of the token, or zero if unknown, e.g.
+	// for bearer tokens checked by the OAuth API of App Engine.
+	Expires time.Time
+	// Method tells which kind of token authenticated the principal.
+	Method AuthMethod
+	// Claims are the verified claims of an ID token, including custom ones.
+	// What Authenticators implementing PrincipalAuthenticator know of
+	// bearer tokens is turned into the same claims, e.g. "sub" and "scope".
+	// Claims are nil for bearer tokens of other Authenticators.
+	Claims map[string]interface{}
+
+	// user is the user reported by an Authenticator, if any.
+	user *user.User
+}
+
+// User returns p as an App Engine user, for code written against
+// CurrentUser. Unless an Authenticator reported the user, only ID, Email
+// and ClientID fields are set.
+func (p *Principal) User() *user.User {
+	if p.user != nil {
+		return p.user
+	}
+	return &user.User{ID: p.ID, Email: p.Email, ClientID: p.ClientID}
+}
+
+// EmailVerified returns true if the issuer verified that Email belongs to
+// the principal, as told by the "email_verified" claim.
+func (p *Principal) EmailVerified() bool {
+	switch v := p.Claims["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// WithPrincipal returns a copy of c which carries p, see
+// PrincipalFromContext.
+func WithPrincipal(c context.Context, p *Principal) context.Context {
+	return context.WithValue(c, principalKey, p)
+}
+
+// PrincipalFromContext returns the principal carried by c, or nil.
+func PrincipalFromContext(c context.Context) *Principal {
+	p, _ := c.Value(principalKey).(*Principal)
+	return p
+}
+
+// newIDTokenPrincipal creates a principal from a token parsed from jwt
+// by jwtParser. Claims are decoded from the already verified jwt.
+func newIDTokenPrincipal(jwt string, token *signedJWT) *Principal {
+	p := &Principal{
+		ID:       token.Subject,
+		Email:    token.Email,
+		ClientID: token.ClientID,
+		Issuer:   token.Issuer,
+		Audience: token.Audience,
+		Method:   AuthIDToken,
+	}
+	if token.Expires != 0 {
+		p.Expires = time.Unix(token.Expires, 0).UTC()
+	}
+	if segments := strings.Split(jwt, "."); len(segments) == 3 {
+		if b, err := base64.URLEncoding.DecodeString(addBase64Pad(segments[1])); err == nil {
+			json.Unmarshal(b, &p.Claims)
+		}
+	}
+	return p
+}
+
+// newBearerTokenPrincipal creates a principal from a user reported by
+// an Authenticator for an OAuth 2.0 access token.
+func newBearerTokenPrincipal(u *user.User) *Principal {
+	return &Principal{
+		ID:       u.ID,
+		Email:    u.Email,
+		ClientID: u.ClientID,
+		Issuer:   googleIssuer,
+		Method:   AuthBearerToken,
+		user:     u,
+	}
+}
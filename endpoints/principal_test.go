@@ -0,0 +1,118 @@
+package endpoints
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/user"
+)
+
+func TestPrincipalUser(t *testing.T) {
+	p := &Principal{ID: "123", Email: "dude@gmail.com", ClientID: "my-client-id", Issuer: googleIssuer}
+	verifyPairs(t, p.User(), &user.User{ID: "123", Email: "dude@gmail.com", ClientID: "my-client-id"})
+
+	u := &user.User{ID: "456", Email: "admin@example.com", AuthDomain: "example.com", Admin: true}
+	p = newBearerTokenPrincipal(u)
+	verifyPairs(t,
+		p.User(), u,
+		p.ID, "456",
+		p.Email, "admin@example.com",
+		p.Method, AuthBearerToken,
+		p.Expires.IsZero(), true,
+		p.Claims == nil, true,
+	)
+}
+
+func TestPrincipalEmailVerified(t *testing.T) {
+	tts := []struct {
+		claims map[string]interface{}
+		want   bool
+	}{
+		{nil, false},
+		{map[string]interface{}{"email_verified": true}, true},
+		{map[string]interface{}{"email_verified": false}, false},
+		{map[string]interface{}{"email_verified": "true"}, true},
+		{map[string]interface{}{"email_verified": "false"}, false},
+		{map[string]interface{}{"email_verified": 1.0}, false},
+	}
+	for i, tt := range tts {
+		p := &Principal{Claims: tt.claims}
+		if out := p.EmailVerified(); out != tt.want {
+			t.Errorf("%d: EmailVerified() with claims %v = %v; want %v", i, tt.claims, out, tt.want)
+		}
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	c := context.Background()
+	if p := PrincipalFromContext(c); p != nil {
+		t.Errorf("PrincipalFromContext(empty) = %#v; want nil", p)
+	}
+	p := &Principal{ID: "123", Method: AuthIDToken}
+	if out := PrincipalFromContext(WithPrincipal(c, p)); out != p {
+		t.Errorf("PrincipalFromContext(WithPrincipal(p)) = %#v; want %#v", out, p)
+	}
+}
+
+func TestNewIDTokenPrincipal(t *testing.T) {
+	p := newIDTokenPrincipal(jwtValidTokenString, &jwtValidTokenObject)
+	verifyPairs(t,
+		p.ID, "",
+		p.Email, "dude@gmail.com",
+		p.ClientID, "hello-android",
+		p.Issuer, "accounts.google.com",
+		p.Audience, "my-client-id",
+		p.Expires, time.Date(2013, 6, 4, 13, 24, 12, 0, time.UTC),
+		p.Method, AuthIDToken,
+		p.Claims, map[string]interface{}{
+			"aud":   "my-client-id",
+			"azp":   "hello-android",
+			"email": "dude@gmail.com",
+			"exp":   1370352252.0,
+			"iat":   1370348652.0,
+			"iss":   "accounts.google.com",
+		},
+		p.Method.String(), "id_token",
+	)
+}
+
+func TestCurrentPrincipalBearerToken(t *testing.T) {
+	resp := func() *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+		}
+	}
+	rt := newTestRoundTripper(resp(), resp())
+	p := NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	p.Transport = func(context.Context) http.RoundTripper { return rt }
+
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer ya29.token")
+	principal, err := CurrentPrincipal(p.NewContext(r), []string{"scope.two"}, nil, []string{"my-client-id"})
+	if err != nil {
+		t.Fatalf("CurrentPrincipal() = %v", err)
+	}
+	verifyPairs(t,
+		principal.ID, tokeinfoUserID,
+		principal.Email, tokeninfoEmail,
+		principal.ClientID, "my-client-id",
+		principal.Audience, "my-client-id",
+		principal.Expires, now.Add(time.Hour),
+		principal.Method, AuthBearerToken,
+		principal.EmailVerified(), true,
+		principal.Claims["scope"], "scope.one scope.two",
+		principal.User(), &user.User{ID: tokeinfoUserID, Email: tokeninfoEmail, ClientID: "my-client-id"},
+	)
+}
@@ -0,0 +1,374 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// defaultAPIRoot is the URL path prefix of the REST surface of all
+// registered APIs, i.e. /_ah/api/{name}/{version}/{path}.
+const defaultAPIRoot = "/_ah/api/"
+
+// discoveryRoot is the path of Discovery service, relative to the API root.
+const discoveryRoot = "discovery/v1/"
+
+// serveREST serves a REST request addressed to one of the registered APIs.
+//
+// The request is matched against HTTPMethod and Path of every method of the
+// API, path placeholders, query parameters and JSON body are bound to a new
+// ReqType value, and the result is dispatched the same way SPI calls are.
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	c, err := s.newContext(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.EscapedPath(), s.apiRoot)
+	if strings.HasPrefix(path, discoveryRoot) {
+		s.serveDiscovery(w, r, path[len(discoveryRoot):])
+		return
+	}
+	if strings.Trim(path, "/") == rpcPath {
+		s.serveJSONRPC(c, w, r)
+		return
+	}
+	serviceSpec, methodSpec, pathParams, err := s.services.route(r.Method, path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger(c).Debugf(c, "REST request %s %s body: %s", r.Method, r.URL, body)
+
+	// Restore the body in the original request.
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	resp, err := s.callREST(c, r, serviceSpec, methodSpec, pathParams, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if resp == nil || isEmptyStruct(methodSpec.RespType) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := encodeJSON(w, resp); err != nil {
+		writeError(w, err)
+	}
+}
+
+// callREST binds the JSON body, path and query parameters of a REST request
+// to a new request value, validates it and invokes the service method with
+// it. A panic is reported as InternalServerError.
+func (s *Server) callREST(c context.Context, r *http.Request,
+	serviceSpec *RPCService, methodSpec *ServiceMethod, pathParams map[string]string, body []byte) (
+	resp interface{}, err error) {
+
+	defer s.recoverPanic(c, r, serviceSpec, methodSpec, &err)
+
+	reqValue := reflect.New(methodSpec.ReqType)
+	if len(bytes.TrimSpace(body)) > 0 && !methodSpec.info.isBodiless() {
+		if err := decodeJSON(body, reqValue.Interface()); err != nil {
+			return nil, NewBadRequestError("%v", err)
+		}
+	}
+	if err := bindParams(reqValue.Elem(), pathParams, r.URL.Query()); err != nil {
+		return nil, err
+	}
+	if err := validateRequest(c, reqValue.Interface()); err != nil {
+		return nil, err
+	}
+	return s.invoke(c, r, serviceSpec, methodSpec, reqValue)
+}
+
+// route finds a method of a registered API given an HTTP method and
+// an escaped path in "{name}/{version}/{path}" format, relative to the API
+// root.
+//
+// It returns values of path template placeholders keyed by their names.
+// When more than one template matches the path, the one with most literal
+// segments wins, e.g. "greetings/count" over "greetings/{id}". Ties are
+// broken by preferRoute, so that a path is always served by the same method.
+func (m *serviceMap) route(httpMethod, path string) (
+	*RPCService, *ServiceMethod, map[string]string, error) {
+
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 3)
+	if len(parts) < 3 {
+		return nil, nil, nil, NewNotFoundError("no API method at %q", path)
+	}
+	name, version, rest := parts[0], parts[1], parts[2]
+
+	services := m.servicesByAPI(name, version)
+	var (
+		service    *RPCService
+		method     *ServiceMethod
+		params     map[string]string
+		best       = -1
+		pathExists bool
+	)
+	for _, s := range services {
+		for _, sm := range s.methods {
+			p, literals, ok := matchPath(sm.info.Path, rest)
+			if !ok {
+				continue
+			}
+			pathExists = true
+			if !strings.EqualFold(sm.info.HTTPMethod, httpMethod) || literals < best {
+				continue
+			}
+			if literals == best && !preferRoute(s, sm, service, method) {
+				continue
+			}
+			service, method, params, best = s, sm, p, literals
+		}
+	}
+
+	switch {
+	case method != nil:
+		return service, method, params, nil
+	case pathExists:
+		return nil, nil, nil, NewAPIError(
+			http.StatusText(http.StatusMethodNotAllowed),
+			fmt.Sprintf("method %s is not allowed on %q", httpMethod, rest),
+			http.StatusMethodNotAllowed)
+	case len(services) > 0:
+		return nil, nil, nil, NewNotFoundError("no method of %s %s at %q", name, version, rest)
+	}
+	return nil, nil, nil, NewNotFoundError("API %s %s not found", name, version)
+}
+
+// preferRoute reports whether method sm of s wins over method bm of bs when
+// their templates match a path with the same number of literal segments.
+//
+// The template with the first literal segment wins, e.g. "items/{id}" over
+// "{kind}/list", then the lexically smaller template, service name and
+// method name.
+func preferRoute(s *RPCService, sm *ServiceMethod, bs *RPCService, bm *ServiceMethod) bool {
+	a := strings.Split(strings.Trim(sm.info.Path, "/"), "/")
+	b := strings.Split(strings.Trim(bm.info.Path, "/"), "/")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if al, bl := !isPathParam(a[i]), !isPathParam(b[i]); al != bl {
+			return al
+		}
+	}
+	switch {
+	case sm.info.Path != bm.info.Path:
+		return sm.info.Path < bm.info.Path
+	case s.name != bs.name:
+		return s.name < bs.name
+	}
+	return sm.method.Name < bm.method.Name
+}
+
+// isPathParam reports whether a segment of a path template is
+// a placeholder, e.g. "{id}".
+func isPathParam(segment string) bool {
+	return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}'
+}
+
+// matchPath matches an escaped path against a path template such as
+// "greetings/{id}". Placeholders must span a whole path segment.
+//
+// It returns unescaped values of the placeholders and the number of literal
+// segments of the template.
+func matchPath(template, path string) (map[string]string, int, bool) {
+	tparts := strings.Split(strings.Trim(template, "/"), "/")
+	pparts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(tparts) != len(pparts) {
+		return nil, 0, false
+	}
+
+	params := make(map[string]string)
+	literals := 0
+	for i, t := range tparts {
+		p, err := url.PathUnescape(pparts[i])
+		if err != nil {
+			return nil, 0, false
+		}
+		if isPathParam(t) {
+			if p == "" {
+				return nil, 0, false
+			}
+			params[t[1:len(t)-1]] = p
+			continue
+		}
+		if t != p {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return params, literals, true
+}
+
+// bindParams sets fields of the struct v from path template values and
+// query parameters. Path values take precedence over query parameters with
+// the same name.
+//
+// Parameter names are JSON field names; nested fields are referenced with
+// dotted names, e.g. "msg.i". Unknown query parameters are ignored.
+func bindParams(v reflect.Value, pathParams map[string]string, query url.Values) error {
+	for name, vals := range query {
+		if _, ok := pathParams[name]; ok {
+			continue
+		}
+		if _, err := setParam(v, name, vals); err != nil {
+			return NewBadRequestError("invalid value of %q parameter: %v", name, err)
+		}
+	}
+	for name, val := range pathParams {
+		found, err := setParam(v, name, []string{val})
+		if err != nil {
+			return NewBadRequestError("invalid value of %q parameter: %v", name, err)
+		}
+		if !found {
+			return NewInternalServerError("path parameter %q not found in %v", name, v.Type())
+		}
+	}
+	return nil
+}
+
+// setParam sets a (possibly nested) field of struct v, referenced by its
+// dotted JSON name, to vals. It returns false if no such field exists.
+func setParam(v reflect.Value, name string, vals []string) (bool, error) {
+	if v.Kind() != reflect.Struct || len(vals) == 0 {
+		return false, nil
+	}
+	head, rest := name, ""
+	if i := strings.IndexRune(name, '.'); i >= 0 {
+		head, rest = name[:i], name[i+1:]
+	}
+
+	f, ok := fieldByJSONName(v, head)
+	if !ok {
+		return false, nil
+	}
+	if rest == "" {
+		return true, setValue(f, vals)
+	}
+	if f.Kind() == reflect.Ptr && indirectKind(f.Type()) == reflect.Struct {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		f = f.Elem()
+	}
+	return setParam(f, rest, vals)
+}
+
+// fieldByJSONName returns a field of struct v named name as per
+// encoding/json rules. Embedded structs are searched too.
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fname := strings.Split(f.Tag.Get("json"), ",")[0]
+		if fname == "-" {
+			continue
+		}
+		if fname == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if fv, ok := fieldByJSONName(v.Field(i), name); ok {
+				return fv, true
+			}
+			continue
+		}
+		if fname == "" {
+			fname = f.Name
+		}
+		if fname == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setValue parses string representation of a parameter and stores it in v.
+// Slices other than []byte are treated as repeated parameters.
+func setValue(v reflect.Value, vals []string) error {
+	last := vals[len(vals)-1]
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), vals)
+	}
+	if u, ok := v.Addr().Interface().(json.Unmarshaler); ok {
+		// Values of types with a number or boolean schema are JSON literals.
+		if schema, ok := customSchema(v.Type()); ok && schema.Type != "string" {
+			return u.UnmarshalJSON([]byte(last))
+		}
+		b, err := json.Marshal(last)
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalJSON(b)
+	}
+
+	switch {
+	case v.Type() == typeOfBytes:
+		b, err := base64.URLEncoding.DecodeString(addBase64Pad(last))
+		if err != nil {
+			b, err = base64.StdEncoding.DecodeString(addBase64Pad(last))
+		}
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+		return nil
+
+	case v.Kind() == reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(s.Index(i), []string{val}); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+
+	case v.Kind() == reflect.String:
+		v.SetString(last)
+		return nil
+	}
+
+	x, err := parseValue(last, v.Kind())
+	if err != nil {
+		return err
+	}
+	if x == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	xv := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(xv.Int()) {
+			return fmt.Errorf("%s overflows %v", last, v.Type())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.OverflowUint(xv.Uint()) {
+			return fmt.Errorf("%s overflows %v", last, v.Type())
+		}
+	}
+	v.Set(xv.Convert(v.Type()))
+	return nil
+}
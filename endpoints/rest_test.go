@@ -0,0 +1,271 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"appengine/aetest"
+)
+
+type RESTTestMsg struct {
+	ID      int64      `json:"id"`
+	Name    string     `json:"name"`
+	Limit   int        `json:"limit" endpoints:"d=10,max=100"`
+	Tags    []string   `json:"tags"`
+	Flag    *bool      `json:"flag"`
+	Data    []byte     `json:"data"`
+	Date    *time.Time `json:"date"`
+	Small   int8       `json:"small"`
+	Nested  *TestMsg   `json:"nested"`
+	Skipped string     `json:"-"`
+}
+
+type RESTTestService struct{}
+
+func (s *RESTTestService) Get(c context.Context, req *RESTTestMsg) (*RESTTestMsg, error) {
+	return req, nil
+}
+
+func (s *RESTTestService) Count(c context.Context) (*TestMsg, error) {
+	return &TestMsg{Name: "count"}, nil
+}
+
+func (s *RESTTestService) Insert(c context.Context, req *RESTTestMsg) (*RESTTestMsg, error) {
+	return req, nil
+}
+
+func (s *RESTTestService) Delete(c context.Context, req *RESTTestMsg) error {
+	if req.ID == 0 {
+		return NewNotFoundError("no such item")
+	}
+	return nil
+}
+
+// createRESTServer creates a new Server with RESTTestService registered
+// as "rest" API.
+func createRESTServer(t *testing.T) *Server {
+	server := NewServer("")
+	s, err := server.RegisterService(&RESTTestService{}, "rest", "v1", "REST API", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+
+	info := s.MethodByName("Get").Info()
+	info.Name, info.HTTPMethod, info.Path = "items.get", "GET", "items/{id}"
+	info = s.MethodByName("Count").Info()
+	info.Name, info.HTTPMethod, info.Path = "items.count", "GET", "items/count"
+	info = s.MethodByName("Insert").Info()
+	info.Name, info.HTTPMethod, info.Path = "items.insert", "POST", "items/{id}"
+	info = s.MethodByName("Delete").Info()
+	info.Name, info.HTTPMethod, info.Path = "items.delete", "DELETE", "items/{id}"
+	return server
+}
+
+func TestMatchPath(t *testing.T) {
+	tts := []struct {
+		template, path string
+		params         map[string]string
+		literals       int
+		ok             bool
+	}{
+		{"items", "items", map[string]string{}, 1, true},
+		{"items/{id}", "items/123", map[string]string{"id": "123"}, 1, true},
+		{"items/{id}", "items/a%2Fb", map[string]string{"id": "a/b"}, 1, true},
+		{"/items/{id}/", "items/123", map[string]string{"id": "123"}, 1, true},
+		{"a/{x}/b/{y.z}", "a/1/b/2", map[string]string{"x": "1", "y.z": "2"}, 2, true},
+		{"items/{id}", "items", nil, 0, false},
+		{"items/{id}", "items/", nil, 0, false},
+		{"items/{id}", "things/123", nil, 0, false},
+		{"items", "items/123", nil, 0, false},
+	}
+
+	for i, tt := range tts {
+		params, literals, ok := matchPath(tt.template, tt.path)
+		if ok != tt.ok {
+			t.Errorf("%d: matchPath(%q, %q) ok = %v; want %v", i, tt.template, tt.path, ok, tt.ok)
+			continue
+		}
+		if ok && (!reflect.DeepEqual(params, tt.params) || literals != tt.literals) {
+			t.Errorf("%d: matchPath(%q, %q) = %v, %d; want %v, %d",
+				i, tt.template, tt.path, params, literals, tt.params, tt.literals)
+		}
+	}
+}
+
+func TestServiceMapRoute(t *testing.T) {
+	server := createRESTServer(t)
+
+	tts := []struct {
+		httpMethod, path, method string
+		params                   map[string]string
+		code                     int
+	}{
+		{"GET", "rest/v1/items/123", "Get", map[string]string{"id": "123"}, 0},
+		{"GET", "rest/v1/items/count", "Count", map[string]string{}, 0},
+		{"get", "rest/v1/items/count/", "Count", map[string]string{}, 0},
+		{"POST", "rest/v1/items/1", "Insert", map[string]string{"id": "1"}, 0},
+		{"DELETE", "rest/v1/items/1", "Delete", map[string]string{"id": "1"}, 0},
+		{"PUT", "rest/v1/items/1", "", nil, http.StatusMethodNotAllowed},
+		{"GET", "rest/v1/nothing", "", nil, http.StatusNotFound},
+		{"GET", "rest/v2/items/count", "", nil, http.StatusNotFound},
+		{"GET", "other/v1/items/count", "", nil, http.StatusNotFound},
+		{"GET", "rest/v1", "", nil, http.StatusNotFound},
+	}
+
+	for i, tt := range tts {
+		_, m, params, err := server.services.route(tt.httpMethod, tt.path)
+		if tt.code != 0 {
+			apiErr, ok := err.(*APIError)
+			if !ok || apiErr.Code != tt.code {
+				t.Errorf("%d: route(%q, %q) = %v; want error code %d",
+					i, tt.httpMethod, tt.path, err, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: route(%q, %q) = %v", i, tt.httpMethod, tt.path, err)
+			continue
+		}
+		if m.method.Name != tt.method || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("%d: route(%q, %q) = %s, %v; want %s, %v",
+				i, tt.httpMethod, tt.path, m.method.Name, params, tt.method, tt.params)
+		}
+	}
+}
+
+func TestServiceMapRouteTie(t *testing.T) {
+	server := createRESTServer(t)
+	s := server.ServiceByName("RESTTestService")
+	info := s.MethodByName("Count").Info()
+	info.Path = "{kind}/list"
+
+	// Both "items/{id}" and "{kind}/list" have one literal segment.
+	for i := 0; i < 20; i++ {
+		_, m, params, err := server.services.route("GET", "rest/v1/items/list")
+		if err != nil {
+			t.Fatalf("route(GET, items/list) = %v", err)
+		}
+		if m.method.Name != "Get" || !reflect.DeepEqual(params, map[string]string{"id": "list"}) {
+			t.Fatalf("%d: route(GET, items/list) = %s, %v; want Get, map[id:list]", i, m.method.Name, params)
+		}
+	}
+
+	// Identical templates are served by the lexically smaller method name.
+	info.Path = "items/{id}"
+	for i := 0; i < 20; i++ {
+		_, m, _, err := server.services.route("GET", "rest/v1/items/1")
+		if err != nil {
+			t.Fatalf("route(GET, items/1) = %v", err)
+		}
+		if m.method.Name != "Count" {
+			t.Fatalf("%d: route(GET, items/1) = %s; want Count", i, m.method.Name)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	flag := true
+	date := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	tts := []struct {
+		path  map[string]string
+		query string
+		want  *RESTTestMsg
+		fails bool
+	}{
+		{map[string]string{"id": "123"}, "name=gopher&limit=5",
+			&RESTTestMsg{ID: 123, Name: "gopher", Limit: 5}, false},
+		{map[string]string{"id": "123"}, "id=456", &RESTTestMsg{ID: 123}, false},
+		{nil, "tags=a&tags=b&flag=true", &RESTTestMsg{Tags: []string{"a", "b"}, Flag: &flag}, false},
+		{nil, "data=aGVsbG8", &RESTTestMsg{Data: []byte("hello")}, false},
+		{nil, "date=2015-06-01T12:00:00Z", &RESTTestMsg{Date: &date}, false},
+		{nil, "nested.name=inner", &RESTTestMsg{Nested: &TestMsg{Name: "inner"}}, false},
+		{nil, "unknown=1&Skipped=x&alt=json", &RESTTestMsg{}, false},
+		{nil, "limit=ten", nil, true},
+		{nil, "small=1000", nil, true},
+		{map[string]string{"unknown": "1"}, "", nil, true},
+	}
+
+	for i, tt := range tts {
+		q, _ := url.ParseQuery(tt.query)
+		v := reflect.New(reflect.TypeOf(RESTTestMsg{}))
+		err := bindParams(v.Elem(), tt.path, q)
+		switch {
+		case err != nil && !tt.fails:
+			t.Errorf("%d: bindParams(%v, %q) = %v", i, tt.path, tt.query, err)
+		case err == nil && tt.fails:
+			t.Errorf("%d: bindParams(%v, %q) = %+v; want error", i, tt.path, tt.query, v.Interface())
+		case err == nil && !reflect.DeepEqual(v.Interface(), tt.want):
+			t.Errorf("%d: bindParams(%v, %q) = %+v; want %+v", i, tt.path, tt.query, v.Interface(), tt.want)
+		}
+	}
+}
+
+func TestBindParamsCustomSchema(t *testing.T) {
+	type req struct {
+		Price *Amount    `json:"price"`
+		Name  canMarshal `json:"name"`
+	}
+	q, _ := url.ParseQuery("price=12.34&name=gopher")
+	v := reflect.New(reflect.TypeOf(req{}))
+	if err := bindParams(v.Elem(), nil, q); err != nil {
+		t.Fatalf("bindParams(%v) = %v", q, err)
+	}
+	want := &req{Price: &Amount{1234}, Name: canMarshal{`"gopher"`}}
+	if !reflect.DeepEqual(v.Interface(), want) {
+		t.Errorf("bindParams(%v) = %+v; want %+v", q, v.Interface(), want)
+	}
+}
+
+func TestServerServeREST(t *testing.T) {
+	server := createRESTServer(t)
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		httpVerb, path, in, out string
+		code                    int
+	}{
+		{"GET", "/_ah/api/rest/v1/items/123?name=gopher", ``,
+			`{"id":"123","name":"gopher","limit":10,"tags":null,"flag":null,"data":null,"date":null,"small":0,"nested":null}`,
+			http.StatusOK},
+		{"GET", "/_ah/api/rest/v1/items/count", ``, `{"name":"count"}`, http.StatusOK},
+		{"POST", "/_ah/api/rest/v1/items/7", `{"name":"body","limit":1}`,
+			`{"id":"7","name":"body","limit":1,"tags":null,"flag":null,"data":null,"date":null,"small":0,"nested":null}`,
+			http.StatusOK},
+		{"DELETE", "/_ah/api/rest/v1/items/1", ``, ``, http.StatusNoContent},
+
+		{"GET", "/_ah/api/rest/v1/items/123?limit=1000", ``, ``, http.StatusBadRequest},
+		{"GET", "/_ah/api/rest/v1/items/abc", ``, ``, http.StatusBadRequest},
+		{"POST", "/_ah/api/rest/v1/items/7", `{"name":`, ``, http.StatusBadRequest},
+		{"DELETE", "/_ah/api/rest/v1/items/0", ``, ``, http.StatusNotFound},
+		{"PUT", "/_ah/api/rest/v1/items/1", `{}`, ``, http.StatusMethodNotAllowed},
+		{"GET", "/_ah/api/rest/v1/unknown", ``, ``, http.StatusNotFound},
+	}
+
+	for i, tt := range tts {
+		r, err := inst.NewRequest(tt.httpVerb, tt.path, strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		out := strings.TrimSpace(w.Body.String())
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s w.Code = %d; want %d (%s)", i, tt.httpVerb, tt.path, w.Code, tt.code, out)
+		}
+		if tt.code < 300 && out != tt.out {
+			t.Errorf("%d: %s %s = %q; want %q", i, tt.httpVerb, tt.path, out, tt.out)
+		}
+	}
+}
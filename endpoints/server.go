@@ -7,27 +7,39 @@ package endpoints
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
+	"runtime/debug"
 	"strings"
 
 	"golang.org/x/net/context"
 	// Mainly for debug logging
 	"io/ioutil"
-
-	"google.golang.org/appengine/log"
 )
 
 // Server serves registered RPC services using registered codecs.
 type Server struct {
 	root     string
+	apiRoot  string
 	services *serviceMap
 
+	// interceptors wrap all method calls, see Use.
+	interceptors []Interceptor
+
 	// ContextDecorator will be called as the last step of the creation of a new context.
 	// If nil the context will not be decorated.
 	ContextDecorator func(context.Context) (context.Context, error)
+
+	// PanicHandler, if not nil, is called when a service method, or decoding
+	// and validation of its request, panics. It gets the recovered value and
+	// the stack trace, e.g. to report them to an error tracker. The client
+	// gets InternalServerError either way.
+	PanicHandler func(c context.Context, r *http.Request, p interface{}, stack []byte)
+
+	// Platform provides logging, caching and outgoing HTTP requests.
+	// If nil, DefaultPlatform is used.
+	Platform *Platform
 }
 
 // NewServer returns a new RPC server.
@@ -38,7 +50,7 @@ func NewServer(root string) *Server {
 		root += "/"
 	}
 
-	server := &Server{root: root, services: new(serviceMap)}
+	server := &Server{root: root, apiRoot: defaultAPIRoot, services: new(serviceMap)}
 	backend := newBackendService(server)
 	server.services.register(backend, "BackendService", "", "", true, true)
 	return server
@@ -93,29 +105,42 @@ func (s *Server) ServiceByName(serviceName string) *RPCService {
 	return s.services.serviceByName(serviceName)
 }
 
-// HandleHTTP adds Server s to specified http.ServeMux.
+// HandleHTTP adds Server s to specified http.ServeMux, both for the SPI root
+// and the REST API root (/_ah/api/).
 // If no mux is provided http.DefaultServeMux will be used.
 func (s *Server) HandleHTTP(mux *http.ServeMux) {
 	if mux == nil {
 		mux = http.DefaultServeMux
 	}
 	mux.Handle(s.root, s)
+	if s.apiRoot != "" && s.apiRoot != s.root {
+		mux.Handle(s.apiRoot, s)
+	}
 }
 
 // ServeHTTP is Server's implementation of http.Handler interface.
+//
+// Requests under the API root (/_ah/api/ by default) are served as REST
+// calls, anything else is treated as an SPI call.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Always respond with JSON, even when an error occurs.
 	// Note: API server doesn't expect an encoding in Content-Type header.
 	w.Header().Set("Content-Type", "application/json")
-	
-	c := NewContext(r)
-	if s.ContextDecorator != nil {
-		ctx, err := s.ContextDecorator(c)
-		if err != nil {
-			writeError(w, err)
-			return
-		}
-		c = ctx
+
+	if s.apiRoot != "" && strings.HasPrefix(r.URL.Path, s.apiRoot) {
+		s.serveREST(w, r)
+		return
+	}
+	s.serveSPI(w, r)
+}
+
+// serveSPI serves a POST request sent to "ServiceName.MethodName" by
+// Google API server (or a client speaking the same protocol).
+func (s *Server) serveSPI(w http.ResponseWriter, r *http.Request) {
+	c, err := s.newContext(r)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
 	if r.Method != "POST" {
@@ -140,73 +165,119 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Initialize RPC method request
-	reqValue := reflect.New(methodSpec.ReqType)
-
 	body, err := ioutil.ReadAll(r.Body)
 	r.Body.Close()
 	if err != nil {
 		writeError(w, err)
 		return
 	}
-	log.Debugf(c, "SPI request body: %s", body)
+	logger(c).Debugf(c, "SPI request body: %s", body)
 
-	// if err := json.NewDecoder(r.Body).Decode(req.Interface()); err != nil {
-	// 	writeError(w, fmt.Errorf("Error while decoding JSON: %q", err))
-	// 	return
-	// }
-	if err := json.Unmarshal(body, reqValue.Interface()); err != nil {
+	// Restore the body in the original request.
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	resp, err := s.callSPI(c, r, serviceSpec, methodSpec, body)
+	if err != nil {
 		writeError(w, err)
 		return
 	}
 
-	if err := validateRequest(reqValue.Interface()); err != nil {
-		writeError(w, err)
-		return
+	// Encode non-error response
+	if resp != nil {
+		if err := encodeJSON(w, resp); err != nil {
+			writeError(w, err)
+		}
 	}
+}
 
-	// Restore the body in the original request.
-	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+// callSPI decodes and validates an SPI request body and invokes the
+// service method with it. A panic is reported as InternalServerError.
+func (s *Server) callSPI(c context.Context, r *http.Request,
+	serviceSpec *RPCService, methodSpec *ServiceMethod, body []byte) (
+	resp interface{}, err error) {
+
+	defer s.recoverPanic(c, r, serviceSpec, methodSpec, &err)
 
-	numIn, numOut := methodSpec.method.Type.NumIn(), methodSpec.method.Type.NumOut()
-	// Construct arguments for the method call
-	var httpReqOrCtx interface{} = r
-	if methodSpec.wantsContext {
-		httpReqOrCtx = c
+	// Initialize RPC method request
+	reqValue := reflect.New(methodSpec.ReqType)
+	if err := decodeJSON(body, reqValue.Interface()); err != nil {
+		return nil, err
 	}
-	args := []reflect.Value{serviceSpec.rcvr, reflect.ValueOf(httpReqOrCtx)}
-	if numIn > 2 {
-		args = append(args, reqValue)
+	if err := validateRequest(c, reqValue.Interface()); err != nil {
+		return nil, err
 	}
+	return s.invoke(c, r, serviceSpec, methodSpec, reqValue)
+}
 
-	var respValue reflect.Value
-	if numIn > 3 {
-		respValue = reflect.New(methodSpec.RespType)
-		args = append(args, respValue)
+// recoverPanic must be deferred by functions calling service methods.
+// It recovers from a panic, logs it with the stack trace, calls PanicHandler
+// and sets *errp to an InternalServerError which does not disclose the
+// panic value.
+func (s *Server) recoverPanic(c context.Context, r *http.Request,
+	serviceSpec *RPCService, methodSpec *ServiceMethod, errp *error) {
+
+	p := recover()
+	if p == nil {
+		return
+	}
+	stack := debug.Stack()
+	logger(c).Criticalf(c, "panic calling %s.%s: %v\n%s",
+		serviceSpec.Name(), methodSpec.method.Name, p, stack)
+	if s.PanicHandler != nil {
+		s.PanicHandler(c, r, p, stack)
 	}
+	*errp = NewInternalServerError("Internal error calling %s.%s",
+		serviceSpec.Name(), methodSpec.method.Name)
+}
 
-	// Invoke the service method
-	var errValue reflect.Value
-	res := methodSpec.method.Func.Call(args)
-	if numOut == 2 {
-		respValue = res[0]
-		errValue = res[1]
-	} else {
-		errValue = res[0]
+// newContext creates a new context for r and decorates it with
+// ContextDecorator, if any.
+func (s *Server) newContext(r *http.Request) (context.Context, error) {
+	c := s.platform().NewContext(r)
+	if s.ContextDecorator != nil {
+		return s.ContextDecorator(c)
 	}
+	return c, nil
+}
 
-	// Check if method returned an error
-	if err := errValue.Interface(); err != nil {
-		writeError(w, err.(error))
-		return
+// platform returns the Platform of s.
+func (s *Server) platform() *Platform {
+	if s.Platform != nil {
+		return s.Platform
 	}
+	return DefaultPlatform
+}
 
-	// Encode non-error response
-	if numIn == 4 || numOut == 2 {
-		if err := json.NewEncoder(w).Encode(respValue.Interface()); err != nil {
-			writeError(w, err)
-		}
+// invoke calls the service method with an already decoded and validated
+// request value, through server-wide and per-method interceptors.
+//
+// The caller must meet the auth requirements of the method first, and its
+// principal is put on the context the interceptors and the method get.
+//
+// The returned value is the method's response, or nil if the method does
+// not have one.
+func (s *Server) invoke(c context.Context, r *http.Request,
+	serviceSpec *RPCService, methodSpec *ServiceMethod, reqValue reflect.Value) (
+	interface{}, error) {
+
+	call := &MethodCall{
+		Service:     serviceSpec,
+		Method:      methodSpec,
+		Request:     reqValue.Interface(),
+		HTTPRequest: r,
+	}
+	c = context.WithValue(c, methodCallKey, call)
+	c, err := authorizeCall(c, call)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.interceptors) == 0 && len(methodSpec.interceptors) == 0 {
+		return callMethod(c, call)
 	}
+	interceptors := make([]Interceptor, 0, len(s.interceptors)+len(methodSpec.interceptors))
+	interceptors = append(interceptors, s.interceptors...)
+	interceptors = append(interceptors, methodSpec.interceptors...)
+	return chain(interceptors, callMethod)(c, call)
 }
 
 // DefaultServer is the default RPC server, so you don't have to explicitly
@@ -1,16 +1,19 @@
 package endpoints
 
 import (
+	"crypto"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -125,6 +128,23 @@ func (s *ServerTestService) TestMinMax(r *http.Request, req *MinMaxMsg) error {
 	return nil
 }
 
+type RangeMsg struct {
+	Start int `json:"start" endpoints:"max=100"`
+	End   int `json:"end"`
+}
+
+func (m *RangeMsg) Validate(c context.Context) error {
+	if m.End < m.Start {
+		return &FieldViolation{Field: "end", Constraint: "range", Value: m.End, Limit: m.Start,
+			Msg: "end is before start"}
+	}
+	return nil
+}
+
+func (s *ServerTestService) TestValidator(r *http.Request, req *RangeMsg) error {
+	return nil
+}
+
 // Service methods for args testing
 
 func (s *ServerTestService) MsgWithRequest(r *http.Request, req, resp *TestMsg) error {
@@ -192,7 +212,7 @@ func createAPIServer() *Server {
 		m := rpc.rcvrType.Method(i)
 		sm := &ServiceMethod{
 			method:       &m,
-			wantsContext: m.Type.In(1).Implements(typeOfContext),
+			wantsContext: isContextType(m.Type.In(1)),
 		}
 		if m.Type.NumIn() > 2 {
 			sm.ReqType = m.Type.In(2).Elem()
@@ -204,6 +224,7 @@ func createAPIServer() *Server {
 		} else if m.Type.NumIn() > 3 {
 			sm.RespType = m.Type.In(3).Elem()
 		}
+		sm.invoke = newMethodInvoker(sm)
 		rpc.methods[m.Name] = sm
 	}
 
@@ -334,6 +355,72 @@ func TestServerMethodCall(t *testing.T) {
 	}
 }
 
+func TestServerValidationError(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	body := strings.NewReader(`{"age":123,"weight":1,"grade":"C"}`)
+	r, err := inst.NewRequest("POST", "/ServerTestService.TestMinMax", body)
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	want := `{"state":"APPLICATION_ERROR","error_name":"Bad Request",` +
+		`"error_message":"123 is too big; 1 is too small","field_violations":[` +
+		`{"field":"Age","constraint":"max","value":123,"limit":100,"message":"123 is too big"},` +
+		`{"field":"Weight","constraint":"min","value":1,"limit":3.14,"message":"1 is too small"}]}`
+	if res := strings.TrimSpace(w.Body.String()); res != want {
+		t.Errorf("TestMinMax res = %s; want %s", res, want)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("TestMinMax code = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServerValidator(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		body, res string
+		code      int
+	}{
+		{`{"start":1,"end":2}`, ``, http.StatusOK},
+		{`{"start":2,"end":1}`, `{"state":"APPLICATION_ERROR","error_name":"Bad Request",` +
+			`"error_message":"end is before start","field_violations":[` +
+			`{"field":"end","constraint":"range","value":1,"limit":2,"message":"end is before start"}]}`,
+			http.StatusBadRequest},
+		{`{"start":200,"end":1}`, `{"state":"APPLICATION_ERROR","error_name":"Bad Request",` +
+			`"error_message":"200 is too big","field_violations":[` +
+			`{"field":"start","constraint":"max","value":200,"limit":100,"message":"200 is too big"}]}`,
+			http.StatusBadRequest},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ServerTestService.TestValidator", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if res := strings.TrimSpace(w.Body.String()); res != tt.res {
+			t.Errorf("%d: TestValidator res = %s; want %s", i, res, tt.res)
+		}
+		if w.Code != tt.code {
+			t.Errorf("%d: TestValidator code = %d; want %d", i, w.Code, tt.code)
+		}
+	}
+}
+
 func TestServerRegisterService(t *testing.T) {
 	s, err := NewServer("").
 		RegisterService(&ServerTestService{}, "ServerTestService", "v1", "", true)
@@ -362,6 +449,96 @@ func TestServerRegisterService(t *testing.T) {
 	}
 }
 
+type BadTagItem struct {
+	Name string `json:"name" endpoints:"reqd"`
+}
+
+type BadTagMsg struct {
+	Items []*BadTagItem `json:"items"`
+}
+
+type BadTagService struct{}
+
+func (s *BadTagService) Get(c context.Context, req *VoidMessage) (*BadTagMsg, error) {
+	return nil, nil
+}
+
+func TestServerRegisterServiceBadTag(t *testing.T) {
+	_, err := NewServer("").RegisterService(&BadTagService{}, "BadTagService", "v1", "", true)
+	want := `endpoints: BadTagService.Get: tag of endpoints.BadTagItem.Name: Unknown option "reqd"`
+	if err == nil || err.Error() != want {
+		t.Errorf("RegisterService(BadTagService) = %v; want %q", err, want)
+	}
+}
+
+func TestPathParamNames(t *testing.T) {
+	type msg struct {
+		ID     string `json:"id" endpoints:"req,path"`
+		Parent string `endpoints:"path,desc='Parent, if any'"`
+		Name   string `json:"name" endpoints:"required"`
+		hidden string `endpoints:"path"`
+	}
+	names := pathParamNames(reflect.TypeOf(msg{}))
+	if want := []string{"id", "Parent"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("pathParamNames() = %v; want %v", names, want)
+	}
+
+	type legacyMsg struct {
+		ID   string `json:"id" endpoints:"required"`
+		Kind string `endpoints:"req"`
+		Name string `endpoints:"d=none,required"`
+	}
+	names = pathParamNames(reflect.TypeOf(legacyMsg{}))
+	if want := []string{"ID", "Name"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("pathParamNames(legacyMsg) = %v; want %v", names, want)
+	}
+}
+
+type InferredPathMsg struct {
+	Content string `json:"content" endpoints:"req"`
+	Author  string `json:"author"`
+}
+
+type InferredPathKeyMsg struct {
+	ID string `json:"id" endpoints:"req,path"`
+}
+
+type InferredPathRequiredMsg struct {
+	ID string `endpoints:"required"`
+}
+
+type InferredPathService struct{}
+
+func (s *InferredPathService) Add(c context.Context, req *InferredPathMsg) error {
+	return nil
+}
+
+func (s *InferredPathService) Get(c context.Context, req *InferredPathKeyMsg) error {
+	return nil
+}
+
+func (s *InferredPathService) Find(c context.Context, req *InferredPathRequiredMsg) error {
+	return nil
+}
+
+func TestServerRegisterServiceInferredPath(t *testing.T) {
+	s, err := NewServer("").RegisterService(&InferredPathService{}, "paths", "v1", "", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	add := s.MethodByName("Add").Info()
+	get := s.MethodByName("Get").Info()
+	find := s.MethodByName("Find").Info()
+	verifyPairs(t,
+		add.Path, "add",
+		add.HTTPMethod, "POST",
+		get.Path, "get/{id}",
+		get.HTTPMethod, "GET",
+		find.Path, "find/{ID}",
+		find.HTTPMethod, "GET",
+	)
+}
+
 func TestServerMustRegisterService(t *testing.T) {
 	s := NewServer("")
 
@@ -460,3 +637,314 @@ func TestContextDecorator(t *testing.T) {
 		t.Errorf("response body: %s", msg)
 	}
 }
+
+// PanicMsg panics when decoded from JSON.
+type PanicMsg struct{}
+
+func (m *PanicMsg) UnmarshalJSON([]byte) error {
+	panic("decoding panic")
+}
+
+func (s *ServerTestService) Panic(c context.Context, req *TestMsg) (*TestMsg, error) {
+	panic("method panic")
+}
+
+func (s *ServerTestService) PanicDecoding(c context.Context, req *PanicMsg) error {
+	return nil
+}
+
+func TestServerRecoverPanic(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	var panics []interface{}
+	server.PanicHandler = func(c context.Context, r *http.Request, p interface{}, stack []byte) {
+		if r == nil || len(stack) == 0 {
+			t.Errorf("PanicHandler(%v, %q) called without request or stack", r, stack)
+		}
+		panics = append(panics, p)
+	}
+
+	for i, name := range []string{"Panic", "PanicDecoding"} {
+		r, _ := inst.NewRequest("POST", "/ServerTestService."+name, strings.NewReader(`{"name":"gopher"}`))
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%d: %s w.Code = %d; want %d", i, name, w.Code, http.StatusInternalServerError)
+		}
+		var errResp errorResponse
+		if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+			t.Errorf("%d: %s error decoding response: %v", i, name, err)
+		}
+		verifyPairs(t,
+			errResp.State, "APPLICATION_ERROR",
+			errResp.Name, "Internal Server Error",
+			errResp.Msg, "Internal error calling ServerTestService."+name,
+		)
+	}
+
+	want := []interface{}{"method panic", "decoding panic"}
+	if !reflect.DeepEqual(panics, want) {
+		t.Errorf("panics = %v; want %v", panics, want)
+	}
+}
+
+func TestServerRecoverPanicREST(t *testing.T) {
+	server := createRESTServer(t)
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server.Use(func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+		if call.Method.Info().Name == "items.delete" {
+			panic("interceptor panic")
+		}
+		return next(c, call)
+	})
+
+	tts := []struct {
+		method, path, body string
+		code               int
+		out                string
+	}{
+		{"DELETE", "/_ah/api/rest/v1/items/1", ``, http.StatusInternalServerError, ``},
+		{"POST", "/_ah/api/rpc",
+			`[{"jsonrpc":"2.0","id":1,"method":"rest.items.delete","params":{"id":"1"}},` +
+				`{"jsonrpc":"2.0","id":2,"method":"rest.items.count"}]`,
+			http.StatusOK,
+			`[{"jsonrpc":"2.0","id":1,"error":{"code":500,"message":"Internal error calling RESTTestService.Delete",` +
+				`"data":[{"domain":"global","reason":"Internal Server Error","message":"Internal error calling RESTTestService.Delete"}]}},` +
+				`{"jsonrpc":"2.0","id":2,"result":{"name":"count"}}]`},
+	}
+	for i, tt := range tts {
+		r, _ := inst.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s w.Code = %d; want %d", i, tt.method, tt.path, w.Code, tt.code)
+		}
+		if res := strings.TrimSpace(w.Body.String()); tt.out != "" && res != tt.out {
+			t.Errorf("%d: %s %s res = %s; want %s", i, tt.method, tt.path, res, tt.out)
+		}
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	key := testPrivateKey(t)
+	tokeninfo := func() *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+		}
+	}
+	rt := newTestRoundTripper(
+		testJWKSResponse(map[string]crypto.PublicKey{"fb": &key.PublicKey}),
+		tokeninfo(), tokeninfo(), tokeninfo())
+	server := createRESTServer(t)
+	server.Platform = NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+	server.Platform.Transport = func(context.Context) http.RoundTripper { return rt }
+
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	currentUTC = func() time.Time {
+		return jwtValidTokenTime
+	}
+
+	s := server.ServiceByName("RESTTestService")
+	s.Info().Issuers = map[string]*Issuer{"firebase": FirebaseIssuer("my-project")}
+	s.MethodByName("Get").Info().Issuers = []string{"firebase"}
+	s.MethodByName("Insert").Info().Issuers = []string{"firebase"}
+	s.MethodByName("Insert").Info().AllowAnonymous = true
+	info := s.MethodByName("Delete").Info()
+	info.Scopes, info.ClientIds, info.Issuers = []string{"scope.two"}, []string{"my-client-id"}, []string{}
+
+	var principals []*Principal
+	server.Use(func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+		principals = append(principals, PrincipalFromContext(c))
+		return next(c, call)
+	})
+
+	idToken := "Bearer " + signTestClaims(t, key, "fb", &signedJWT{
+		Issuer:   "https://securetoken.google.com/my-project",
+		Audience: "my-project",
+		Subject:  "fb-user",
+		Expires:  jwtValidTokenObject.Expires,
+		IssuedAt: jwtValidTokenObject.IssuedAt,
+	})
+	tts := []struct {
+		method, path, auth string
+		code               int
+		principal          string
+	}{
+		{"GET", "/_ah/api/rest/v1/items/count", "", http.StatusOK, ""},
+		{"GET", "/_ah/api/rest/v1/items/count", idToken, http.StatusOK, ""},
+		{"GET", "/_ah/api/rest/v1/items/1", "", http.StatusUnauthorized, ""},
+		{"GET", "/_ah/api/rest/v1/items/1", "Bearer invalid", http.StatusUnauthorized, ""},
+		{"GET", "/_ah/api/rest/v1/items/1", idToken, http.StatusOK, "fb-user"},
+		{"POST", "/_ah/api/rest/v1/items/1", "", http.StatusOK, ""},
+		{"POST", "/_ah/api/rest/v1/items/1", idToken, http.StatusOK, "fb-user"},
+		{"DELETE", "/_ah/api/rest/v1/items/1", "Bearer ya29.token", http.StatusNoContent, tokeinfoUserID},
+	}
+	for i, tt := range tts {
+		principals = nil
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s w.Code = %d; want %d", i, tt.method, tt.path, w.Code, tt.code)
+		}
+		if tt.code >= http.StatusBadRequest {
+			if len(principals) != 0 {
+				t.Errorf("%d: %s %s called the method; want no call", i, tt.method, tt.path)
+			}
+			continue
+		}
+		var id string
+		if len(principals) == 1 && principals[0] != nil {
+			id = principals[0].ID
+		}
+		if len(principals) != 1 || id != tt.principal {
+			t.Errorf("%d: %s %s principal = %q (%d calls); want %q", i, tt.method, tt.path, id, len(principals), tt.principal)
+		}
+	}
+
+	info.ClientIds = []string{"other-client-id"}
+	r := httptest.NewRequest("DELETE", "/_ah/api/rest/v1/items/1", nil)
+	r.Header.Set("Authorization", "Bearer ya29.token")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("DELETE with a token of another client w.Code = %d; want %d", w.Code, http.StatusForbidden)
+	}
+	if rt.Count() != 4 {
+		t.Errorf("rt.Count() = %d; want 4", rt.Count())
+	}
+}
+
+func TestServerAuthIDTokenWithoutScopes(t *testing.T) {
+	key := testPrivateKey(t)
+	rt := newTestRoundTripper(testJWKSResponse(map[string]crypto.PublicKey{"goog-1": &key.PublicKey}))
+	server := createRESTServer(t)
+	server.Platform = newTestPlatform()
+	server.Platform.Transport = func(context.Context) http.RoundTripper { return rt }
+
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	currentUTC = func() time.Time {
+		return jwtValidTokenTime
+	}
+
+	info := server.ServiceByName("RESTTestService").MethodByName("Get").Info()
+	info.Audiences = []string{jwtValidTokenObject.Audience}
+	info.ClientIds = []string{jwtValidTokenObject.ClientID}
+
+	var principal *Principal
+	server.Use(func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+		principal = PrincipalFromContext(c)
+		return next(c, call)
+	})
+
+	r := httptest.NewRequest("GET", "/_ah/api/rest/v1/items/1", nil)
+	r.Header.Set("Authorization", "Bearer "+signTestJWT(t, key, "goog-1"))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %d; want %d", w.Code, http.StatusOK)
+	}
+	if principal == nil {
+		t.Fatal("principal = nil; want the ID token principal")
+	}
+	verifyPairs(t,
+		principal.Method, AuthIDToken,
+		principal.Email, jwtValidTokenObject.Email,
+		principal.ClientID, jwtValidTokenObject.ClientID,
+	)
+}
+
+func TestServerAuthWithoutClientIDs(t *testing.T) {
+	key := testPrivateKey(t)
+	tokeninfo := func() *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+		}
+	}
+	rt := newTestRoundTripper(
+		testJWKSResponse(map[string]crypto.PublicKey{"goog-1": &key.PublicKey}),
+		tokeninfo(), tokeninfo())
+	server := createRESTServer(t)
+	server.Platform = newTestPlatform()
+	server.Platform.Transport = func(context.Context) http.RoundTripper { return rt }
+
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	currentUTC = func() time.Time {
+		return jwtValidTokenTime
+	}
+
+	s := server.ServiceByName("RESTTestService")
+	s.MethodByName("Get").Info().Audiences = []string{jwtValidTokenObject.Audience}
+	s.MethodByName("Delete").Info().Scopes = []string{"scope.two"}
+
+	var principals []*Principal
+	server.Use(func(c context.Context, call *MethodCall, next Invoker) (interface{}, error) {
+		principals = append(principals, PrincipalFromContext(c))
+		return next(c, call)
+	})
+
+	otherAudience := jwtValidTokenObject
+	otherAudience.Audience = "other-client-id"
+	tts := []struct {
+		method, path, auth string
+		code               int
+		principal          string
+	}{
+		// Audiences only: ID tokens of any client issued to the audiences.
+		{"GET", "/_ah/api/rest/v1/items/1", "Bearer " + signTestJWT(t, key, "goog-1"), http.StatusOK,
+			jwtValidTokenObject.Email},
+		{"GET", "/_ah/api/rest/v1/items/1", "Bearer " + signTestClaims(t, key, "goog-1", &otherAudience),
+			http.StatusUnauthorized, ""},
+		{"GET", "/_ah/api/rest/v1/items/1", "", http.StatusUnauthorized, ""},
+		// Scopes only: Bearer tokens of any client with the scopes.
+		{"DELETE", "/_ah/api/rest/v1/items/1", "Bearer ya29.token", http.StatusNoContent, tokeninfoEmail},
+		{"DELETE", "/_ah/api/rest/v1/items/1", "", http.StatusUnauthorized, ""},
+	}
+	for i, tt := range tts {
+		principals = nil
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s w.Code = %d; want %d", i, tt.method, tt.path, w.Code, tt.code)
+		}
+		if tt.code >= http.StatusBadRequest {
+			if len(principals) != 0 {
+				t.Errorf("%d: %s %s called the method; want no call", i, tt.method, tt.path)
+			}
+			continue
+		}
+		var email string
+		if len(principals) == 1 && principals[0] != nil {
+			email = principals[0].Email
+		}
+		if len(principals) != 1 || email != tt.principal {
+			t.Errorf("%d: %s %s principal = %q (%d calls); want %q", i, tt.method, tt.path, email, len(principals), tt.principal)
+		}
+	}
+	if rt.Count() != 3 {
+		t.Errorf("rt.Count() = %d; want 3", rt.Count())
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"unicode"
@@ -75,6 +76,9 @@ type ServiceInfo struct {
 	Version     string
 	Default     bool
 	Description string
+	// Issuers are providers of ID tokens accepted by the API, by name.
+	// Methods trust all of them unless they list some in MethodInfo.Issuers.
+	Issuers map[string]*Issuer
 }
 
 // ServiceMethod is what represents a method of a registered service
@@ -89,6 +93,10 @@ type ServiceMethod struct {
 	wantsContext bool
 	// info used to construct Endpoints API config
 	info *MethodInfo
+	// interceptors wrap calls of this method only, see Use.
+	interceptors []Interceptor
+	// invoke calls the method, see newMethodInvoker.
+	invoke methodInvoker
 }
 
 // Info returns a MethodInfo struct of a registered service's method
@@ -105,7 +113,15 @@ type MethodInfo struct {
 	Scopes     []string
 	Audiences  []string
 	ClientIds  []string
-	Desc       string
+	// Issuers names the issuers of ServiceInfo.Issuers the method trusts.
+	// If nil, the method trusts all of them once it declares scopes,
+	// audiences or client IDs.
+	Issuers []string
+	// AllowAnonymous lets callers without valid credentials call a method
+	// which declares scopes, audiences, client IDs or issuers. Callers are
+	// still authenticated when they can be.
+	AllowAnonymous bool
+	Desc           string
 }
 
 // ----------------------------------------------------------------------------
@@ -158,9 +174,15 @@ func (m *serviceMap) register(srv interface{}, name, ver, desc string, isDefault
 	for i := 0; i < s.rcvrType.NumMethod(); i++ {
 		method := s.rcvrType.Method(i)
 		srvMethod := newServiceMethod(&method, internal)
-		if srvMethod != nil {
-			s.methods[method.Name] = srvMethod
+		if srvMethod == nil {
+			continue
 		}
+		for _, t := range []reflect.Type{srvMethod.ReqType, srvMethod.RespType} {
+			if err := checkTags(t); err != nil {
+				return nil, fmt.Errorf("endpoints: %s.%s: %v", s.name, method.Name, err)
+			}
+		}
+		s.methods[method.Name] = srvMethod
 	}
 	if len(s.methods) == 0 {
 		return nil, fmt.Errorf(
@@ -175,6 +197,18 @@ func (m *serviceMap) register(srv interface{}, name, ver, desc string, isDefault
 	} else if _, ok := m.services[s.name]; ok {
 		return nil, fmt.Errorf("endpoints: service already defined: %q", s.name)
 	}
+	if !internal {
+		// Schemas of all services of an API share names.
+		api := []*RPCService{s}
+		for _, other := range m.services {
+			if !other.internal && other.info.Name == s.info.Name && other.info.Version == s.info.Version {
+				api = append(api, other)
+			}
+		}
+		if err := checkSchemas(api); err != nil {
+			return nil, fmt.Errorf("endpoints: %s: %v", s.name, err)
+		}
+	}
 	m.services[s.name] = s
 	return s, nil
 }
@@ -241,13 +275,18 @@ func newServiceMethod(m *reflect.Method, internal bool) *ServiceMethod {
 		ReqType:      reqType.Elem(),
 		RespType:     respType.Elem(),
 		method:       m,
-		wantsContext: httpReqType.Implements(typeOfContext),
+		wantsContext: isContextType(httpReqType),
+	}
+	method.invoke = newMethodInvoker(method)
+	if method.ReqType.Kind() == reflect.Struct {
+		// Compile validation of requests ahead of the first call.
+		validationPlanFor(method.ReqType)
 	}
 	if !internal {
 		mname := strings.ToLower(m.Name)
 		method.info = &MethodInfo{Name: mname}
 
-		params := requiredParamNames(method.ReqType)
+		params := pathParamNames(method.ReqType)
 		numParam := len(params)
 		if method.ReqType.Kind() == reflect.Struct {
 			switch {
@@ -267,23 +306,34 @@ func newServiceMethod(m *reflect.Method, internal bool) *ServiceMethod {
 }
 
 // Used to infer method's info.Path.
+// Fields tagged with "path" are path parameters, named after their JSON
+// names. Types without such fields keep the original inference: fields
+// tagged with "required" are path parameters, named after the fields.
 // TODO: refactor this and move to apiconfig.go?
-func requiredParamNames(t reflect.Type) []string {
+func pathParamNames(t reflect.Type) []string {
 	if t.Kind() == reflect.Struct {
 		params := make([]string, 0, t.NumField())
+		required := make([]string, 0, t.NumField())
 		for i := 0; i < t.NumField(); i++ {
 			field := t.Field(i)
 			// consider only exported fields
 			if field.PkgPath == "" {
+				// Invalid tags are reported by RegisterService.
+				if tag, err := parseTag(field.Tag); err == nil && tag.path {
+					params = append(params, jsonFieldName(field))
+				}
 				parts := strings.Split(field.Tag.Get("endpoints"), ",")
 				for _, p := range parts {
 					if p == "required" {
-						params = append(params, field.Name)
+						required = append(required, field.Name)
 						break
 					}
 				}
 			}
 		}
+		if len(params) == 0 {
+			return required
+		}
 		return params
 	}
 	return []string{}
@@ -324,6 +374,40 @@ func (m *serviceMap) serviceByName(serviceName string) *RPCService {
 	return m.services[serviceName]
 }
 
+// publicServices returns all registered services except internal ones,
+// sorted by service name.
+func (m *serviceMap) publicServices() []*RPCService {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	services := make([]*RPCService, 0, len(m.services))
+	for _, s := range m.services {
+		if !s.internal {
+			services = append(services, s)
+		}
+	}
+	sort.Sort(servicesByName(services))
+	return services
+}
+
+// servicesByAPI returns all public services registered with the given
+// API name and version, sorted by service name.
+func (m *serviceMap) servicesByAPI(name, version string) []*RPCService {
+	var services []*RPCService
+	for _, s := range m.publicServices() {
+		if s.info.Name == name && s.info.Version == version {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+// servicesByName sorts RPCService by name.
+type servicesByName []*RPCService
+
+func (s servicesByName) Len() int           { return len(s) }
+func (s servicesByName) Less(i, j int) bool { return s[i].name < s[j].name }
+func (s servicesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 // isExported returns true of a string is an exported (upper case) name.
 func isExported(name string) bool {
 	rune, _ := utf8.DecodeRuneInString(name)
@@ -342,8 +426,16 @@ func isExportedOrBuiltin(t reflect.Type) bool {
 
 // isRequestOrContext returns true if type t is either *http.Request or Context
 func isRequestOrContext(t reflect.Type) bool {
-	if t.Implements(typeOfContext) {
+	if isContextType(t) {
 		return true
 	}
 	return t.Kind() == reflect.Ptr && t.Elem() == typeOfRequest
 }
+
+// isContextType returns true if any Context can be passed as an argument of
+// type t, i.e. t is an interface with the same methods as Context, e.g.
+// context.Context of the standard library. Types which only implement
+// Context, such as a concrete context type, are not.
+func isContextType(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.Implements(typeOfContext) && typeOfContext.AssignableTo(t)
+}
@@ -1,3 +1,6 @@
+//go:build !noappengine
+// +build !noappengine
+
 package endpoints
 
 import (
@@ -12,8 +15,3 @@ import (
 var httpTransportFactory = func(c context.Context) http.RoundTripper {
 	return &urlfetch.Transport{Context: c}
 }
-
-// newHTTPClient returns a new HTTP client using httpTransportFactory
-func newHTTPClient(c context.Context) *http.Client {
-	return &http.Client{Transport: httpTransportFactory(c)}
-}
@@ -5,6 +5,8 @@ package endpoints
 import (
 	"errors"
 	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"reflect"
 	"testing"
@@ -50,6 +52,12 @@ func newTestRequest(t *testing.T, method, path string, body io.Reader) (
 	return req, inst, func() { inst.Close() }
 }
 
+// newTestPlatform returns a standard Platform which discards log messages,
+// for tests which do not need App Engine.
+func newTestPlatform() *Platform {
+	return NewStandardPlatform(log.New(ioutil.Discard, "", 0))
+}
+
 func newTestRoundTripper(resp ...*http.Response) *TestRoundTripper {
 	rt := &TestRoundTripper{}
 	rt.Add(resp...)
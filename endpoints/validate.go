@@ -0,0 +1,559 @@
+package endpoints
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+)
+
+// Validator is implemented by request types with rules beyond "endpoints"
+// field tags, e.g. rules involving several fields. Validate is called after
+// the fields of a request, or of a struct nested in it, pass tag validation
+// and have their default values set.
+//
+// A returned *FieldViolation or *ValidationError is reported along with
+// violations found in other fields, with paths relative to the validated
+// struct. An *APIError is returned to the client as is, any other error is
+// reported as a violation of the struct itself.
+type Validator interface {
+	Validate(c context.Context) error
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// validationPlan is the compiled "endpoints" tags of a request struct type.
+// Tags are parsed once per type, validation of a request only inspects
+// field values.
+type validationPlan struct {
+	fields []*fieldValidation
+	// validator is true if a pointer to the type implements Validator.
+	validator bool
+}
+
+// fieldValidation is the compiled "endpoints" tag of a single field.
+// Errors found while compiling it are reported when a value is validated,
+// in the same order as the checks.
+type fieldValidation struct {
+	index int
+	name  string
+	// path is the JSON name of the field, reported in violations.
+	path string
+	// flatten is true for embedded structs, whose fields are encoded as
+	// fields of the outer struct.
+	flatten  bool
+	required bool
+	// tagErr is an error parsing the tag, no other checks apply.
+	tagErr error
+	// defaultVal is set to a zero field, it is invalid if there's no
+	// default. defaultErr is reported instead for a zero field.
+	defaultVal reflect.Value
+	defaultErr error
+	// min and max are of the field's type, or the type it points to,
+	// invalid if not specified.
+	min, max       reflect.Value
+	minErr, maxErr error
+	// pattern, lengths, numbers of items and enum apply to non-zero
+	// values. Lengths and numbers of items are -1 if not specified.
+	pattern              *regexp.Regexp
+	minLength, maxLength int
+	minItems, maxItems   int
+	enum                 []string
+	// itemEnum are valid values of items of a slice or an array of an
+	// enumeration type, or pointers to it, see EnumProvider.
+	itemEnum []string
+	// nested validates structs in the field value, nil if there are none.
+	nested *nestedValidation
+}
+
+// nestedValidation validates structs in a value of a struct type, or of
+// a pointer, slice, array or map type whose elements contain structs.
+type nestedValidation struct {
+	kind reflect.Kind
+	// plan is set for a struct, elem for other kinds.
+	plan *validationPlan
+	elem *nestedValidation
+}
+
+// validationPlans caches validation plans by request type.
+var validationPlans = struct {
+	sync.RWMutex
+	m map[reflect.Type]*validationPlan
+}{m: make(map[reflect.Type]*validationPlan)}
+
+// validationPlanFor returns a cached validation plan of struct type t,
+// compiling it first if necessary.
+func validationPlanFor(t reflect.Type) *validationPlan {
+	validationPlans.RLock()
+	plan := validationPlans.m[t]
+	validationPlans.RUnlock()
+	if plan != nil {
+		return plan
+	}
+
+	validationPlans.Lock()
+	defer validationPlans.Unlock()
+	return validationPlanLocked(t)
+}
+
+// validationPlanLocked returns a cached validation plan of struct type t,
+// compiling it first if necessary. A plan is cached before its fields are
+// compiled, so that fields of recursive types refer to the plan being
+// compiled. validationPlans must be locked.
+func validationPlanLocked(t reflect.Type) *validationPlan {
+	if plan := validationPlans.m[t]; plan != nil {
+		return plan
+	}
+	plan := &validationPlan{}
+	validationPlans.m[t] = plan
+	plan.compile(t)
+	return plan
+}
+
+// compile compiles tags of exported fields of struct type t. Fields which
+// contain structs, directly or in pointers, slices, arrays or maps, are
+// validated recursively. Fields without tags or nested structs are
+// ignored.
+func (p *validationPlan) compile(t reflect.Type) {
+	p.validator = reflect.PtrTo(t).Implements(validatorType)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fv := &fieldValidation{
+			index:   i,
+			name:    field.Name,
+			path:    jsonFieldName(field),
+			flatten: field.Anonymous && strings.Split(field.Tag.Get("json"), ",")[0] == "",
+			nested:  newNestedValidation(field.Type, nil),
+		}
+		fv.enum, _ = enumValues(typeEnum(indirectType(field.Type)))
+		if k := field.Type.Kind(); k == reflect.Slice || k == reflect.Array {
+			fv.enum = nil
+			fv.itemEnum, _ = enumValues(typeEnum(indirectType(field.Type.Elem())))
+		}
+		if field.Tag.Get("endpoints") == "" && fv.nested == nil && fv.enum == nil && fv.itemEnum == nil {
+			continue
+		}
+		p.fields = append(p.fields, fv)
+
+		tag, err := parseTag(field.Tag)
+		if err != nil {
+			fv.tagErr = fmt.Errorf("parse tag: %v", err)
+			continue
+		}
+		if err := tag.checkType(field.Type); err != nil {
+			fv.tagErr = fmt.Errorf("parse tag: %v", err)
+			continue
+		}
+		fv.required = tag.required
+		if tag.pattern != "" {
+			fv.pattern = regexp.MustCompile(tag.pattern)
+		}
+		fv.minLength, fv.maxLength = tag.minLength, tag.maxLength
+		fv.minItems, fv.maxItems = tag.minItems, tag.maxItems
+		if len(tag.enum) > 0 {
+			fv.enum = tag.enum
+		}
+		if tag.defaultVal != "" {
+			fv.defaultVal, fv.defaultErr = parseValueOf(tag.defaultVal, field.Type)
+			if fv.defaultErr != nil {
+				fv.defaultErr = fmt.Errorf("parse default value: %v", fv.defaultErr)
+			}
+		}
+		boundType := field.Type
+		if boundType.Kind() == reflect.Ptr {
+			boundType = boundType.Elem()
+		}
+		if tag.minVal != "" {
+			fv.min, fv.minErr = parseBound(tag.minVal, boundType)
+			if fv.minErr != nil {
+				fv.minErr = fmt.Errorf("compare with min value: parse min value: %v", fv.minErr)
+			}
+		}
+		if tag.maxVal != "" {
+			fv.max, fv.maxErr = parseBound(tag.maxVal, boundType)
+			if fv.maxErr != nil {
+				fv.maxErr = fmt.Errorf("compare with max value: parse max value: %v", fv.maxErr)
+			}
+		}
+	}
+}
+
+// newNestedValidation returns a validation of structs in values of type t,
+// or nil if they don't contain structs. seen are the pointer, slice, array
+// and map types t is an element of, which guards against types like
+// "type List []List". validationPlans must be locked.
+func newNestedValidation(t reflect.Type, seen map[reflect.Type]bool) *nestedValidation {
+	switch t.Kind() {
+	case reflect.Struct:
+		return &nestedValidation{kind: reflect.Struct, plan: validationPlanLocked(t)}
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		if seen[t] {
+			return nil
+		}
+		if seen == nil {
+			seen = make(map[reflect.Type]bool)
+		}
+		seen[t] = true
+		if elem := newNestedValidation(t.Elem(), seen); elem != nil {
+			return &nestedValidation{kind: t.Kind(), elem: elem}
+		}
+	}
+	return nil
+}
+
+// jsonFieldName returns the name of field in JSON, or the field name if it
+// is not encoded.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// parseValueOf parses s into a value of type t.
+func parseValueOf(s string, t reflect.Type) (reflect.Value, error) {
+	val, err := parseValue(s, t.Kind())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(val).Convert(t), nil
+}
+
+// parseBound parses s into a min or max value of type t, which must be
+// a number or a string.
+func parseBound(s string, t reflect.Type) (reflect.Value, error) {
+	switch k := t.Kind(); {
+	case reflect.Int <= k && k <= reflect.Uint64,
+		k == reflect.Float32, k == reflect.Float64, k == reflect.String:
+		return parseValueOf(s, t)
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported type %v", t)
+}
+
+// validateRequest validates a request struct, pointed to by r, according
+// to "endpoints" tags of its fields and sets default values of zero fields.
+// Structs nested in fields, their pointers, slices, arrays and maps are
+// validated the same way, and then with their Validate methods, if they
+// implement Validator.
+// All fields which fail validation are reported in a *ValidationError.
+// Other errors, e.g. of tags which cannot be parsed, are returned as is.
+func validateRequest(c context.Context, r interface{}) error {
+	v := reflect.ValueOf(r)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("%T is not a pointer", r)
+	}
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a pointer to a struct", r)
+	}
+	var violations []*FieldViolation
+	if err := validationPlanFor(v.Type()).validate(c, v, "", &violations); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return NewValidationError(violations...)
+	}
+	return nil
+}
+
+// validate validates struct v, which must be of the plan's type and
+// addressable, and structs nested in its fields. Violations are appended to
+// *violations, with paths of fields relative to path, the path of v.
+func (p *validationPlan) validate(c context.Context, v reflect.Value, path string, violations *[]*FieldViolation) error {
+	n := len(*violations)
+	for _, fv := range p.fields {
+		field := v.Field(fv.index)
+		err := fv.validate(field)
+		if violation, ok := err.(*FieldViolation); ok {
+			violation.Field = joinPath(path, violation.Field)
+			*violations = append(*violations, violation)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if fv.nested == nil {
+			continue
+		}
+		fieldPath := path
+		if !fv.flatten {
+			fieldPath = joinPath(path, fv.path)
+		}
+		if err := fv.nested.validate(c, field, fieldPath, violations); err != nil {
+			return err
+		}
+	}
+	if p.validator && len(*violations) == n {
+		return callValidator(c, v, path, violations)
+	}
+	return nil
+}
+
+// callValidator calls Validate of addressable struct v at path and appends
+// violations it reports to *violations.
+func callValidator(c context.Context, v reflect.Value, path string, violations *[]*FieldViolation) error {
+	err := v.Addr().Interface().(Validator).Validate(c)
+	var reported []*FieldViolation
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *APIError:
+		return e
+	case *FieldViolation:
+		reported = []*FieldViolation{e}
+	case *ValidationError:
+		reported = e.Violations
+	}
+	if len(reported) == 0 {
+		reported = []*FieldViolation{{Constraint: "validate", Msg: err.Error()}}
+	}
+	for _, fv := range reported {
+		// Violations may be shared by the Validate method, they are copied
+		// before their paths are changed.
+		copied := *fv
+		if copied.Field == "" {
+			copied.Field = path
+		} else {
+			copied.Field = joinPath(path, copied.Field)
+		}
+		*violations = append(*violations, &copied)
+	}
+	return nil
+}
+
+// validate validates structs in v, a value at path.
+func (nv *nestedValidation) validate(c context.Context, v reflect.Value, path string, violations *[]*FieldViolation) error {
+	switch nv.kind {
+	case reflect.Struct:
+		return nv.plan.validate(c, v, path, violations)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return nv.elem.validate(c, v.Elem(), path, violations)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := nv.elem.validate(c, v.Index(i), fmt.Sprintf("%s[%d]", path, i), violations); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Map values are not addressable, they are validated in a copy,
+		// which is stored back with defaults set.
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := nv.elem.validate(c, elem, joinPath(path, fmt.Sprint(key.Interface())), violations); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// joinPath returns the JSON path of field name of a value at path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// validate validates the value of the field. It returns a *FieldViolation
+// if the value is invalid. Min and max values, as well as other constraints
+// of a pointer field apply to the value it points to. Constraints other than
+// required, min and max don't apply to zero values, except for empty slices
+// and maps which are not nil.
+func (fv *fieldValidation) validate(v reflect.Value) error {
+	if fv.tagErr != nil {
+		return fv.tagErr
+	}
+
+	isZero := isZeroValue(v)
+	if isZero && fv.required {
+		return &FieldViolation{
+			Field:      fv.path,
+			Constraint: "required",
+			Msg:        fmt.Sprintf("missing field %v", fv.name),
+		}
+	}
+	if isZero && fv.defaultErr != nil {
+		return fv.defaultErr
+	}
+	if isZero && fv.defaultVal.IsValid() {
+		v.Set(fv.defaultVal)
+	}
+
+	// bound is invalid for a nil pointer, which is not compared.
+	bound := reflect.Indirect(v)
+	if fv.minErr != nil {
+		return fv.minErr
+	}
+	if fv.min.IsValid() && bound.IsValid() && compareSimple(bound, fv.min) < 0 {
+		return fv.violation(bound.Interface(), "min", fv.min.Interface(), fmt.Sprintf("%v is too small", bound))
+	}
+	if fv.maxErr != nil {
+		return fv.maxErr
+	}
+	if fv.max.IsValid() && bound.IsValid() && compareSimple(bound, fv.max) > 0 {
+		return fv.violation(bound.Interface(), "max", fv.max.Interface(), fmt.Sprintf("%v is too big", bound))
+	}
+	// Empty slices and maps which are not nil, e.g. decoded from [] or {},
+	// are present and checked.
+	if isZeroValue(v) && !isEmptyCollection(v) {
+		return nil
+	}
+
+	if fv.pattern != nil && !fv.pattern.MatchString(bound.String()) {
+		return fv.violation(bound.String(), "pattern", fv.pattern.String(),
+			fmt.Sprintf("%s does not match %s", bound, fv.pattern))
+	}
+	if fv.minLength >= 0 || fv.maxLength >= 0 {
+		n := utf8.RuneCountInString(bound.String())
+		if fv.minLength >= 0 && n < fv.minLength {
+			return fv.violation(bound.String(), "minLength", fv.minLength, fmt.Sprintf("%s is too short", bound))
+		}
+		if fv.maxLength >= 0 && n > fv.maxLength {
+			return fv.violation(bound.String(), "maxLength", fv.maxLength, fmt.Sprintf("%s is too long", bound))
+		}
+	}
+	if fv.minItems >= 0 && bound.Len() < fv.minItems {
+		return fv.violation(bound.Len(), "minItems", fv.minItems, fmt.Sprintf("too few items in field %s", fv.name))
+	}
+	if fv.maxItems >= 0 && bound.Len() > fv.maxItems {
+		return fv.violation(bound.Len(), "maxItems", fv.maxItems, fmt.Sprintf("too many items in field %s", fv.name))
+	}
+	if len(fv.enum) > 0 && !contains(fv.enum, enumValue(bound)) {
+		return fv.violation(bound.Interface(), "enum", fv.enum,
+			fmt.Sprintf("%s is not one of %s", enumValue(bound), strings.Join(fv.enum, ", ")))
+	}
+	if len(fv.itemEnum) == 0 {
+		return nil
+	}
+	for i := 0; i < bound.Len(); i++ {
+		item := reflect.Indirect(bound.Index(i))
+		if !item.IsValid() || isZeroValue(item) || contains(fv.itemEnum, enumValue(item)) {
+			continue
+		}
+		violation := fv.violation(item.Interface(), "enum", fv.itemEnum,
+			fmt.Sprintf("%s is not one of %s", enumValue(item), strings.Join(fv.itemEnum, ", ")))
+		violation.Field = fmt.Sprintf("%s[%d]", fv.path, i)
+		return violation
+	}
+	return nil
+}
+
+// enumValue formats v as values of enumerations are written, e.g. "1" for
+// an int, regardless of a String method of its type.
+func enumValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// violation returns a violation of a constraint of the field by value v,
+// described by msg.
+func (fv *fieldValidation) violation(v interface{}, constraint string, limit interface{}, msg string) *FieldViolation {
+	return &FieldViolation{
+		Field:      fv.path,
+		Constraint: constraint,
+		Value:      v,
+		Limit:      limit,
+		Msg:        msg,
+	}
+}
+
+// isZeroValue reports whether v is zero. A slice or a map is zero if
+// it's empty.
+func isZeroValue(v reflect.Value) bool {
+	switch k := v.Kind(); {
+	case k == reflect.Bool, reflect.Int <= k && k <= reflect.Float64, k == reflect.String:
+		return isZeroSimple(v)
+	case k == reflect.Ptr, k == reflect.Interface, k == reflect.Chan, k == reflect.Func:
+		return v.IsNil()
+	case k == reflect.Slice, k == reflect.Map:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// isEmptyCollection reports whether v is an empty slice or map which is
+// not nil.
+func isEmptyCollection(v reflect.Value) bool {
+	k := v.Kind()
+	return (k == reflect.Slice || k == reflect.Map) && !v.IsNil() && v.Len() == 0
+}
+
+// isZeroSimple reports whether v, a value of a simple kind, is zero.
+func isZeroSimple(v reflect.Value) bool {
+	switch k := v.Kind(); {
+	case k == reflect.Bool:
+		return !v.Bool()
+	case reflect.Int <= k && k <= reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint <= k && k <= reflect.Uintptr:
+		return v.Uint() == 0
+	case k == reflect.Float32, k == reflect.Float64:
+		return v.Float() == 0
+	}
+	return v.Len() == 0
+}
+
+// compareSimple compares a and b, numbers or strings of the same type.
+// It returns -1 if a < b, 1 if a > b, or 0 if a == b.
+func compareSimple(a, b reflect.Value) int {
+	cmp := 0
+	switch k := a.Kind(); {
+	case reflect.Int <= k && k <= reflect.Int64:
+		if a, b := a.Int(), b.Int(); a < b {
+			cmp = -1
+		} else if a > b {
+			cmp = 1
+		}
+	case reflect.Uint <= k && k <= reflect.Uint64:
+		if a, b := a.Uint(), b.Uint(); a < b {
+			cmp = -1
+		} else if a > b {
+			cmp = 1
+		}
+	case k == reflect.Float32, k == reflect.Float64:
+		if a, b := a.Float(), b.Float(); a < b {
+			cmp = -1
+		} else if a > b {
+			cmp = 1
+		}
+	case k == reflect.String:
+		if a, b := a.String(), b.String(); a < b {
+			cmp = -1
+		} else if a > b {
+			cmp = 1
+		}
+	}
+	return cmp
+}
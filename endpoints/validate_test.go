@@ -0,0 +1,471 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+type ValidateTestMsg struct {
+	ID     string  `json:"id" endpoints:"req"`
+	Limit  int     `json:"limit" endpoints:"d=10,min=1,max=100"`
+	Small  int8    `json:"small" endpoints:"d=3"`
+	Count  uint16  `json:"count" endpoints:"max=5"`
+	Score  float32 `json:"score" endpoints:"min=0.5"`
+	Name   string  `json:"name" endpoints:"min=b,max=y"`
+	Flag   bool    `json:"flag" endpoints:"d=true"`
+	Tags   []int   `json:"tags" endpoints:"req"`
+	hidden int     `endpoints:"req"`
+}
+
+type ValidateTestNamed string
+
+type ValidateTestItem struct {
+	Name  string `json:"name" endpoints:"req"`
+	Count int    `json:"count" endpoints:"d=1,max=10"`
+	Score *int   `json:"score" endpoints:"min=0"`
+}
+
+type ValidateTestEmbedded struct {
+	Kind string `json:"kind" endpoints:"d=item"`
+}
+
+// ValidateTestTree is a recursive type without structs.
+type ValidateTestTree []ValidateTestTree
+
+type ValidateTestNested struct {
+	ValidateTestEmbedded
+	Item   ValidateTestItem            `json:"item"`
+	Ptr    *ValidateTestItem           `json:"ptr"`
+	Items  []*ValidateTestItem         `json:"items" endpoints:"req"`
+	ByName map[string]ValidateTestItem `json:"byName"`
+	Next   *ValidateTestNested         `json:"next"`
+	Tree   ValidateTestTree            `json:"tree"`
+}
+
+type ValidateTestConstraints struct {
+	Slug  string            `json:"slug" endpoints:"pattern=^[a-z]+(-[a-z]+)*$,maxLength=10"`
+	Name  *string           `json:"name" endpoints:"minLength=2,maxLength=4"`
+	Color ValidateTestNamed `json:"color" endpoints:"enum=red|green"`
+	Level int               `json:"level" endpoints:"enum=1|2|3"`
+	Tags  []string          `json:"tags" endpoints:"minItems=2,maxItems=3"`
+	Attrs map[string]int    `json:"attrs" endpoints:"maxItems=1"`
+	Kind  string            `json:"kind" endpoints:"d=a,enum=a|b"`
+	Code  string            `json:"code" endpoints:"minLength=1"`
+	Flags map[string]bool   `json:"flags" endpoints:"minItems=1"`
+}
+
+type ValidateTestRange struct {
+	Start int `json:"start" endpoints:"req"`
+	End   int `json:"end"`
+}
+
+func (r *ValidateTestRange) Validate(c context.Context) error {
+	if r.End < r.Start {
+		return &FieldViolation{Field: "end", Constraint: "range", Value: r.End, Limit: r.Start,
+			Msg: "end is before start"}
+	}
+	return nil
+}
+
+// validateTestKey is a context key of the error returned by
+// ValidateTestPeriod.Validate.
+type validateTestKey struct{}
+
+type ValidateTestPeriod struct {
+	Name   string                       `json:"name" endpoints:"d=period"`
+	Range  ValidateTestRange            `json:"range"`
+	Ranges []*ValidateTestRange         `json:"ranges"`
+	ByName map[string]ValidateTestRange `json:"byName"`
+}
+
+func (p *ValidateTestPeriod) Validate(c context.Context) error {
+	if p.Name != "period" {
+		return fmt.Errorf("default name is not set: %q", p.Name)
+	}
+	err, _ := c.Value(validateTestKey{}).(error)
+	return err
+}
+
+type ValidateTestBadMsg struct {
+	Both    string            `endpoints:"req,d=x"`
+	Default int               `endpoints:"d=ten"`
+	Min     int               `endpoints:"min=one"`
+	Max     bool              `endpoints:"max=true"`
+	Named   ValidateTestNamed `endpoints:"d=hello,max=x"`
+	Pattern int               `endpoints:"pattern=[0-9]"`
+}
+
+func TestValidateRequest(t *testing.T) {
+	tags := []int{1}
+	tts := []struct {
+		in, want *ValidateTestMsg
+		err      string
+	}{
+		{&ValidateTestMsg{ID: "x", Score: 1, Name: "n", Tags: tags},
+			&ValidateTestMsg{ID: "x", Limit: 10, Small: 3, Score: 1, Name: "n", Flag: true, Tags: tags}, ""},
+		{&ValidateTestMsg{ID: "x", Limit: 5, Small: -1, Count: 5, Score: 0.5, Name: "gopher", Flag: true, Tags: tags},
+			&ValidateTestMsg{ID: "x", Limit: 5, Small: -1, Count: 5, Score: 0.5, Name: "gopher", Flag: true, Tags: tags}, ""},
+		{&ValidateTestMsg{Score: 1, Name: "n", Tags: tags}, nil, "missing field ID"},
+		{&ValidateTestMsg{ID: "x", Limit: 101, Score: 1, Name: "n", Tags: tags}, nil, "101 is too big"},
+		{&ValidateTestMsg{ID: "x", Limit: -1, Score: 1, Name: "n", Tags: tags}, nil, "-1 is too small"},
+		{&ValidateTestMsg{ID: "x", Count: 6, Score: 1, Name: "n", Tags: tags}, nil, "6 is too big"},
+		{&ValidateTestMsg{ID: "x", Score: 0.25, Name: "n", Tags: tags}, nil, "0.25 is too small"},
+		{&ValidateTestMsg{ID: "x", Score: 1, Name: "a", Tags: tags}, nil, "a is too small"},
+		{&ValidateTestMsg{ID: "x", Score: 1, Name: "z", Tags: tags}, nil, "z is too big"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(context.Background(), tt.in)
+		switch {
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%d: validateRequest(%+v) = %v; want %q", i, tt.in, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%d: validateRequest(%+v) = %v", i, tt.in, err)
+		case tt.err == "" && !reflect.DeepEqual(tt.in, tt.want):
+			t.Errorf("%d: validateRequest() set %+v; want %+v", i, tt.in, tt.want)
+		}
+	}
+}
+
+func TestValidateRequestViolations(t *testing.T) {
+	in := &ValidateTestMsg{Limit: 101, Count: 6, Score: 1, Name: "a"}
+	err := validateRequest(context.Background(), in)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("validateRequest(%+v) = %#v; want *ValidationError", in, err)
+	}
+	verifyPairs(t,
+		verr.Name, "Bad Request",
+		verr.Code, http.StatusBadRequest,
+		verr.Msg, "missing field ID; 101 is too big; 6 is too big; a is too small; missing field Tags")
+	want := []*FieldViolation{
+		{Field: "id", Constraint: "required", Msg: "missing field ID"},
+		{Field: "limit", Constraint: "max", Value: 101, Limit: 100, Msg: "101 is too big"},
+		{Field: "count", Constraint: "max", Value: uint16(6), Limit: uint16(5), Msg: "6 is too big"},
+		{Field: "name", Constraint: "min", Value: "a", Limit: "b", Msg: "a is too small"},
+		{Field: "tags", Constraint: "required", Msg: "missing field Tags"},
+	}
+	if !reflect.DeepEqual(verr.Violations, want) {
+		t.Errorf("Violations = %v; want %v", verr.Violations, want)
+	}
+}
+
+func TestValidateRequestNested(t *testing.T) {
+	in := &ValidateTestNested{
+		Item:   ValidateTestItem{Name: "a"},
+		Items:  []*ValidateTestItem{{Name: "b"}, {Name: "c", Count: 5}},
+		ByName: map[string]ValidateTestItem{"d": {Name: "d"}},
+		Next: &ValidateTestNested{
+			Item:  ValidateTestItem{Name: "e"},
+			Items: []*ValidateTestItem{{Name: "f"}},
+		},
+		Tree: ValidateTestTree{{}, {{}}},
+	}
+	if err := validateRequest(context.Background(), in); err != nil {
+		t.Fatalf("validateRequest(%+v) = %v", in, err)
+	}
+	verifyPairs(t,
+		in.Kind, "item",
+		in.Item.Count, 1,
+		in.Items[0].Count, 1,
+		in.Items[1].Count, 5,
+		in.ByName["d"].Count, 1,
+		in.Next.Kind, "item",
+		in.Next.Item.Count, 1,
+		in.Next.Items[0].Count, 1)
+
+	negative := -1
+	in = &ValidateTestNested{
+		Ptr:    &ValidateTestItem{Name: "a", Count: 11},
+		Items:  []*ValidateTestItem{{Name: "b"}, {Score: &negative}},
+		ByName: map[string]ValidateTestItem{"y": {}, "x": {Name: "x", Count: 20}},
+		Next:   &ValidateTestNested{Items: []*ValidateTestItem{nil}},
+	}
+	err := validateRequest(context.Background(), in)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("validateRequest(%+v) = %#v; want *ValidationError", in, err)
+	}
+	var paths []string
+	for _, v := range verr.Violations {
+		paths = append(paths, v.Field+" "+v.Constraint)
+	}
+	want := []string{
+		"item.name required",
+		"ptr.count max",
+		"items[1].name required",
+		"items[1].score min",
+		"byName.x.count max",
+		"byName.y.name required",
+		"next.item.name required",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("violations = %q; want %q", paths, want)
+	}
+}
+
+func TestValidateRequestConstraints(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tts := []struct {
+		in  *ValidateTestConstraints
+		err string
+	}{
+		{&ValidateTestConstraints{}, ""},
+		{&ValidateTestConstraints{Slug: "go-pher", Name: str("ÄÖÜ"), Color: "red", Level: 3,
+			Tags: []string{"a", "b", "c"}, Attrs: map[string]int{"a": 1}, Kind: "b"}, ""},
+		{&ValidateTestConstraints{Name: str("")}, " is too short"},
+		{&ValidateTestConstraints{Slug: "Gopher"}, "Gopher does not match ^[a-z]+(-[a-z]+)*$"},
+		{&ValidateTestConstraints{Slug: "go-pher-gopher"}, "go-pher-gopher is too long"},
+		{&ValidateTestConstraints{Name: str("a")}, "a is too short"},
+		{&ValidateTestConstraints{Name: str("gopher")}, "gopher is too long"},
+		{&ValidateTestConstraints{Color: "blue"}, "blue is not one of red, green"},
+		{&ValidateTestConstraints{Level: 4}, "4 is not one of 1, 2, 3"},
+		{&ValidateTestConstraints{Tags: []string{"a"}}, "too few items in field Tags"},
+		{&ValidateTestConstraints{Tags: []string{}}, "too few items in field Tags"},
+		{&ValidateTestConstraints{Flags: map[string]bool{}}, "too few items in field Flags"},
+		// An empty string can't be told apart from a missing one.
+		{&ValidateTestConstraints{Code: ""}, ""},
+		{&ValidateTestConstraints{Tags: []string{"a", "b", "c", "d"}}, "too many items in field Tags"},
+		{&ValidateTestConstraints{Attrs: map[string]int{"a": 1, "b": 2}}, "too many items in field Attrs"},
+		{&ValidateTestConstraints{Kind: "c"}, "c is not one of a, b"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(context.Background(), tt.in)
+		switch {
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%d: validateRequest(%+v) = %v; want %q", i, tt.in, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%d: validateRequest(%+v) = %v", i, tt.in, err)
+		}
+	}
+
+	in := &ValidateTestConstraints{Slug: "Go", Tags: []string{"a"}, Color: "blue"}
+	verr, ok := validateRequest(context.Background(), in).(*ValidationError)
+	if !ok {
+		t.Fatalf("validateRequest(%+v) is not a *ValidationError", in)
+	}
+	want := []*FieldViolation{
+		{Field: "slug", Constraint: "pattern", Value: "Go", Limit: "^[a-z]+(-[a-z]+)*$",
+			Msg: "Go does not match ^[a-z]+(-[a-z]+)*$"},
+		{Field: "color", Constraint: "enum", Value: ValidateTestNamed("blue"), Limit: []string{"red", "green"},
+			Msg: "blue is not one of red, green"},
+		{Field: "tags", Constraint: "minItems", Value: 1, Limit: 2, Msg: "too few items in field Tags"},
+	}
+	if !reflect.DeepEqual(verr.Violations, want) {
+		t.Errorf("Violations = %v; want %v", verr.Violations, want)
+	}
+}
+
+func TestValidateRequestEnum(t *testing.T) {
+	deleted := EnumStateDeleted
+	unknown := EnumState("unknown")
+	tts := []struct {
+		in  *EnumMsg
+		err string
+	}{
+		{&EnumMsg{}, ""},
+		{&EnumMsg{State: EnumStateActive, PState: &deleted, States: []EnumState{"active", "", "deleted"},
+			Level: 2, Kind: EnumStateActive}, ""},
+		{&EnumMsg{State: "unknown"}, "unknown is not one of active, deleted"},
+		{&EnumMsg{PState: &unknown}, "unknown is not one of active, deleted"},
+		{&EnumMsg{Level: 3}, "3 is not one of 1, 2"},
+		{&EnumMsg{Kind: EnumStateDeleted}, "deleted is not one of active"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(context.Background(), tt.in)
+		switch {
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%d: validateRequest(%+v) = %v; want %q", i, tt.in, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%d: validateRequest(%+v) = %v", i, tt.in, err)
+		}
+	}
+
+	in := &EnumMsg{States: []EnumState{"active", "unknown"}}
+	verr, ok := validateRequest(context.Background(), in).(*ValidationError)
+	if !ok {
+		t.Fatalf("validateRequest(%+v) is not a *ValidationError", in)
+	}
+	want := []*FieldViolation{{Field: "states[1]", Constraint: "enum", Value: EnumState("unknown"),
+		Limit: []string{"active", "deleted"}, Msg: "unknown is not one of active, deleted"}}
+	if !reflect.DeepEqual(verr.Violations, want) {
+		t.Errorf("Violations = %v; want %v", verr.Violations, want)
+	}
+}
+
+// ValidateTestPriority is an enumeration with display names.
+type ValidateTestPriority int
+
+func (p ValidateTestPriority) String() string {
+	switch p {
+	case 1:
+		return "low"
+	case 2:
+		return "high"
+	}
+	return "unknown"
+}
+
+func (ValidateTestPriority) EndpointsEnum() []EnumValue {
+	return []EnumValue{{Value: "1", Desc: "Low"}, {Value: "2", Desc: "High"}}
+}
+
+type ValidateTestPriorityMsg struct {
+	Priority   ValidateTestPriority   `json:"priority"`
+	Priorities []ValidateTestPriority `json:"priorities"`
+	Tagged     ValidateTestPriority   `json:"tagged" endpoints:"enum=2"`
+}
+
+func TestValidateRequestEnumStringer(t *testing.T) {
+	tts := []struct {
+		in  *ValidateTestPriorityMsg
+		err string
+	}{
+		{&ValidateTestPriorityMsg{Priority: 2, Priorities: []ValidateTestPriority{1, 2}, Tagged: 2}, ""},
+		{&ValidateTestPriorityMsg{Priority: 3}, "3 is not one of 1, 2"},
+		{&ValidateTestPriorityMsg{Priorities: []ValidateTestPriority{1, 3}}, "3 is not one of 1, 2"},
+		{&ValidateTestPriorityMsg{Tagged: 1}, "1 is not one of 2"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(context.Background(), tt.in)
+		switch {
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%d: validateRequest(%+v) = %v; want %q", i, tt.in, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%d: validateRequest(%+v) = %v", i, tt.in, err)
+		}
+	}
+}
+
+func TestValidateRequestValidator(t *testing.T) {
+	valid := func() *ValidateTestPeriod {
+		return &ValidateTestPeriod{
+			Range:  ValidateTestRange{Start: 1, End: 2},
+			Ranges: []*ValidateTestRange{{Start: 1, End: 1}},
+			ByName: map[string]ValidateTestRange{"x": {Start: 1, End: 3}},
+		}
+	}
+	c := context.Background()
+	if err := validateRequest(c, valid()); err != nil {
+		t.Errorf("validateRequest(valid) = %v", err)
+	}
+
+	forbidden := NewForbiddenError("no periods")
+	if err := validateRequest(context.WithValue(c, validateTestKey{}, forbidden), valid()); err != forbidden {
+		t.Errorf("validateRequest(forbidden) = %v; want %v", err, forbidden)
+	}
+
+	tts := []struct {
+		err  error
+		in   func(*ValidateTestPeriod)
+		want []*FieldViolation
+	}{
+		{errors.New("invalid period"), nil,
+			[]*FieldViolation{{Constraint: "validate", Msg: "invalid period"}}},
+		{NewValidationError(
+			&FieldViolation{Field: "name", Constraint: "unique", Msg: "name is taken"},
+			&FieldViolation{Field: "range.end", Constraint: "busy", Msg: "end is busy"}), nil,
+			[]*FieldViolation{
+				{Field: "name", Constraint: "unique", Msg: "name is taken"},
+				{Field: "range.end", Constraint: "busy", Msg: "end is busy"},
+			}},
+		{errors.New("not called"), func(p *ValidateTestPeriod) {
+			p.Range.End = 0
+			p.Ranges = append(p.Ranges, &ValidateTestRange{End: -1})
+			p.ByName["y"] = ValidateTestRange{Start: 5, End: 4}
+		}, []*FieldViolation{
+			{Field: "range.end", Constraint: "range", Value: 0, Limit: 1, Msg: "end is before start"},
+			{Field: "ranges[1].start", Constraint: "required", Msg: "missing field Start"},
+			{Field: "byName.y.end", Constraint: "range", Value: 4, Limit: 5, Msg: "end is before start"},
+		}},
+	}
+	for i, tt := range tts {
+		in := valid()
+		if tt.in != nil {
+			tt.in(in)
+		}
+		err := validateRequest(context.WithValue(c, validateTestKey{}, tt.err), in)
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%d: validateRequest(%+v) = %#v; want *ValidationError", i, in, err)
+			continue
+		}
+		if !reflect.DeepEqual(verr.Violations, tt.want) {
+			t.Errorf("%d: Violations = %v; want %v", i, verr.Violations, tt.want)
+		}
+	}
+}
+
+func TestValidateRequestErrors(t *testing.T) {
+	tts := []struct {
+		in  interface{}
+		err string
+	}{
+		{ValidateTestMsg{}, "endpoints.ValidateTestMsg is not a pointer"},
+		{new(int), "*int is not a pointer to a struct"},
+		{&ValidateTestBadMsg{}, `parse tag: Can't have both required and default ("x")`},
+		{&ValidateTestBadMsg{Both: "x"},
+			`parse tag: Can't have both required and default ("x")`},
+	}
+	for i, tt := range tts {
+		if err := validateRequest(context.Background(), tt.in); err == nil || err.Error() != tt.err {
+			t.Errorf("%d: validateRequest(%#v) = %v; want %q", i, tt.in, err, tt.err)
+		}
+	}
+
+	plan := validationPlanFor(reflect.TypeOf(ValidateTestBadMsg{}))
+	fieldErrs := []struct {
+		value interface{}
+		err   string
+	}{
+		{0, `parse default value: strconv.Atoi: parsing "ten": invalid syntax`},
+		{1, `compare with min value: parse min value: strconv.Atoi: parsing "one": invalid syntax`},
+		{false, `compare with max value: parse max value: unsupported type bool`},
+		{ValidateTestNamed("y"), `y is too big`},
+		{1, `parse tag: pattern, minLength and maxLength apply only to strings, not int`},
+	}
+	for i, tt := range fieldErrs {
+		fv := plan.fields[i+1]
+		v := reflect.New(reflect.TypeOf(tt.value)).Elem()
+		v.Set(reflect.ValueOf(tt.value))
+		if err := fv.validate(v); err == nil || err.Error() != tt.err {
+			t.Errorf("%d: %s.validate(%v) = %v; want %q", i, fv.name, tt.value, err, tt.err)
+		}
+	}
+
+	named := reflect.New(reflect.TypeOf(ValidateTestNamed(""))).Elem()
+	if err := plan.fields[4].validate(named); err != nil || named.String() != "hello" {
+		t.Errorf("Named.validate() = %v, %q; want nil, %q", err, named.String(), "hello")
+	}
+}
+
+func TestValidationPlanFor(t *testing.T) {
+	typ := reflect.TypeOf(ValidateTestMsg{})
+	plan := validationPlanFor(typ)
+	if plan != validationPlanFor(typ) {
+		t.Errorf("validationPlanFor(%v) is not cached", typ)
+	}
+
+	var names []string
+	for _, fv := range plan.fields {
+		names = append(names, fv.name)
+	}
+	want := []string{"ID", "Limit", "Small", "Count", "Score", "Name", "Flag", "Tags"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("plan fields = %v; want %v", names, want)
+	}
+}
+
+func BenchmarkValidateRequest(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg := &BenchMsg{ID: "x", Score: 0.5}
+		if err := validateRequest(context.Background(), msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}